@@ -0,0 +1,332 @@
+package access
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Lists an entry can belong to
+const (
+	ListAllow = "allow"
+	ListBlock = "block"
+)
+
+// Kinds of subject an entry matches
+const (
+	KindUser    = "user"
+	KindGroup   = "group"
+	KindGuild   = "guild"
+	KindChannel = "channel"
+)
+
+// listsFileVersion is bumped whenever the file format changes incompatibly
+const listsFileVersion = 1
+
+// purgeInterval is how often expired entries are removed from memory and disk
+const purgeInterval = time.Minute
+
+// Entry allows or blocks one user, group, guild or channel
+type Entry struct {
+	List      string    `json:"list"`
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	BotID     string    `json:"bot_id,omitempty"` // Empty applies the entry to every bot
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // Zero never expires
+}
+
+// expired reports whether the entry has expired at now
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// entryKey identifies an entry; adding an entry with the same key replaces it
+type entryKey struct {
+	list  string
+	kind  string
+	id    string
+	botID string
+}
+
+func keyOf(e Entry) entryKey {
+	return entryKey{list: e.List, kind: e.Kind, id: e.ID, botID: e.BotID}
+}
+
+// Subject is the sender and conversation of an incoming event
+type Subject struct {
+	BotID     string
+	UserID    string
+	GroupID   string
+	GuildID   string
+	ChannelID string
+}
+
+// Verdict is the outcome of checking a subject against the lists
+type Verdict int
+
+const (
+	Unlisted Verdict = iota // No entry matched
+	Allowed                 // An allow entry matched
+	Blocked                 // A block entry matched
+)
+
+// Decision is a verdict together with the entry that produced it
+type Decision struct {
+	Verdict Verdict
+	Entry   Entry
+}
+
+// listsFile is the on-disk form of the lists
+type listsFile struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Store holds the allow and block lists and persists them to a JSON file
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[entryKey]Entry
+}
+
+// NewStore creates a new empty Store persisted at path; an empty path keeps the lists in memory only
+func NewStore(path string) *Store {
+	return &Store{
+		path:    path,
+		entries: make(map[entryKey]Entry),
+	}
+}
+
+// Load replaces the lists with the contents of the store's file, if it exists
+func (s *Store) Load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read access lists: %w", err)
+	}
+
+	var file listsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse access lists: %w", err)
+	}
+	if file.Version != listsFileVersion {
+		return fmt.Errorf("unsupported access lists version %d", file.Version)
+	}
+
+	now := time.Now()
+	entries := make(map[entryKey]Entry, len(file.Entries))
+	for _, entry := range file.Entries {
+		if err := validate(entry); err != nil || entry.expired(now) {
+			continue
+		}
+		entries[keyOf(entry)] = entry
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	return nil
+}
+
+// validate checks an entry's list, kind and ID
+func validate(entry Entry) error {
+	switch entry.List {
+	case ListAllow, ListBlock:
+	default:
+		return fmt.Errorf("unknown list %q", entry.List)
+	}
+	switch entry.Kind {
+	case KindUser, KindGroup, KindGuild, KindChannel:
+	default:
+		return fmt.Errorf("unknown kind %q", entry.Kind)
+	}
+	if entry.ID == "" {
+		return fmt.Errorf("entry has no id")
+	}
+	return nil
+}
+
+// Check matches a subject against the lists. The most specific kind with an
+// unexpired entry decides, in the order user, channel, group, guild, so an
+// allowlisted operator still gets through a blocked group. Within one kind a
+// block entry wins over an allow entry.
+func (s *Store) Check(subject Subject, now time.Time) Decision {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.entries) == 0 {
+		return Decision{}
+	}
+
+	candidates := []struct{ kind, id string }{
+		{KindUser, subject.UserID},
+		{KindChannel, subject.ChannelID},
+		{KindGroup, subject.GroupID},
+		{KindGuild, subject.GuildID},
+	}
+	for _, c := range candidates {
+		if c.id == "" {
+			continue
+		}
+		for _, list := range []string{ListBlock, ListAllow} {
+			if entry, ok := s.lookupLocked(list, c.kind, c.id, subject.BotID, now); ok {
+				verdict := Allowed
+				if list == ListBlock {
+					verdict = Blocked
+				}
+				return Decision{Verdict: verdict, Entry: entry}
+			}
+		}
+	}
+	return Decision{}
+}
+
+// lookupLocked finds an unexpired entry for the bot or for every bot; s.mu must be held
+func (s *Store) lookupLocked(list, kind, id, botID string, now time.Time) (Entry, bool) {
+	for _, bot := range []string{botID, ""} {
+		entry, ok := s.entries[entryKey{list: list, kind: kind, id: id, botID: bot}]
+		if ok && !entry.expired(now) {
+			return entry, true
+		}
+		if botID == "" {
+			break
+		}
+	}
+	return Entry{}, false
+}
+
+// Add adds or replaces an entry and persists the lists
+func (s *Store) Add(entry Entry) error {
+	if err := validate(entry); err != nil {
+		return err
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[keyOf(entry)] = entry
+	return s.saveLocked()
+}
+
+// Remove deletes an entry and persists the lists, reporting whether it existed
+func (s *Store) Remove(list, kind, id, botID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := entryKey{list: list, kind: kind, id: id, botID: botID}
+	if _, ok := s.entries[key]; !ok {
+		return false, nil
+	}
+	delete(s.entries, key)
+	return true, s.saveLocked()
+}
+
+// Entries returns the unexpired entries ordered by list, kind and ID
+func (s *Store) Entries() []Entry {
+	now := time.Now()
+	s.mu.RLock()
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.List != b.List {
+			return a.List < b.List
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		return a.BotID < b.BotID
+	})
+	return entries
+}
+
+// saveLocked writes the unexpired entries to the store's file atomically; s.mu must be held
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	now := time.Now()
+	file := listsFile{Version: listsFileVersion, Entries: make([]Entry, 0, len(s.entries))}
+	for _, entry := range s.entries {
+		if !entry.expired(now) {
+			file.Entries = append(file.Entries, entry)
+		}
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal access lists: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create access lists directory: %w", err)
+	}
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write access lists: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace access lists: %w", err)
+	}
+	return nil
+}
+
+// purgeExpired drops expired entries, persisting the lists if any were removed
+func (s *Store) purgeExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.saveLocked()
+}
+
+// Run periodically purges expired entries until the context is cancelled
+func (s *Store) Run(ctx context.Context) error {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-ticker.C:
+			removed, err := s.purgeExpired(now)
+			if err != nil {
+				zap.L().Error("Failed to persist access lists", zap.Error(err))
+			} else if removed > 0 {
+				zap.L().Info("Expired access list entries removed", zap.Int("removed", removed))
+			}
+		}
+	}
+}
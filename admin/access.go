@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/access"
+)
+
+// accessEntryRequest is the request body accepted when adding a list entry
+type accessEntryRequest struct {
+	List   string `json:"list"`
+	Kind   string `json:"kind"`
+	ID     string `json:"id"`
+	BotID  string `json:"bot_id"`
+	Reason string `json:"reason"`
+	TTL    string `json:"ttl"` // Optional lifetime such as "24h"; empty never expires
+}
+
+// NewAccessListHandler returns a handler that lists entries on GET, adds or
+// replaces one on POST and removes one on DELETE (identified by the list,
+// kind, id and bot_id query parameters).
+func NewAccessListHandler(store *access.Store, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			var req accessEntryRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			now := time.Now()
+			entry := access.Entry{
+				List:      req.List,
+				Kind:      req.Kind,
+				ID:        req.ID,
+				BotID:     req.BotID,
+				Reason:    req.Reason,
+				CreatedAt: now,
+			}
+			if req.TTL != "" {
+				ttl, err := time.ParseDuration(req.TTL)
+				if err != nil || ttl <= 0 {
+					writeError(rw, logger, http.StatusBadRequest, "invalid ttl")
+					return
+				}
+				entry.ExpiresAt = now.Add(ttl)
+			}
+			if err := store.Add(entry); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, err.Error())
+				return
+			}
+			logger.Info("Access list entry added via admin API",
+				zap.String("list", entry.List),
+				zap.String("kind", entry.Kind),
+				zap.String("id", entry.ID),
+				zap.String("bot_id", entry.BotID),
+				zap.Time("expires_at", entry.ExpiresAt))
+		case http.MethodDelete:
+			query := r.URL.Query()
+			removed, err := store.Remove(query.Get("list"), query.Get("kind"), query.Get("id"), query.Get("bot_id"))
+			if err != nil {
+				writeError(rw, logger, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !removed {
+				writeError(rw, logger, http.StatusNotFound, "entry not found")
+				return
+			}
+			logger.Info("Access list entry removed via admin API",
+				zap.String("list", query.Get("list")),
+				zap.String("kind", query.Get("kind")),
+				zap.String("id", query.Get("id")),
+				zap.String("bot_id", query.Get("bot_id")))
+		default:
+			writeError(rw, logger, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		writeJSON(rw, logger, http.StatusOK, store.Entries())
+	})
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/history"
+)
+
+// historySeriesList is the response body when no series is requested
+type historySeriesList struct {
+	Interval  string               `json:"interval"`
+	Retention string               `json:"retention"`
+	Series    []history.SeriesInfo `json:"series"`
+}
+
+// NewHistoryHandler returns a read-only handler for the metrics history. With
+// no series parameter it lists the stored series; otherwise it returns the
+// points of that metric, filtered by repeated label=name=value parameters,
+// between from and to (RFC 3339, Unix seconds, or relative such as -6h;
+// default the last hour), optionally downsampled to step and, for counters,
+// converted to a per-second rate with rate=true.
+func NewHistoryHandler(store *history.Store, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(rw, logger, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		params := r.URL.Query()
+		if params.Get("series") == "" {
+			writeJSON(rw, logger, http.StatusOK, historySeriesList{
+				Interval:  store.Interval().String(),
+				Retention: store.Retention().String(),
+				Series:    store.Series(),
+			})
+			return
+		}
+
+		now := time.Now()
+		q := history.Query{Name: params.Get("series"), Labels: make(map[string]string)}
+		for _, label := range params["label"] {
+			name, value, ok := strings.Cut(label, "=")
+			if !ok || name == "" {
+				writeError(rw, logger, http.StatusBadRequest, "invalid label filter "+strconv.Quote(label))
+				return
+			}
+			q.Labels[name] = value
+		}
+		var err error
+		if q.From, err = parseHistoryTime(params.Get("from"), now); err != nil {
+			writeError(rw, logger, http.StatusBadRequest, "invalid from")
+			return
+		}
+		if q.To, err = parseHistoryTime(params.Get("to"), now); err != nil {
+			writeError(rw, logger, http.StatusBadRequest, "invalid to")
+			return
+		}
+		if step := params.Get("step"); step != "" {
+			if q.Step, err = time.ParseDuration(step); err != nil || q.Step <= 0 {
+				writeError(rw, logger, http.StatusBadRequest, "invalid step")
+				return
+			}
+		}
+		if rate := params.Get("rate"); rate != "" {
+			if q.Rate, err = strconv.ParseBool(rate); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, "invalid rate")
+				return
+			}
+		}
+
+		results, err := store.Query(q)
+		if err != nil {
+			writeError(rw, logger, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(rw, logger, http.StatusOK, results)
+	})
+}
+
+// parseHistoryTime parses an absolute or relative time; empty returns the zero time
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case "":
+		return time.Time{}, nil
+	case "now":
+		return now, nil
+	}
+	if strings.HasPrefix(value, "-") {
+		ago, err := time.ParseDuration(value[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(-ago), nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/interfaces"
+)
+
+// workerPoolStatus is the response body of the worker pool endpoint
+type workerPoolStatus struct {
+	Workers    int `json:"workers"`
+	Busy       int `json:"busy"`
+	QueueDepth int `json:"queue_depth"`
+}
+
+// resizeRequest is the request body accepted when resizing the worker pool
+type resizeRequest struct {
+	Size int `json:"size"`
+}
+
+// NewWorkerPoolHandler returns a handler that reports the worker pool on GET and resizes it on POST.
+func NewWorkerPoolHandler(controller interfaces.WorkerPoolController, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost, http.MethodPut:
+			var req resizeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if err := controller.Resize(req.Size); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, err.Error())
+				return
+			}
+			logger.Info("Worker pool resized via admin API",
+				zap.Int("requested", req.Size),
+				zap.Int("workers", controller.WorkerCount()))
+		default:
+			writeError(rw, logger, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		writeJSON(rw, logger, http.StatusOK, workerPoolStatus{
+			Workers:    controller.WorkerCount(),
+			Busy:       controller.BusyWorkers(),
+			QueueDepth: controller.GetQueueSize(),
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+)
+
+// Server exposes runtime administration endpoints on a listener separate from the webhook server.
+type Server struct {
+	cfg    config.AdminConfig
+	logger *zap.Logger
+	mux    *http.ServeMux
+}
+
+// NewServer creates a new admin server.
+func NewServer(cfg config.AdminConfig, logger *zap.Logger) *Server {
+	return &Server{
+		cfg:    cfg,
+		logger: logger,
+		mux:    http.NewServeMux(),
+	}
+}
+
+// Handle registers a handler for the given pattern, protected by the admin token.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, s.authorize(handler))
+}
+
+// authorize rejects requests that do not carry the configured bearer token
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.cfg.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			s.logger.Warn("Rejected unauthorized admin request",
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr))
+			http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// Run starts the admin listener and shuts it down when the context is
+// cancelled. It refuses to start without a token, as the endpoints can
+// resize workers, edit access lists and train the spam model.
+func (s *Server) Run(ctx context.Context) error {
+	if s.cfg.Token == "" {
+		return errors.New("admin API is enabled but admin.token is empty, not starting the admin listener")
+	}
+
+	server := &http.Server{
+		Addr:    s.cfg.Listen,
+		Handler: s.mux,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		s.logger.Info("Starting admin server...", zap.String("listen", s.cfg.Listen))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	select {
+	case err, ok := <-errChan:
+		if ok {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			s.logger.Error("Admin server shutdown failed", zap.Error(err))
+		}
+		return ctx.Err()
+	}
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(rw http.ResponseWriter, logger *zap.Logger, statusCode int, payload interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+	if err := json.NewEncoder(rw).Encode(payload); err != nil {
+		logger.Error("Failed to write admin response",
+			zap.Int("status_code", statusCode),
+			zap.Error(err))
+	}
+}
+
+// writeError writes a JSON error response
+func writeError(rw http.ResponseWriter, logger *zap.Logger, statusCode int, message string) {
+	writeJSON(rw, logger, statusCode, map[string]string{"error": message})
+}
+
+// NewSnapshotHandler returns a read-only handler that serves the value returned by snapshot as JSON.
+func NewSnapshotHandler(snapshot func() interface{}, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(rw, logger, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(rw, logger, http.StatusOK, snapshot())
+	})
+}
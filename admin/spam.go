@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/spam"
+)
+
+// spamStatus is the response body of the spam classifier endpoint
+type spamStatus struct {
+	Model spam.Info `json:"model"`
+	Score *float64  `json:"score,omitempty"` // Score of the text query parameter, if given and the model is ready
+}
+
+// NewSpamHandler returns a handler that reports the spam model on GET, also
+// scoring the text query parameter if present, and trains it on POST with
+// operator feedback in the labelled JSONL format, e.g.
+// {"text": "...", "label": "spam"}.
+func NewSpamHandler(classifier *spam.Classifier, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var status spamStatus
+		switch r.Method {
+		case http.MethodGet:
+			if text := r.URL.Query().Get("text"); text != "" {
+				if score, ok := classifier.SpamScore(text); ok {
+					status.Score = &score
+				}
+			}
+		case http.MethodPost:
+			var example spam.Example
+			if err := json.NewDecoder(r.Body).Decode(&example); err != nil {
+				writeError(rw, logger, http.StatusBadRequest, "invalid request body")
+				return
+			}
+			if example.Text == "" {
+				writeError(rw, logger, http.StatusBadRequest, "text is required")
+				return
+			}
+			if example.Label != spam.LabelSpam && example.Label != spam.LabelHam {
+				writeError(rw, logger, http.StatusBadRequest, `label must be "spam" or "ham"`)
+				return
+			}
+			if err := classifier.Feedback(example); err != nil {
+				writeError(rw, logger, http.StatusInternalServerError, err.Error())
+				return
+			}
+			logger.Info("Spam feedback received via admin API",
+				zap.String("label", example.Label),
+				zap.Int("length", len([]rune(example.Text))))
+		default:
+			writeError(rw, logger, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+
+		status.Model = classifier.Info()
+		writeJSON(rw, logger, http.StatusOK, status)
+	})
+}
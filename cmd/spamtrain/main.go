@@ -0,0 +1,129 @@
+// Command spamtrain trains the router's spam model from labelled JSONL.
+//
+//	spamtrain [-out data/spam_model.json] [-update] [-test held_out.jsonl] examples.jsonl...
+//
+// Each input line is {"text": "...", "label": "spam"|"ham"}; the feedback
+// the router collects in data/spam_feedback.jsonl has the same format. The
+// model is written atomically with its revision incremented, and a running
+// router picks it up within a minute.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"qqbotrouter/spam"
+)
+
+func main() {
+	out := flag.String("out", filepath.Join("data", spam.ModelFile), "model file to write")
+	update := flag.Bool("update", false, "continue training the existing model instead of starting afresh")
+	test := flag.String("test", "", "labelled JSONL to evaluate the trained model on")
+	threshold := flag.Float64("threshold", 0.9, "spam score counted as spam when evaluating")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] examples.jsonl...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*out, *update, *test, *threshold, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "spamtrain: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run trains a model on the input files, writes it and optionally evaluates it
+func run(out string, update bool, test string, threshold float64, inputs []string) error {
+	model := spam.NewModel()
+	if update {
+		existing, _, err := spam.ReadModel(out)
+		switch {
+		case err == nil:
+			model = existing
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+	} else if existing, _, err := spam.ReadModel(out); err == nil {
+		model.Revision = existing.Revision // Keep revisions increasing across retrains
+	}
+
+	for _, input := range inputs {
+		examples, err := readExamples(input)
+		if err != nil {
+			return err
+		}
+		for _, example := range examples {
+			model.Train(example.Text, example.IsSpam())
+		}
+		fmt.Printf("%s: %d examples\n", input, len(examples))
+	}
+	if !model.Ready() {
+		return fmt.Errorf("model needs at least a few examples of both spam and ham, has %d ham and %d spam",
+			model.Docs[0], model.Docs[1])
+	}
+
+	model.Revision++
+	if _, err := spam.WriteModel(out, model); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: revision %d, %d ham, %d spam, %d n-grams\n",
+		out, model.Revision, model.Docs[0], model.Docs[1], len(model.Grams))
+
+	if test == "" {
+		return nil
+	}
+	examples, err := readExamples(test)
+	if err != nil {
+		return err
+	}
+	var truePositives, falsePositives, falseNegatives, correct int
+	for _, example := range examples {
+		predicted := model.Score(example.Text) >= threshold
+		switch {
+		case predicted && example.IsSpam():
+			truePositives++
+		case predicted:
+			falsePositives++
+		case example.IsSpam():
+			falseNegatives++
+		}
+		if predicted == example.IsSpam() {
+			correct++
+		}
+	}
+	fmt.Printf("%s: accuracy %.3f, precision %.3f, recall %.3f at threshold %g\n", test,
+		ratio(correct, len(examples)),
+		ratio(truePositives, truePositives+falsePositives),
+		ratio(truePositives, truePositives+falseNegatives),
+		threshold)
+	return nil
+}
+
+// readExamples reads one labelled JSONL file
+func readExamples(path string) ([]spam.Example, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	examples, err := spam.ReadExamples(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return examples, nil
+}
+
+// ratio returns n/d, or 0 when d is 0
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
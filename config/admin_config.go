@@ -0,0 +1,18 @@
+package config
+
+// AdminConfig contains configuration for the internal admin API listener
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	Token   string `yaml:"token"` // Bearer token required on every request; the listener refuses to start without one
+}
+
+// GetDefaultAdminConfig returns default admin API configuration. The listener
+// is off by default and does not start without a token.
+func GetDefaultAdminConfig() AdminConfig {
+	return AdminConfig{
+		Enabled: false,
+		Listen:  "127.0.0.1:9090",
+		Token:   "",
+	}
+}
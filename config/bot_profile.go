@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BotSchedulerConfig holds a bot's scheduler settings
+type BotSchedulerConfig struct {
+	MaxWorkerShare float64 `yaml:"max_worker_share,omitempty"` // Cap on the fraction of workers this bot's requests may use, 0 = no cap
+}
+
+// QoSForBot returns the QoS configuration that applies to a bot: the global
+// qos section with the bot's own qos section merged over it. Only the keys
+// present in the bot's section are overridden; nested sections and maps are
+// merged key by key, lists are replaced.
+func (c *Config) QoSForBot(botID string) (QoSConfig, error) {
+	bot, ok := c.Bots[botID]
+	if !ok || bot.QoS.IsZero() {
+		return c.QoS, nil
+	}
+	return mergeQoSOverride(c.QoS, &bot.QoS)
+}
+
+// BotQoSProfiles returns the merged QoS configuration of every bot that has its own qos section
+func (c *Config) BotQoSProfiles() (map[string]QoSConfig, error) {
+	profiles := make(map[string]QoSConfig)
+	for botID, bot := range c.Bots {
+		if bot.QoS.IsZero() {
+			continue
+		}
+		profile, err := mergeQoSOverride(c.QoS, &bot.QoS)
+		if err != nil {
+			return nil, fmt.Errorf("bot %s: %w", botID, err)
+		}
+		profiles[botID] = profile
+	}
+	return profiles, nil
+}
+
+// mergeQoSOverride decodes an override section over a deep copy of base
+func mergeQoSOverride(base QoSConfig, override *yaml.Node) (QoSConfig, error) {
+	// Round-trip through YAML so merging maps never writes into base's maps
+	data, err := yaml.Marshal(base)
+	if err != nil {
+		return QoSConfig{}, fmt.Errorf("failed to copy qos config: %w", err)
+	}
+	var merged QoSConfig
+	if err := yaml.Unmarshal(data, &merged); err != nil {
+		return QoSConfig{}, fmt.Errorf("failed to copy qos config: %w", err)
+	}
+	if err := override.Decode(&merged); err != nil {
+		return QoSConfig{}, fmt.Errorf("invalid qos override: %w", err)
+	}
+	return merged, nil
+}
+
+// validateBotProfile checks a bot's QoS overrides and scheduler settings
+func validateBotProfile(bot BotConfig) error {
+	if !bot.QoS.IsZero() {
+		if bot.QoS.Kind != yaml.MappingNode {
+			return fmt.Errorf("qos override must be a mapping")
+		}
+		var probe QoSConfig
+		if err := bot.QoS.Decode(&probe); err != nil {
+			return fmt.Errorf("invalid qos override: %w", err)
+		}
+	}
+	if share := bot.Scheduler.MaxWorkerShare; share < 0 || share > 1 {
+		return fmt.Errorf("scheduler.max_worker_share must be between 0 and 1, got %v", share)
+	}
+	return nil
+}
@@ -12,11 +12,15 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// defaultDataDir is where runtime state (queue snapshots, lists, models) is persisted
+const defaultDataDir = "data"
+
 // Config represents the main configuration structure
 type Config struct {
 	LogLevel  string               `yaml:"log_level"`
 	HTTPSPort string               `yaml:"https_port"`
 	HTTPPort  string               `yaml:"http_port"`
+	DataDir   string               `yaml:"data_dir"`
 	Bots      map[string]BotConfig `yaml:"bots"`
 
 	// QoS Configuration
@@ -24,20 +28,54 @@ type Config struct {
 
 	// Scheduler Configuration
 	Scheduler SchedulerConfig `yaml:"scheduler"`
+
+	// Admin API Configuration
+	Admin AdminConfig `yaml:"admin"`
+
+	// Tracing Configuration
+	Tracing TracingConfig `yaml:"tracing"`
 }
 
 // BotConfig represents individual bot configuration
 type BotConfig struct {
-	Secret      string                      `yaml:"secret"`
-	ForwardTo   []string                    `yaml:"forward_to"`
-	RegexRoutes map[string]RegexRouteConfig `yaml:"regex_routes"`
+	Secret        string                      `yaml:"secret"`
+	ForwardTo     []string                    `yaml:"forward_to"`
+	RegexRoutes   map[string]RegexRouteConfig `yaml:"regex_routes"`
+	LateForwardTo []string                    `yaml:"late_forward_to,omitempty"`
+	Policy        PolicyConfig                `yaml:"policy,omitempty"` // Handling of throttled and undeliverable events
+
+	// QoS overrides merged over the global qos section, see Config.QoSForBot
+	QoS       yaml.Node          `yaml:"qos,omitempty"`
+	Scheduler BotSchedulerConfig `yaml:"scheduler,omitempty"`
 }
 
+// Ways a regex route chooses among its endpoints
+const (
+	RouteSelectAll    = "all"    // Forward to every endpoint
+	RouteSelectHash   = "hash"   // Forward to one endpoint chosen by hashing the user ID
+	RouteSelectBandit = "bandit" // Forward to the endpoint learned to deliver fastest and most reliably
+)
+
 // RegexRouteConfig represents regex route configuration
 type RegexRouteConfig struct {
-	IsHash    bool     `yaml:"ishash,omitempty"`
-	Endpoints []string `yaml:"endpoints,omitempty"`
-	URLs      []string `yaml:",flow,omitempty"`
+	IsHash       bool     `yaml:"ishash,omitempty"` // Same as selection: hash
+	Endpoints    []string `yaml:"endpoints,omitempty"`
+	URLs         []string `yaml:",flow,omitempty"`
+	ContentTypes []string `yaml:"content_types,omitempty"` // Only match these content types, e.g. image
+	Condition    string   `yaml:"condition,omitempty"`     // Rule expression, e.g. attachments.images > 0; user.in() reads scheduler.priority_strategy.user_groups
+	Selection    string   `yaml:"selection,omitempty"`     // all (default), hash or bandit
+}
+
+// SelectionMode returns how the route chooses among its endpoints
+func (r RegexRouteConfig) SelectionMode() string {
+	switch {
+	case r.Selection != "":
+		return r.Selection
+	case r.IsHash:
+		return RouteSelectHash
+	default:
+		return RouteSelectAll
+	}
 }
 
 // Load loads configuration from the specified file
@@ -269,6 +307,24 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("no bots configured")
 	}
 
+	if err := validateTracing(c.Tracing); err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	// Zero takes the defaults
+	cognitive := c.Scheduler.CognitiveScheduling
+	if cognitive.LearningRate < 0 || cognitive.LearningRate > 1 {
+		return fmt.Errorf("scheduler.cognitive_scheduling.learning_rate must be between 0 and 1, got %g", cognitive.LearningRate)
+	}
+	if cognitive.AdaptationThreshold < 0 {
+		return fmt.Errorf("scheduler.cognitive_scheduling.adaptation_threshold must not be negative, got %g", cognitive.AdaptationThreshold)
+	}
+
+	// Zero takes the default; a score of 0.5 or below is not evidence of spam
+	if threshold := c.Scheduler.MessageClassification.SpamThreshold; threshold != 0 && (threshold <= 0.5 || threshold > 1) {
+		return fmt.Errorf("scheduler.message_classification.spam_threshold must be above 0.5 and at most 1, got %g", threshold)
+	}
+
 	for webhookURL, botConfig := range c.Bots {
 		if botConfig.Secret == "" {
 			return fmt.Errorf("bot %s has empty secret", webhookURL)
@@ -278,6 +334,22 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("bot %s has no forward_to or regex_routes targets", webhookURL)
 		}
 
+		if err := validatePolicy(botConfig.Policy); err != nil {
+			return fmt.Errorf("bot %s: %w", webhookURL, err)
+		}
+
+		if err := validateBotProfile(botConfig); err != nil {
+			return fmt.Errorf("bot %s: %w", webhookURL, err)
+		}
+
+		for pattern, route := range botConfig.RegexRoutes {
+			switch route.Selection {
+			case "", RouteSelectAll, RouteSelectHash, RouteSelectBandit:
+			default:
+				return fmt.Errorf("bot %s route %s has unknown selection %q", webhookURL, pattern, route.Selection)
+			}
+		}
+
 		// Validate forward_to URLs
 		for _, target := range botConfig.ForwardTo {
 			if _, err := url.Parse(target); err != nil {
@@ -305,15 +377,144 @@ func (c *Config) SetDefaults() {
 		c.HTTPPort = defaults.Server.HTTPPort
 	}
 
+	if c.DataDir == "" {
+		c.DataDir = defaultDataDir
+	}
+
 	// Set QoS defaults
 	if c.QoS.SystemLimits.MaxLoad == 0 {
 		c.QoS = GetDefaultQoSConfig()
 	}
 
+	// Set concurrency limit defaults, keeping the enabled flag
+	if c.QoS.AdaptiveThrottling.Algorithm == "" {
+		enabled := c.QoS.AdaptiveThrottling.Enabled
+		c.QoS.AdaptiveThrottling = GetDefaultQoSConfig().AdaptiveThrottling
+		c.QoS.AdaptiveThrottling.Enabled = enabled
+	}
+
+	// Set circuit breaker window defaults
+	if c.QoS.CircuitBreaker.Window == "" {
+		c.QoS.CircuitBreaker.Window = GetDefaultQoSConfig().CircuitBreaker.Window
+	}
+	if c.QoS.CircuitBreaker.FailureRate == 0 {
+		c.QoS.CircuitBreaker.FailureRate = GetDefaultQoSConfig().CircuitBreaker.FailureRate
+	}
+
+	// Set performance monitoring defaults
+	if c.QoS.PerformanceMonitoring.MetricsInterval == "" {
+		c.QoS.PerformanceMonitoring.MetricsInterval = GetDefaultQoSConfig().PerformanceMonitoring.MetricsInterval
+	}
+	if c.QoS.PerformanceMonitoring.HistoryRetention == "" {
+		c.QoS.PerformanceMonitoring.HistoryRetention = GetDefaultQoSConfig().PerformanceMonitoring.HistoryRetention
+	}
+
+	// Set rate limit defaults field by field, keeping the enabled flag; the
+	// default limits only fill in when no limits are configured at all
+	if c.QoS.RateLimits.MaxEntries == 0 {
+		c.QoS.RateLimits.MaxEntries = GetDefaultRateLimitConfig().MaxEntries
+	}
+	if c.QoS.RateLimits.RateLimitScopes == (RateLimitScopes{}) && c.QoS.RateLimits.Classes == nil {
+		c.QoS.RateLimits.RateLimitScopes = GetDefaultRateLimitConfig().RateLimitScopes
+		c.QoS.RateLimits.Classes = GetDefaultRateLimitConfig().Classes
+	}
+
 	// Set Scheduler defaults
 	if c.Scheduler.PrioritySettings.BasePriority == 0 {
 		c.Scheduler = GetDefaultSchedulerConfig()
 	}
+
+	// Set priority strategy defaults, keeping any rules and user groups
+	strategyDefaults := GetDefaultSchedulerConfig().PriorityStrategy
+	if c.Scheduler.PriorityStrategy.Name == "" {
+		c.Scheduler.PriorityStrategy.Name = strategyDefaults.Name
+	}
+	if c.Scheduler.PriorityStrategy.LoadWeight == 0 && c.Scheduler.PriorityStrategy.ContentWeight == 0 {
+		c.Scheduler.PriorityStrategy.LoadWeight = strategyDefaults.LoadWeight
+		c.Scheduler.PriorityStrategy.ContentWeight = strategyDefaults.ContentWeight
+	}
+
+	// Set batch delivery defaults
+	if c.Scheduler.BatchDelivery.Linger == "" {
+		c.Scheduler.BatchDelivery.Linger = GetDefaultSchedulerConfig().BatchDelivery.Linger
+	}
+	if c.Scheduler.BatchDelivery.Format == "" {
+		c.Scheduler.BatchDelivery.Format = GetDefaultSchedulerConfig().BatchDelivery.Format
+	}
+
+	// Set spam classifier defaults
+	if c.Scheduler.MessageClassification.SpamThreshold == 0 {
+		c.Scheduler.MessageClassification.SpamThreshold = GetDefaultSchedulerConfig().MessageClassification.SpamThreshold
+	}
+
+	// Set cognitive scheduling defaults
+	if c.Scheduler.CognitiveScheduling.LearningRate == 0 {
+		c.Scheduler.CognitiveScheduling.LearningRate = GetDefaultSchedulerConfig().CognitiveScheduling.LearningRate
+	}
+	if c.Scheduler.CognitiveScheduling.MemoryWindow == "" {
+		c.Scheduler.CognitiveScheduling.MemoryWindow = GetDefaultSchedulerConfig().CognitiveScheduling.MemoryWindow
+	}
+
+	// Set message expiry defaults field by field, keeping the enabled flag
+	expiryDefaults := GetDefaultSchedulerConfig().MessageExpiry
+	if c.Scheduler.MessageExpiry.DefaultWindow == "" {
+		c.Scheduler.MessageExpiry.DefaultWindow = expiryDefaults.DefaultWindow
+	}
+	if c.Scheduler.MessageExpiry.EventWindows == nil {
+		c.Scheduler.MessageExpiry.EventWindows = expiryDefaults.EventWindows
+	}
+	if c.Scheduler.MessageExpiry.SafetyMargin == "" {
+		c.Scheduler.MessageExpiry.SafetyMargin = expiryDefaults.SafetyMargin
+	}
+	if c.Scheduler.MessageExpiry.Action == "" {
+		c.Scheduler.MessageExpiry.Action = expiryDefaults.Action
+	}
+
+	// Set load shedding defaults field by field, keeping the enabled flag
+	sheddingDefaults := GetDefaultSchedulerConfig().LoadShedding
+	if c.Scheduler.LoadShedding.Target == "" {
+		c.Scheduler.LoadShedding.Target = sheddingDefaults.Target
+	}
+	if c.Scheduler.LoadShedding.Interval == "" {
+		c.Scheduler.LoadShedding.Interval = sheddingDefaults.Interval
+	}
+	if c.Scheduler.LoadShedding.MaxPriority == 0 {
+		c.Scheduler.LoadShedding.MaxPriority = sheddingDefaults.MaxPriority
+	}
+
+	// Set shutdown defaults, keeping the persist flag
+	if c.Scheduler.Shutdown.DrainTimeout == "" {
+		c.Scheduler.Shutdown.DrainTimeout = GetDefaultSchedulerConfig().Shutdown.DrainTimeout
+	}
+
+	// Set worker autoscaling defaults field by field, keeping the enabled flag
+	autoscalingDefaults := GetDefaultSchedulerConfig().WorkerAutoscaling
+	if c.Scheduler.WorkerAutoscaling.MinWorkers == 0 {
+		c.Scheduler.WorkerAutoscaling.MinWorkers = autoscalingDefaults.MinWorkers
+	}
+	if c.Scheduler.WorkerAutoscaling.MaxWorkers == 0 {
+		c.Scheduler.WorkerAutoscaling.MaxWorkers = autoscalingDefaults.MaxWorkers
+	}
+	if c.Scheduler.WorkerAutoscaling.ScaleUpQueueDepth == 0 {
+		c.Scheduler.WorkerAutoscaling.ScaleUpQueueDepth = autoscalingDefaults.ScaleUpQueueDepth
+	}
+	if c.Scheduler.WorkerAutoscaling.ScaleStep == 0 {
+		c.Scheduler.WorkerAutoscaling.ScaleStep = autoscalingDefaults.ScaleStep
+	}
+	if c.Scheduler.WorkerAutoscaling.LatencyTarget == "" {
+		c.Scheduler.WorkerAutoscaling.LatencyTarget = autoscalingDefaults.LatencyTarget
+	}
+	if c.Scheduler.WorkerAutoscaling.CheckInterval == "" {
+		c.Scheduler.WorkerAutoscaling.CheckInterval = autoscalingDefaults.CheckInterval
+	}
+
+	// Set Admin API defaults, keeping the enabled flag and token
+	if c.Admin.Listen == "" {
+		c.Admin.Listen = GetDefaultAdminConfig().Listen
+	}
+
+	// Set tracing defaults, keeping any fields that were configured
+	c.Tracing.setDefaults()
 }
 
 // GenerateDefaultConfig generates a default configuration using centralized defaults
@@ -326,8 +527,11 @@ func GenerateDefaultConfig(configPath string) error {
 		LogLevel:  defaults.Server.LogLevel,
 		HTTPSPort: defaults.Server.HTTPSPort,
 		HTTPPort:  defaults.Server.HTTPPort,
+		DataDir:   defaultDataDir,
 		QoS:       GetDefaultQoSConfig(),
 		Scheduler: GetDefaultSchedulerConfig(),
+		Admin:     GetDefaultAdminConfig(),
+		Tracing:   GetDefaultTracingConfig(),
 		Bots: map[string]BotConfig{
 			"your-domain.com/webhook": {
 				Secret: "your-bot-secret-here",
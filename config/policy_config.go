@@ -0,0 +1,80 @@
+package config
+
+import "fmt"
+
+// Delivery policies for events that are throttled or could not be delivered
+const (
+	PolicyAckDrop   = "ack_drop"   // Acknowledge and drop the event (at-most-once)
+	PolicyAckDefer  = "ack_defer"  // Acknowledge, then re-admit and retry delivery later from a delay queue
+	PolicyFailAck   = "fail_ack"   // Return a failure ACK so the platform redelivers (at-least-once)
+	PolicyBusyReply = "busy_reply" // Acknowledge and tell the user to try again later
+)
+
+// PolicyConfig chooses what happens to a bot's throttled and undeliverable events
+type PolicyConfig struct {
+	OnThrottle   string `yaml:"on_throttle,omitempty"`
+	OnFailure    string `yaml:"on_failure,omitempty"`
+	DeferDelay   string `yaml:"defer_delay,omitempty"`   // Delay before a deferred event is retried
+	MaxDeferrals *int   `yaml:"max_deferrals,omitempty"` // Retries before a deferred event is dropped; 0 never defers
+	AckTimeout   string `yaml:"ack_timeout,omitempty"`   // With on_failure fail_ack, how long delivery may hold the ACK
+	BusyReply    string `yaml:"busy_reply,omitempty"`    // Text sent to the user by busy_reply
+	AppID        string `yaml:"app_id,omitempty"`        // Needed by busy_reply; the bot secret is the client secret
+}
+
+// GetDefaultPolicyConfig returns the default policies: throttled events are
+// refused so the platform retries them, failed deliveries are dropped
+func GetDefaultPolicyConfig() PolicyConfig {
+	maxDeferrals := 3
+	return PolicyConfig{
+		OnThrottle:   PolicyFailAck,
+		OnFailure:    PolicyAckDrop,
+		DeferDelay:   "10s",
+		MaxDeferrals: &maxDeferrals,
+		AckTimeout:   "3s",
+		BusyReply:    "当前消息较多，请稍后再试",
+	}
+}
+
+// EffectivePolicy returns the bot's policy with unset fields filled from the defaults
+func (b BotConfig) EffectivePolicy() PolicyConfig {
+	policy := b.Policy
+	defaults := GetDefaultPolicyConfig()
+	if policy.OnThrottle == "" {
+		policy.OnThrottle = defaults.OnThrottle
+	}
+	if policy.OnFailure == "" {
+		policy.OnFailure = defaults.OnFailure
+	}
+	if policy.DeferDelay == "" {
+		policy.DeferDelay = defaults.DeferDelay
+	}
+	if policy.MaxDeferrals == nil {
+		policy.MaxDeferrals = defaults.MaxDeferrals
+	}
+	if policy.AckTimeout == "" {
+		policy.AckTimeout = defaults.AckTimeout
+	}
+	if policy.BusyReply == "" {
+		policy.BusyReply = defaults.BusyReply
+	}
+	return policy
+}
+
+// validatePolicy checks a bot's policy names and their requirements
+func validatePolicy(policy PolicyConfig) error {
+	for _, name := range []string{policy.OnThrottle, policy.OnFailure} {
+		switch name {
+		case "", PolicyAckDrop, PolicyAckDefer, PolicyFailAck:
+		case PolicyBusyReply:
+			if policy.AppID == "" {
+				return fmt.Errorf("policy %s requires app_id", PolicyBusyReply)
+			}
+		default:
+			return fmt.Errorf("unknown policy %q", name)
+		}
+	}
+	if policy.MaxDeferrals != nil && *policy.MaxDeferrals < 0 {
+		return fmt.Errorf("max_deferrals must not be negative, got %d", *policy.MaxDeferrals)
+	}
+	return nil
+}
@@ -19,10 +19,13 @@ type QoSConfig struct {
 		AdjustmentInterval string  `yaml:"adjustment_interval"`
 	} `yaml:"system_limits"`
 
-	// Dynamic Load Balancing
+	// Dynamic Load Balancing: while a bot's recent latency exceeds load_threshold
+	// of its observed P95, its concurrency limit is scaled down by
+	// adjustment_factor every monitoring_interval, and back up once it recovers.
+	// Takes effect through adaptive_throttling's concurrency limit.
 	DynamicLoadBalancing struct {
 		Enabled            bool    `yaml:"enabled"`
-		LoadThreshold      float64 `yaml:"load_threshold"`
+		LoadThreshold      float64 `yaml:"load_threshold"` // Recent mean latency as a fraction of the bot's P95 (0.0 to 1.0); larger, millisecond values are ignored
 		AdjustmentFactor   float64 `yaml:"adjustment_factor"`
 		MonitoringInterval string  `yaml:"monitoring_interval"`
 	} `yaml:"dynamic_load_balancing"`
@@ -30,27 +33,34 @@ type QoSConfig struct {
 	// Adaptive Throttling
 	AdaptiveThrottling struct {
 		Enabled        bool    `yaml:"enabled"`
-		BaseInterval   int     `yaml:"base_interval"`
-		MaxInterval    int     `yaml:"max_interval"`
-		BaseThreshold  int     `yaml:"base_threshold"`
-		MaxThreshold   int     `yaml:"max_threshold"`
-		AdaptationRate float64 `yaml:"adaptation_rate"`
-		CooldownPeriod string  `yaml:"cooldown_period"`
+		Algorithm      string  `yaml:"algorithm"`     // Concurrency limit algorithm: gradient or aimd
+		InitialLimit   int     `yaml:"initial_limit"` // Concurrent requests allowed per bot before any latency is measured
+		MinLimit       int     `yaml:"min_limit"`
+		MaxLimit       int     `yaml:"max_limit"`
+		AdaptationRate float64 `yaml:"adaptation_rate"` // Smoothing applied to each limit change (0.0 to 1.0)
+		Tolerance      float64 `yaml:"tolerance"`       // gradient: latency growth over the baseline tolerated before backing off
+		BackoffRatio   float64 `yaml:"backoff_ratio"`   // aimd: factor applied to the limit on congestion
+		LatencyTarget  string  `yaml:"latency_target"`  // aimd: forward latency above which a sample counts as congestion
 	} `yaml:"adaptive_throttling"`
 
 	// Circuit Breaker
 	CircuitBreaker struct {
-		Enabled          bool   `yaml:"enabled"`
-		FailureThreshold int    `yaml:"failure_threshold"`
-		RecoveryTimeout  string `yaml:"recovery_timeout"`
-		HalfOpenRequests int    `yaml:"half_open_requests"`
+		Enabled          bool    `yaml:"enabled"`
+		FailureThreshold int     `yaml:"failure_threshold"` // Minimum failures in the window before the breaker may open
+		FailureRate      float64 `yaml:"failure_rate"`      // Failure rate (0.0 to 1.0) over the window that opens the breaker
+		Window           string  `yaml:"window"`            // Rolling window the failure rate is measured over
+		RecoveryTimeout  string  `yaml:"recovery_timeout"`
+		HalfOpenRequests int     `yaml:"half_open_requests"` // Trial requests admitted while half-open
+		AlertWebhook     string  `yaml:"alert_webhook"`      // Optional URL that receives state transitions as JSON
 	} `yaml:"circuit_breaker"`
 
-	// Performance Monitoring
+	// Performance Monitoring: samples counters and gauges into an in-process
+	// history, queryable on /admin/history
 	PerformanceMonitoring struct {
 		Enabled          bool   `yaml:"enabled"`
-		MetricsInterval  string `yaml:"metrics_interval"`
-		HistoryRetention string `yaml:"history_retention"`
+		MetricsInterval  string `yaml:"metrics_interval"`  // How often metrics are sampled
+		HistoryRetention string `yaml:"history_retention"` // How long samples are kept
+		Persist          bool   `yaml:"persist"`           // Save the history to the data directory across restarts
 	} `yaml:"performance_monitoring"`
 
 	// Hot Reload
@@ -59,6 +69,9 @@ type QoSConfig struct {
 		CheckInterval string `yaml:"check_interval"`
 	} `yaml:"hot_reload"`
 
+	// Rate Limits
+	RateLimits RateLimitConfig `yaml:"rate_limits"`
+
 	// Request Timeouts
 	RequestTimeouts struct {
 		ForwardTimeout    string `yaml:"forward_timeout"`
@@ -100,29 +113,38 @@ func GetDefaultQoSConfig() QoSConfig {
 		},
 		AdaptiveThrottling: struct {
 			Enabled        bool    `yaml:"enabled"`
-			BaseInterval   int     `yaml:"base_interval"`
-			MaxInterval    int     `yaml:"max_interval"`
-			BaseThreshold  int     `yaml:"base_threshold"`
-			MaxThreshold   int     `yaml:"max_threshold"`
+			Algorithm      string  `yaml:"algorithm"`
+			InitialLimit   int     `yaml:"initial_limit"`
+			MinLimit       int     `yaml:"min_limit"`
+			MaxLimit       int     `yaml:"max_limit"`
 			AdaptationRate float64 `yaml:"adaptation_rate"`
-			CooldownPeriod string  `yaml:"cooldown_period"`
+			Tolerance      float64 `yaml:"tolerance"`
+			BackoffRatio   float64 `yaml:"backoff_ratio"`
+			LatencyTarget  string  `yaml:"latency_target"`
 		}{
 			Enabled:        true,
-			BaseInterval:   100,
-			MaxInterval:    1000,
-			BaseThreshold:  100,
-			MaxThreshold:   1000,
-			AdaptationRate: 0.05,
-			CooldownPeriod: "5m",
+			Algorithm:      "gradient",
+			InitialLimit:   20,
+			MinLimit:       4,
+			MaxLimit:       200,
+			AdaptationRate: 0.2,
+			Tolerance:      1.5,
+			BackoffRatio:   0.9,
+			LatencyTarget:  "2s",
 		},
 		CircuitBreaker: struct {
-			Enabled          bool   `yaml:"enabled"`
-			FailureThreshold int    `yaml:"failure_threshold"`
-			RecoveryTimeout  string `yaml:"recovery_timeout"`
-			HalfOpenRequests int    `yaml:"half_open_requests"`
+			Enabled          bool    `yaml:"enabled"`
+			FailureThreshold int     `yaml:"failure_threshold"`
+			FailureRate      float64 `yaml:"failure_rate"`
+			Window           string  `yaml:"window"`
+			RecoveryTimeout  string  `yaml:"recovery_timeout"`
+			HalfOpenRequests int     `yaml:"half_open_requests"`
+			AlertWebhook     string  `yaml:"alert_webhook"`
 		}{
 			Enabled:          true,
 			FailureThreshold: 5,
+			FailureRate:      0.5,
+			Window:           "60s",
 			RecoveryTimeout:  "30s",
 			HalfOpenRequests: 3,
 		},
@@ -130,6 +152,7 @@ func GetDefaultQoSConfig() QoSConfig {
 			Enabled          bool   `yaml:"enabled"`
 			MetricsInterval  string `yaml:"metrics_interval"`
 			HistoryRetention string `yaml:"history_retention"`
+			Persist          bool   `yaml:"persist"`
 		}{
 			Enabled:          true,
 			MetricsInterval:  "10s",
@@ -151,9 +174,66 @@ func GetDefaultQoSConfig() QoSConfig {
 			ProcessingTimeout: "12s",
 			IdleCheckInterval: "10ms",
 		},
+		RateLimits: GetDefaultRateLimitConfig(),
+	}
+}
+
+// TokenBucketConfig is a token-bucket limit: Rate tokens per second with room
+// for Burst tokens. A zero rate disables the limit.
+type TokenBucketConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RateLimitScopes holds the limits applied to each scope of an event
+type RateLimitScopes struct {
+	User  TokenBucketConfig `yaml:"user"`
+	Group TokenBucketConfig `yaml:"group"` // Group openid, or guild channel for channel messages
+	Bot   TokenBucketConfig `yaml:"bot"`
+}
+
+// RateLimitConfig contains per-user, per-group and per-bot token-bucket limits
+type RateLimitConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxEntries int  `yaml:"max_entries"` // Maximum number of tracked buckets, least recently used are evicted
+
+	RateLimitScopes `yaml:",inline"`
+
+	// Classes overrides the limits for a priority class. A class listed here
+	// gets its own buckets, separate from the default limits.
+	Classes map[string]RateLimitScopes `yaml:"classes,omitempty"`
+}
+
+// GetDefaultRateLimitConfig returns default rate limiting configuration.
+// Rate limiting is off until enabled; the limits apply once it is.
+func GetDefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Enabled:    false,
+		MaxEntries: 10000,
+		RateLimitScopes: RateLimitScopes{
+			User:  TokenBucketConfig{Rate: 1, Burst: 5},
+			Group: TokenBucketConfig{Rate: 5, Burst: 20},
+			Bot:   TokenBucketConfig{Rate: 0, Burst: 0},
+		},
+		Classes: map[string]RateLimitScopes{
+			"admin": {},
+			"bulk": {
+				User:  TokenBucketConfig{Rate: 0.5, Burst: 3},
+				Group: TokenBucketConfig{Rate: 2, Burst: 10},
+			},
+		},
 	}
 }
 
+// ScopesForClass returns the limits for a priority class and whether the
+// class has its own override
+func (r *RateLimitConfig) ScopesForClass(class string) (RateLimitScopes, bool) {
+	if scopes, ok := r.Classes[class]; ok {
+		return scopes, true
+	}
+	return r.RateLimitScopes, false
+}
+
 // ParseDuration safely parses duration strings
 func (q *QoSConfig) ParseDuration(durationStr string) time.Duration {
 	duration, err := time.ParseDuration(durationStr)
@@ -162,3 +242,15 @@ func (q *QoSConfig) ParseDuration(durationStr string) time.Duration {
 	}
 	return duration
 }
+
+// ParseDurationOrDefault parses a duration string, returning fallback when it is empty or invalid
+func ParseDurationOrDefault(durationStr string, fallback time.Duration) time.Duration {
+	if durationStr == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return fallback
+	}
+	return duration
+}
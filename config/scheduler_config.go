@@ -5,6 +5,9 @@ type SchedulerConfig struct {
 	// Worker Pool
 	WorkerPoolSize int `yaml:"worker_pool_size"`
 
+	// Worker Autoscaling
+	WorkerAutoscaling WorkerAutoscalingConfig `yaml:"worker_autoscaling"`
+
 	// Priority Settings
 	PrioritySettings struct {
 		BasePriority       int `yaml:"base_priority"`
@@ -15,21 +18,39 @@ type SchedulerConfig struct {
 		FastUserBonus      int `yaml:"fast_user_bonus"`
 	} `yaml:"priority_settings"`
 
-	// Cognitive Scheduling
+	// Priority Strategy
+	PriorityStrategy PriorityStrategyConfig `yaml:"priority_strategy"`
+
+	// Priority Classes
+	PriorityClasses []PriorityClassConfig `yaml:"priority_classes"`
+
+	// Cognitive Scheduling: endpoint selection learned online by regex routes with selection: bandit
 	CognitiveScheduling struct {
-		Enabled             bool    `yaml:"enabled"`
-		LearningRate        float64 `yaml:"learning_rate"`
-		MemoryWindow        string  `yaml:"memory_window"`
-		AdaptationThreshold float64 `yaml:"adaptation_threshold"`
+		Enabled             bool    `yaml:"enabled"`              // When disabled, bandit routes select by hash
+		LearningRate        float64 `yaml:"learning_rate"`        // Smallest weight of each delivery in an endpoint's reward
+		MemoryWindow        string  `yaml:"memory_window"`        // Half-life of the delivery counts that limit exploration
+		AdaptationThreshold float64 `yaml:"adaptation_threshold"` // Score margin needed to switch to a different endpoint
 	} `yaml:"cognitive_scheduling"`
 
 	// Priority Queue
 	PriorityQueue struct {
-		MaxSize           int    `yaml:"max_size"`
+		MaxSize           int    `yaml:"max_size"` // Bounds the delay queue of deferred requests
 		ProcessingTimeout string `yaml:"processing_timeout"`
 		BatchSize         int    `yaml:"batch_size"`
 	} `yaml:"priority_queue"`
 
+	// Batch Delivery
+	BatchDelivery BatchDeliveryConfig `yaml:"batch_delivery"`
+
+	// Message Expiry
+	MessageExpiry MessageExpiryConfig `yaml:"message_expiry"`
+
+	// Load Shedding
+	LoadShedding LoadSheddingConfig `yaml:"load_shedding"`
+
+	// Shutdown
+	Shutdown ShutdownConfig `yaml:"shutdown"`
+
 	// User Behavior Analysis
 	UserBehaviorAnalysis struct {
 		Enabled                  bool   `yaml:"enabled"`
@@ -43,14 +64,115 @@ type SchedulerConfig struct {
 		Enabled          bool     `yaml:"enabled"`
 		SpamDetection    bool     `yaml:"spam_detection"`
 		PriorityKeywords []string `yaml:"priority_keywords"`
-		SpamKeywords     []string `yaml:"spam_keywords"`
+		SpamKeywords     []string `yaml:"spam_keywords"`  // Used until a trained spam model is loaded
+		SpamThreshold    float64  `yaml:"spam_threshold"` // Spam score that takes the full spam penalty
 	} `yaml:"message_classification"`
 }
 
+// PriorityStrategyConfig selects the scheduler's priority strategy and its parameters
+type PriorityStrategyConfig struct {
+	Name          string              `yaml:"name"` // "hybrid", "load", "content" or "expression"
+	LoadWeight    float64             `yaml:"load_weight"`
+	ContentWeight float64             `yaml:"content_weight"`
+	Rules         []string            `yaml:"rules"`       // Used by the expression strategy
+	UserGroups    map[string][]string `yaml:"user_groups"` // Named user lists for user.in("group")
+}
+
+// PriorityClassConfig defines a named band of priorities with reserved worker capacity
+type PriorityClassConfig struct {
+	Name           string  `yaml:"name"`
+	MinPriority    int     `yaml:"min_priority"`
+	MaxPriority    int     `yaml:"max_priority"`
+	ReservedShare  float64 `yaml:"reserved_share"`  // Fraction of workers held for this class
+	MaxShare       float64 `yaml:"max_share"`       // Cap on the fraction of workers this class may use, 0 = no cap
+	ThrottleExempt bool    `yaml:"throttle_exempt"` // Bypass adaptive throttling for events an "=N" priority rule placed in this class
+}
+
+// DefaultPriorityClass is used for priorities not covered by any configured class
+const DefaultPriorityClass = "default"
+
+// ClassForPriority returns the name of the first priority class covering the given priority
+func (c *SchedulerConfig) ClassForPriority(priority int) string {
+	if class, ok := c.PriorityClass(priority); ok {
+		return class.Name
+	}
+	return DefaultPriorityClass
+}
+
+// PriorityClass returns the first priority class covering the given priority
+func (c *SchedulerConfig) PriorityClass(priority int) (PriorityClassConfig, bool) {
+	for _, class := range c.PriorityClasses {
+		if priority >= class.MinPriority && priority <= class.MaxPriority {
+			return class, true
+		}
+	}
+	return PriorityClassConfig{}, false
+}
+
+// WorkerAutoscalingConfig controls automatic resizing of the worker pool
+type WorkerAutoscalingConfig struct {
+	Enabled           bool   `yaml:"enabled"`
+	MinWorkers        int    `yaml:"min_workers"`
+	MaxWorkers        int    `yaml:"max_workers"`
+	ScaleUpQueueDepth int    `yaml:"scale_up_queue_depth"`
+	ScaleStep         int    `yaml:"scale_step"`
+	LatencyTarget     string `yaml:"latency_target"`
+	CheckInterval     string `yaml:"check_interval"`
+}
+
+// BatchDeliveryConfig controls grouping of events into a single POST for opted-in destinations
+type BatchDeliveryConfig struct {
+	Enabled      bool                              `yaml:"enabled"`
+	Linger       string                            `yaml:"linger"`
+	Format       string                            `yaml:"format"` // "ndjson" or "json_array"
+	Destinations map[string]BatchDestinationConfig `yaml:"destinations"`
+}
+
+// BatchDestinationConfig overrides batch settings for a single destination URL
+type BatchDestinationConfig struct {
+	BatchSize int    `yaml:"batch_size,omitempty"` // Defaults to priority_queue.batch_size
+	Linger    string `yaml:"linger,omitempty"`
+	Format    string `yaml:"format,omitempty"`
+}
+
+// MessageExpiryConfig controls dropping of events whose passive-reply window has passed
+type MessageExpiryConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	DefaultWindow string            `yaml:"default_window"`
+	EventWindows  map[string]string `yaml:"event_windows"`
+	SafetyMargin  string            `yaml:"safety_margin"`
+	Action        string            `yaml:"action"` // "drop" or "late"
+}
+
+// LoadSheddingConfig controls CoDel-style shedding driven by queue delay
+type LoadSheddingConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Target      string `yaml:"target"`       // Acceptable standing queue delay
+	Interval    string `yaml:"interval"`     // How long delay must stay above target before shedding starts
+	Action      string `yaml:"action"`       // "drop" or "defer"
+	DeferDelay  string `yaml:"defer_delay"`  // How long deferred requests are held before re-queueing
+	MaxPriority int    `yaml:"max_priority"` // Only requests at or below this priority are shed
+}
+
+// ShutdownConfig controls how the queue is drained and persisted on shutdown
+type ShutdownConfig struct {
+	DrainTimeout string `yaml:"drain_timeout"`
+	PersistQueue bool   `yaml:"persist_queue"`
+}
+
 // GetDefaultSchedulerConfig returns default scheduler configuration
 func GetDefaultSchedulerConfig() SchedulerConfig {
 	return SchedulerConfig{
 		WorkerPoolSize: 10,
+		WorkerAutoscaling: WorkerAutoscalingConfig{
+			Enabled:           false,
+			MinWorkers:        2,
+			MaxWorkers:        50,
+			ScaleUpQueueDepth: 20,
+			ScaleStep:         2,
+			LatencyTarget:     "2s",
+			CheckInterval:     "5s",
+		},
 		PrioritySettings: struct {
 			BasePriority       int `yaml:"base_priority"`
 			MinPriority        int `yaml:"min_priority"`
@@ -66,6 +188,16 @@ func GetDefaultSchedulerConfig() SchedulerConfig {
 			LowLoadAdjustment:  1,
 			FastUserBonus:      2,
 		},
+		PriorityStrategy: PriorityStrategyConfig{
+			Name:          "hybrid",
+			LoadWeight:    0.6,
+			ContentWeight: 0.4,
+		},
+		PriorityClasses: []PriorityClassConfig{
+			{Name: "admin", MinPriority: 10, MaxPriority: 10, ReservedShare: 0.2, ThrottleExempt: true},
+			{Name: "interactive", MinPriority: 6, MaxPriority: 9, ReservedShare: 0.3},
+			{Name: "bulk", MinPriority: 1, MaxPriority: 5, MaxShare: 0.5},
+		},
 		CognitiveScheduling: struct {
 			Enabled             bool    `yaml:"enabled"`
 			LearningRate        float64 `yaml:"learning_rate"`
@@ -86,6 +218,38 @@ func GetDefaultSchedulerConfig() SchedulerConfig {
 			ProcessingTimeout: "30s",
 			BatchSize:         10,
 		},
+		BatchDelivery: BatchDeliveryConfig{
+			Enabled:      false,
+			Linger:       "500ms",
+			Format:       "ndjson",
+			Destinations: map[string]BatchDestinationConfig{},
+		},
+		MessageExpiry: MessageExpiryConfig{
+			Enabled:       true,
+			DefaultWindow: "5m",
+			EventWindows: map[string]string{
+				"GROUP_AT_MESSAGE_CREATE": "5m",
+				"C2C_MESSAGE_CREATE":      "5m",
+				"AT_MESSAGE_CREATE":       "5m",
+				"DIRECT_MESSAGE_CREATE":   "5m",
+				"MESSAGE_CREATE":          "5m",
+				"INTERACTION_CREATE":      "5m",
+			},
+			SafetyMargin: "15s",
+			Action:       "drop",
+		},
+		LoadShedding: LoadSheddingConfig{
+			Enabled:     false,
+			Target:      "500ms",
+			Interval:    "2s",
+			Action:      "drop",
+			DeferDelay:  "5s",
+			MaxPriority: 5,
+		},
+		Shutdown: ShutdownConfig{
+			DrainTimeout: "20s",
+			PersistQueue: true,
+		},
 		UserBehaviorAnalysis: struct {
 			Enabled                  bool   `yaml:"enabled"`
 			AnalysisWindow           string `yaml:"analysis_window"`
@@ -102,9 +266,11 @@ func GetDefaultSchedulerConfig() SchedulerConfig {
 			SpamDetection    bool     `yaml:"spam_detection"`
 			PriorityKeywords []string `yaml:"priority_keywords"`
 			SpamKeywords     []string `yaml:"spam_keywords"`
+			SpamThreshold    float64  `yaml:"spam_threshold"`
 		}{
 			Enabled:          true,
 			SpamDetection:    true,
+			SpamThreshold:    0.9,
 			PriorityKeywords: []string{"紧急", "重要", "帮助", "问题", "错误", "urgent", "important", "help", "error", "issue"},
 			SpamKeywords:     []string{"重复", "刷屏", "广告", "推广", "spam", "advertisement", "promotion"},
 		},
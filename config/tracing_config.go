@@ -0,0 +1,74 @@
+package config
+
+import "fmt"
+
+// Trace exporters
+const (
+	TraceExporterOTLP = "otlp" // OTLP/HTTP with JSON encoding
+	TraceExporterFile = "file" // One JSON span per line in a local file
+)
+
+// TracingConfig controls per-event tracing and where finished spans are sent
+type TracingConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Exporter      string            `yaml:"exporter"`          // otlp or file
+	Endpoint      string            `yaml:"endpoint"`          // OTLP/HTTP traces URL
+	Headers       map[string]string `yaml:"headers,omitempty"` // Extra headers for the OTLP endpoint, e.g. authorization
+	File          string            `yaml:"file,omitempty"`    // Output of the file exporter; defaults to traces.jsonl in the data dir
+	ServiceName   string            `yaml:"service_name"`
+	SampleRatio   float64           `yaml:"sample_ratio"` // Share of new traces recorded (0.0 to 1.0)
+	BatchSize     int               `yaml:"batch_size"`   // Spans buffered before an export is forced
+	FlushInterval string            `yaml:"flush_interval"`
+}
+
+// GetDefaultTracingConfig returns default tracing configuration
+func GetDefaultTracingConfig() TracingConfig {
+	return TracingConfig{
+		Enabled:       false,
+		Exporter:      TraceExporterFile,
+		Endpoint:      "http://localhost:4318/v1/traces",
+		ServiceName:   "qqbotrouter",
+		SampleRatio:   1.0,
+		BatchSize:     256,
+		FlushInterval: "5s",
+	}
+}
+
+// setDefaults fills unset tracing fields, keeping the ones that were configured
+func (t *TracingConfig) setDefaults() {
+	defaults := GetDefaultTracingConfig()
+	if t.Exporter == "" {
+		t.Exporter = defaults.Exporter
+	}
+	if t.Endpoint == "" {
+		t.Endpoint = defaults.Endpoint
+	}
+	if t.ServiceName == "" {
+		t.ServiceName = defaults.ServiceName
+	}
+	if t.SampleRatio == 0 {
+		t.SampleRatio = defaults.SampleRatio
+	}
+	if t.BatchSize == 0 {
+		t.BatchSize = defaults.BatchSize
+	}
+	if t.FlushInterval == "" {
+		t.FlushInterval = defaults.FlushInterval
+	}
+}
+
+// validateTracing checks the exporter and sample ratio
+func validateTracing(t TracingConfig) error {
+	if !t.Enabled {
+		return nil
+	}
+	switch t.Exporter {
+	case TraceExporterOTLP, TraceExporterFile:
+	default:
+		return fmt.Errorf("unknown trace exporter %q", t.Exporter)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("trace sample_ratio must be between 0 and 1, got %g", t.SampleRatio)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package forwarder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/interfaces"
+)
+
+// Batch body formats
+const (
+	BatchFormatNDJSON    = "ndjson"
+	BatchFormatJSONArray = "json_array"
+)
+
+// maxBatchResponseSize bounds how much of a batch response is read for per-item results
+const maxBatchResponseSize = 1 << 20
+
+// batchItemResponse is one entry of a per-item batch response
+type batchItemResponse struct {
+	Success *bool  `json:"success"`
+	Status  int    `json:"status"`
+	Error   string `json:"error"`
+}
+
+// EncodeBatch encodes event bodies as a single NDJSON or JSON-array payload and returns it with its content type
+func EncodeBatch(bodies [][]byte, format string) ([]byte, string) {
+	var buf bytes.Buffer
+
+	if format == BatchFormatJSONArray {
+		buf.WriteByte('[')
+		for i, body := range bodies {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONValue(&buf, body)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), "application/json"
+	}
+
+	for _, body := range bodies {
+		writeJSONValue(&buf, body)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), "application/x-ndjson"
+}
+
+// writeJSONValue writes body compacted onto one line, or as a JSON string if it is not valid JSON
+func writeJSONValue(buf *bytes.Buffer, body []byte) {
+	if err := json.Compact(buf, body); err != nil {
+		encoded, _ := json.Marshal(string(body))
+		buf.Write(encoded)
+	}
+}
+
+// ForwardBatch posts several events to one destination in a single request and
+// returns one result per item. If the destination answers with a JSON array
+// (or NDJSON lines, or {"results": [...]}) holding one entry per item, each
+// entry decides that item's result; otherwise the HTTP status applies to all.
+func ForwardBatch(ctx context.Context, logger *zap.Logger, destination string, bodies [][]byte, format string, loadProvider interfaces.LoadProvider, forwardTimeout time.Duration) []ForwardResult {
+	loadProvider.Increment()
+	defer loadProvider.Decrement()
+
+	start := time.Now()
+	results := make([]ForwardResult, len(bodies))
+	fail := func(statusCode int, err error) []ForwardResult {
+		for i := range results {
+			results[i] = ForwardResult{Destination: destination, Success: false, StatusCode: statusCode, Error: err, Latency: time.Since(start)}
+		}
+		return results
+	}
+
+	payload, contentType := EncodeBatch(bodies, format)
+	req, err := http.NewRequestWithContext(ctx, "POST", destination, bytes.NewReader(payload))
+	if err != nil {
+		logger.Error("Failed to create batch request",
+			zap.String("destination", destination),
+			zap.Error(err))
+		return fail(0, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Batch-Size", strconv.Itoa(len(bodies)))
+
+	client := &http.Client{Timeout: forwardTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Debug("Failed to forward batch",
+			zap.String("destination", destination),
+			zap.Int("batch_size", len(bodies)),
+			zap.Error(err))
+		return fail(0, err)
+	}
+	defer resp.Body.Close()
+
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !success {
+		logger.Warn("Batch request returned error status",
+			zap.String("destination", destination),
+			zap.Int("batch_size", len(bodies)),
+			zap.Int("status_code", resp.StatusCode))
+		return fail(resp.StatusCode, fmt.Errorf("batch rejected with status %d", resp.StatusCode))
+	}
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxBatchResponseSize))
+	itemResponses := parseBatchResponse(responseBody)
+	perItem := len(itemResponses) == len(bodies)
+
+	latency := time.Since(start)
+	failed := 0
+	for i := range results {
+		results[i] = ForwardResult{Destination: destination, Success: true, StatusCode: resp.StatusCode, Latency: latency}
+		if !perItem {
+			continue
+		}
+		item := itemResponses[i]
+		if item.Status != 0 {
+			results[i].StatusCode = item.Status
+			results[i].Success = item.Status >= 200 && item.Status < 300
+		}
+		if item.Success != nil {
+			results[i].Success = *item.Success
+		}
+		if !results[i].Success {
+			failed++
+			if item.Error != "" {
+				results[i].Error = fmt.Errorf("%s", item.Error)
+			}
+		}
+	}
+
+	logger.Info("Forwarded batch",
+		zap.String("destination", destination),
+		zap.Int("batch_size", len(bodies)),
+		zap.Int("status_code", resp.StatusCode),
+		zap.Bool("per_item_results", perItem),
+		zap.Int("failed_items", failed))
+	return results
+}
+
+// parseBatchResponse extracts per-item entries from a batch response body
+func parseBatchResponse(body []byte) []batchItemResponse {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	var raw []json.RawMessage
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil
+		}
+	} else {
+		var wrapped struct {
+			Results []json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal(body, &wrapped); err == nil && wrapped.Results != nil {
+			raw = wrapped.Results
+		} else {
+			scanner := bufio.NewScanner(bytes.NewReader(body))
+			for scanner.Scan() {
+				if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+					raw = append(raw, append(json.RawMessage(nil), line...))
+				}
+			}
+		}
+	}
+
+	items := make([]batchItemResponse, 0, len(raw))
+	for _, entry := range raw {
+		var item batchItemResponse
+		var flag bool
+		var status int
+		switch {
+		case json.Unmarshal(entry, &flag) == nil:
+			item.Success = &flag
+		case json.Unmarshal(entry, &status) == nil:
+			item.Status = status
+		case json.Unmarshal(entry, &item) == nil:
+		default:
+			return nil
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,201 @@
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testLoad is a load counter for tests
+type testLoad struct{ n int64 }
+
+func (l *testLoad) Get() int64 { return atomic.LoadInt64(&l.n) }
+func (l *testLoad) Increment() { atomic.AddInt64(&l.n, 1) }
+func (l *testLoad) Decrement() { atomic.AddInt64(&l.n, -1) }
+
+// item builds an expected batch item response
+func item(success *bool, status int, errText string) batchItemResponse {
+	return batchItemResponse{Success: success, Status: status, Error: errText}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestParseBatchResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []batchItemResponse
+	}{
+		{name: "empty", body: "", want: nil},
+		{name: "whitespace", body: " \n\t", want: nil},
+
+		{
+			name: "array of booleans",
+			body: `[true, false, true]`,
+			want: []batchItemResponse{item(boolPtr(true), 0, ""), item(boolPtr(false), 0, ""), item(boolPtr(true), 0, "")},
+		},
+		{
+			name: "array of status codes",
+			body: `[200, 503]`,
+			want: []batchItemResponse{item(nil, 200, ""), item(nil, 503, "")},
+		},
+		{
+			name: "array of objects",
+			body: `[{"success": true}, {"status": 429, "error": "slow down"}, {"success": false, "status": 200}]`,
+			want: []batchItemResponse{item(boolPtr(true), 0, ""), item(nil, 429, "slow down"), item(boolPtr(false), 200, "")},
+		},
+		{
+			name: "mixed array",
+			body: `[true, 500, {"error": "bad"}]`,
+			want: []batchItemResponse{item(boolPtr(true), 0, ""), item(nil, 500, ""), item(nil, 0, "bad")},
+		},
+		{name: "array with unusable entry", body: `[true, "ok"]`, want: nil},
+		{name: "malformed array", body: `[true, false`, want: nil},
+
+		{
+			name: "ndjson",
+			body: "{\"success\": true}\n\n{\"status\": 502}\r\nfalse\n",
+			want: []batchItemResponse{item(boolPtr(true), 0, ""), item(nil, 502, ""), item(boolPtr(false), 0, "")},
+		},
+		{
+			name: "single ndjson line",
+			body: `{"success": false, "error": "rejected"}`,
+			want: []batchItemResponse{item(boolPtr(false), 0, "rejected")},
+		},
+		{name: "ndjson with unusable line", body: "true\nnot json\n", want: nil},
+
+		{
+			name: "results wrapper",
+			body: `{"results": [true, {"status": 404, "error": "no such bot"}]}`,
+			want: []batchItemResponse{item(boolPtr(true), 0, ""), item(nil, 404, "no such bot")},
+		},
+		{name: "empty results wrapper", body: `{"results": []}`, want: []batchItemResponse{}},
+		{name: "plain text", body: "OK", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseBatchResponse([]byte(tt.body))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBatchResponse(%q) = %s, want %s", tt.body, describeItems(got), describeItems(tt.want))
+			}
+		})
+	}
+}
+
+// describeItems renders item responses with their pointers dereferenced
+func describeItems(items []batchItemResponse) string {
+	if items == nil {
+		return "nil"
+	}
+	parts := make([]string, len(items))
+	for i, it := range items {
+		success := "unset"
+		if it.Success != nil {
+			success = strconv.FormatBool(*it.Success)
+		}
+		parts[i] = fmt.Sprintf("{success:%s status:%d error:%q}", success, it.Status, it.Error)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestEncodeBatch(t *testing.T) {
+	bodies := [][]byte{[]byte(`{"a": 1}`), []byte("not json")}
+	tests := []struct {
+		format      string
+		want        string
+		contentType string
+	}{
+		{format: BatchFormatJSONArray, want: `[{"a":1},"not json"]`, contentType: "application/json"},
+		{format: BatchFormatNDJSON, want: "{\"a\":1}\n\"not json\"\n", contentType: "application/x-ndjson"},
+		{format: "", want: "{\"a\":1}\n\"not json\"\n", contentType: "application/x-ndjson"},
+	}
+	for _, tt := range tests {
+		payload, contentType := EncodeBatch(bodies, tt.format)
+		if string(payload) != tt.want || contentType != tt.contentType {
+			t.Errorf("EncodeBatch(%q) = %q, %q; want %q, %q", tt.format, payload, contentType, tt.want, tt.contentType)
+		}
+	}
+}
+
+func TestForwardBatchResults(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		response    string
+		items       int
+		wantSuccess []bool
+		wantStatus  []int
+	}{
+		{
+			name: "per-item array", status: http.StatusOK, response: `[true, false, 503]`, items: 3,
+			wantSuccess: []bool{true, false, false}, wantStatus: []int{200, 200, 503},
+		},
+		{
+			name: "per-item ndjson", status: http.StatusOK, response: "{\"status\":201}\n{\"success\":false}\n", items: 2,
+			wantSuccess: []bool{true, false}, wantStatus: []int{201, 200},
+		},
+		{
+			name: "per-item results wrapper", status: http.StatusMultiStatus, response: `{"results":[{"status":500},true]}`, items: 2,
+			wantSuccess: []bool{false, true}, wantStatus: []int{500, 207},
+		},
+		{
+			name: "entry count mismatch applies status to all", status: http.StatusOK, response: `[false]`, items: 2,
+			wantSuccess: []bool{true, true}, wantStatus: []int{200, 200},
+		},
+		{
+			name: "no body applies status to all", status: http.StatusNoContent, items: 2,
+			wantSuccess: []bool{true, true}, wantStatus: []int{204, 204},
+		},
+		{
+			name: "error status fails every item", status: http.StatusBadGateway, response: `[true, true]`, items: 2,
+			wantSuccess: []bool{false, false}, wantStatus: []int{502, 502},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSize string
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				gotSize = r.Header.Get("X-Batch-Size")
+				io.Copy(io.Discard, r.Body)
+				rw.WriteHeader(tt.status)
+				io.WriteString(rw, tt.response)
+			}))
+			defer server.Close()
+
+			bodies := make([][]byte, tt.items)
+			for i := range bodies {
+				bodies[i] = []byte(`{"id":1}`)
+			}
+			load := &testLoad{}
+			results := ForwardBatch(context.Background(), zap.NewNop(), server.URL, bodies, BatchFormatJSONArray, load, 5*time.Second)
+
+			if len(results) != tt.items {
+				t.Fatalf("got %d results, want %d", len(results), tt.items)
+			}
+			for i, result := range results {
+				if result.Success != tt.wantSuccess[i] || result.StatusCode != tt.wantStatus[i] {
+					t.Errorf("item %d: success %v status %d, want %v %d",
+						i, result.Success, result.StatusCode, tt.wantSuccess[i], tt.wantStatus[i])
+				}
+			}
+			if gotSize != strconv.Itoa(tt.items) {
+				t.Errorf("X-Batch-Size = %q, want %d", gotSize, tt.items)
+			}
+			if load.Get() != 0 {
+				t.Errorf("load counter left at %d", load.Get())
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"go.uber.org/zap"
 
 	"qqbotrouter/interfaces"
+	"qqbotrouter/tracing"
 )
 
 // ForwardResult represents the result of a forward operation
@@ -18,6 +19,7 @@ type ForwardResult struct {
 	Success     bool
 	StatusCode  int
 	Error       error
+	Latency     time.Duration // Time from sending the request to its response or failure
 }
 
 // sendResult safely sends a result to the channel or handles context cancellation
@@ -33,12 +35,19 @@ func ForwardRequestWithResult(ctx context.Context, logger *zap.Logger, destinati
 	loadProvider.Increment()
 	defer loadProvider.Decrement()
 
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "forward",
+		tracing.WithKind(tracing.KindClient),
+		tracing.WithAttributes(tracing.String("url.full", destination)))
+	defer span.End()
+
 	defer func() {
 		if r := recover(); r != nil {
 			logger.Error("Panic in ForwardRequestWithResult",
 				zap.String("destination", destination),
 				zap.Any("panic", r))
-			sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: nil})
+			span.SetStatus(tracing.StatusError, "panic while forwarding")
+			sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: nil, Latency: time.Since(start)})
 		}
 	}()
 
@@ -47,10 +56,13 @@ func ForwardRequestWithResult(ctx context.Context, logger *zap.Logger, destinati
 		logger.Error("Failed to create forward request",
 			zap.String("destination", destination),
 			zap.Error(err))
-		sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: err})
+		span.RecordError(err)
+		sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: err, Latency: time.Since(start)})
 		return
 	}
 	req.Header = header.Clone()
+	// Downstream services continue the trace from this forward
+	tracing.Inject(span.SpanContext(), req.Header)
 
 	client := &http.Client{Timeout: forwardTimeout}
 	resp, err := client.Do(req)
@@ -58,11 +70,14 @@ func ForwardRequestWithResult(ctx context.Context, logger *zap.Logger, destinati
 		logger.Debug("Failed to forward request",
 			zap.String("destination", destination),
 			zap.Error(err))
-		sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: err})
+		span.RecordError(err)
+		sendResult(ctx, resultChan, ForwardResult{Destination: destination, Success: false, Error: err, Latency: time.Since(start)})
 		return
 	}
 	defer resp.Body.Close()
 
+	span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+
 	success := resp.StatusCode >= 200 && resp.StatusCode < 300
 	if success {
 		logger.Info("Successfully forwarded request",
@@ -72,6 +87,7 @@ func ForwardRequestWithResult(ctx context.Context, logger *zap.Logger, destinati
 		logger.Warn("Forward request returned error status",
 			zap.String("destination", destination),
 			zap.Int("status_code", resp.StatusCode))
+		span.SetStatus(tracing.StatusError, http.StatusText(resp.StatusCode))
 	}
 
 	sendResult(ctx, resultChan, ForwardResult{
@@ -79,6 +95,7 @@ func ForwardRequestWithResult(ctx context.Context, logger *zap.Logger, destinati
 		Success:     success,
 		StatusCode:  resp.StatusCode,
 		Error:       nil,
+		Latency:     time.Since(start),
 	})
 }
 
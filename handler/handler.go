@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -9,9 +10,14 @@ import (
 
 	"go.uber.org/zap"
 
+	"qqbotrouter/access"
 	"qqbotrouter/config"
+	"qqbotrouter/interfaces"
+	"qqbotrouter/openapi"
 	"qqbotrouter/qos"
+	"qqbotrouter/ratelimit"
 	"qqbotrouter/scheduler"
+	"qqbotrouter/tracing"
 	"qqbotrouter/utils"
 )
 
@@ -21,6 +27,12 @@ type WebhookHandler struct {
 	logger     *zap.Logger
 	scheduler  *scheduler.Scheduler
 	qosManager *qos.QoSManager
+
+	openapi     *openapi.Client    // Sends busy replies
+	busyReplies *ratelimit.Limiter // Limits busy replies per user
+	accessLists *access.Store      // Allow and block lists; nil disables them
+	stats       interfaces.StatProvider
+	metrics     handlerMetrics
 }
 
 // writeJSONResponse writes a JSON response with the given status code and payload
@@ -46,30 +58,58 @@ func (h *WebhookHandler) writeErrorResponse(rw http.ResponseWriter, statusCode i
 // NewWebhookHandler creates a new WebhookHandler.
 func NewWebhookHandler(cfg *config.Config, logger *zap.Logger, scheduler *scheduler.Scheduler, qosManager *qos.QoSManager) *WebhookHandler {
 	return &WebhookHandler{
-		config:     cfg,
-		logger:     logger,
-		scheduler:  scheduler,
-		qosManager: qosManager,
+		config:      cfg,
+		logger:      logger,
+		scheduler:   scheduler,
+		qosManager:  qosManager,
+		openapi:     openapi.NewClient(10 * time.Second),
+		busyReplies: ratelimit.NewLimiter(10000),
+		metrics:     newHandlerMetrics(),
+	}
+}
+
+// SetAccessLists sets the allow and block lists checked before events are scheduled
+func (h *WebhookHandler) SetAccessLists(store *access.Store) {
+	h.accessLists = store
+}
+
+// SetStats sets the statistics fed with event arrivals and delivery outcomes
+func (h *WebhookHandler) SetStats(stats interfaces.StatProvider) {
+	h.stats = stats
+}
+
+// checkAccessLists matches an event's sender and conversation against the allow and block lists
+func (h *WebhookHandler) checkAccessLists(botID string, msgInfo utils.MessageInfo) access.Decision {
+	if h.accessLists == nil {
+		return access.Decision{}
 	}
+	return h.accessLists.Check(access.Subject{
+		BotID:     botID,
+		UserID:    msgInfo.UserID,
+		GroupID:   msgInfo.GroupID,
+		GuildID:   msgInfo.GuildID,
+		ChannelID: msgInfo.ChannelID,
+	}, time.Now())
 }
 
-// getBotConfigFromRequest returns the bot configuration for a given host and path
-func (h *WebhookHandler) getBotConfigFromRequest(host, path string) (config.BotConfig, bool) {
+// getBotConfigFromRequest returns the bot ID (its configured webhook URL) and
+// configuration for a given host and path
+func (h *WebhookHandler) getBotConfigFromRequest(host, path string) (string, config.BotConfig, bool) {
 	// Construct the webhook URL from host and path
 	webhookURL := host + path
 
 	// Try exact match first
 	if botConfig, exists := h.config.Bots[webhookURL]; exists {
-		return botConfig, true
+		return webhookURL, botConfig, true
 	}
 
 	// Try with https:// prefix
 	httpsURL := "https://" + webhookURL
 	if botConfig, exists := h.config.Bots[httpsURL]; exists {
-		return botConfig, true
+		return httpsURL, botConfig, true
 	}
 
-	return config.BotConfig{}, false
+	return "", config.BotConfig{}, false
 }
 
 // ServeHTTP implements the http.Handler interface.
@@ -83,17 +123,40 @@ func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// Restore the body so it can be read again later
 	r.Body = io.NopCloser(bytes.NewReader(body))
 
+	// Every webhook is the root of a trace unless the caller sent a traceparent
+	ctx := r.Context()
+	if parent, ok := tracing.Extract(r.Header); ok {
+		ctx = tracing.ContextWithRemoteParent(ctx, parent)
+	}
+	ctx, span := tracing.Start(ctx, "webhook",
+		tracing.WithKind(tracing.KindServer),
+		tracing.WithAttributes(
+			tracing.String("server.address", r.Host),
+			tracing.String("url.path", r.URL.Path),
+		))
+	defer span.End()
+
 	// 2. Get bot configuration for the requested host and path
-	bot, ok := h.getBotConfigFromRequest(r.Host, r.URL.Path)
+	botID, bot, ok := h.getBotConfigFromRequest(r.Host, r.URL.Path)
 	if !ok {
+		h.metrics.rejected.With("", rejectUnknownBot).Inc()
+		span.SetStatus(tracing.StatusError, "unknown bot")
 		h.writeErrorResponse(rw, http.StatusUnauthorized, "Unauthorized",
 			zap.String("host", r.Host),
 			zap.String("path", r.URL.Path))
 		return
 	}
 
+	span.SetAttributes(tracing.String("bot.id", botID))
+
 	// 3. Verify the signature (mandatory for all requests)
-	if !VerifySignature(h.logger, r.Header, body, bot.Secret) {
+	_, verifySpan := tracing.Start(ctx, "verify_signature")
+	verified := VerifySignature(h.logger, r.Header, body, bot.Secret)
+	verifySpan.SetAttributes(tracing.Bool("signature.valid", verified))
+	verifySpan.End()
+	if !verified {
+		h.metrics.rejected.With(botID, rejectBadSignature).Inc()
+		span.SetStatus(tracing.StatusError, "signature verification failed")
 		h.writeErrorResponse(rw, http.StatusUnauthorized, "Unauthorized",
 			zap.String("host", r.Host),
 			zap.String("path", r.URL.Path),
@@ -104,10 +167,18 @@ func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// 4. Parse the packet to determine the operation
 	var packet WebhookPacket
 	if err := json.Unmarshal(body, &packet); err != nil {
+		h.metrics.rejected.With(botID, rejectBadRequest).Inc()
+		span.RecordError(err)
 		h.writeErrorResponse(rw, http.StatusBadRequest, "Bad Request", zap.Error(err))
 		return
 	}
 
+	h.metrics.requests.With(botID, opName(packet.Op), packet.T).Inc()
+	span.SetAttributes(
+		tracing.String("qq.op", opName(packet.Op)),
+		tracing.String("qq.event_type", packet.T),
+	)
+
 	// 5. Handle the request based on the operation code
 	switch packet.Op {
 	case OpLegacyChallenge, OpCallbackValidation:
@@ -116,7 +187,6 @@ func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			zap.String("path", r.URL.Path))
 		HandleChallenge(h.logger, rw, r, packet.D, bot.Secret)
 	case OpEventDispatch:
-		startTime := time.Now()
 		h.logger.Info("Handling event dispatch",
 			zap.String("host", r.Host),
 			zap.String("path", r.URL.Path),
@@ -124,27 +194,88 @@ func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 		// Extract user information for QoS analysis
 		msgInfo := utils.ExtractMessageInfo(body)
+		span.SetAttributes(
+			tracing.String("qq.user_id", msgInfo.UserID),
+			tracing.String("qq.message_id", msgInfo.MessageID),
+		)
 
-		// Calculate priority based on message content and user behavior
-		var spamKeywords, priorityKeywords []string
-		if h.config.Scheduler.MessageClassification.Enabled {
-			spamKeywords = h.config.Scheduler.MessageClassification.SpamKeywords
-			priorityKeywords = h.config.Scheduler.MessageClassification.PriorityKeywords
+		// Blocked senders and conversations are acknowledged and dropped so the
+		// platform does not redeliver; allowlisted ones bypass throttling
+		listed := h.checkAccessLists(botID, msgInfo)
+		if listed.Verdict == access.Blocked {
+			span.SetAttributes(tracing.String("access.verdict", "blocked"))
+			h.logger.Info("Dropping event from blocked subject",
+				zap.String("user_id", msgInfo.UserID),
+				zap.String("kind", listed.Entry.Kind),
+				zap.String("id", listed.Entry.ID),
+				zap.String("reason", listed.Entry.Reason))
+			h.writeJSONResponse(rw, http.StatusOK, GenDispatchACK(true))
+			return
+		}
+
+		if h.stats != nil {
+			h.stats.RecordArrival(msgInfo.UserID, time.Now())
 		}
-		priority := utils.CalculateMessagePriority(msgInfo.UserID, msgInfo.Message, spamKeywords, priorityKeywords)
 
-		// Check if request should be throttled
-		if h.qosManager.ShouldThrottle(msgInfo.UserID, priority) {
+		// Calculate priority once; the same decision drives throttling and scheduling
+		_, prioritySpan := tracing.Start(ctx, "priority")
+		decision := h.scheduler.Prioritize(botID, msgInfo)
+		priority := decision.Priority
+		prioritySpan.SetAttributes(
+			tracing.Int("priority", priority),
+			tracing.String("priority.class", decision.Class),
+		)
+		prioritySpan.End()
+		h.logger.Debug("Calculated message priority",
+			zap.String("user_id", msgInfo.UserID),
+			zap.Int("priority", priority),
+			zap.String("class", decision.Class),
+			zap.Any("stages", decision.Stages))
+
+		// Delivery is detached from the request context, which ends when
+		// ServeHTTP returns, and bounded by the event's reply deadline instead
+		ev := &dispatchEvent{
+			ctx:         context.WithoutCancel(ctx),
+			body:        body,
+			header:      r.Header,
+			botID:       botID,
+			bot:         bot,
+			decision:    decision,
+			info:        msgInfo,
+			policy:      bot.EffectivePolicy(),
+			allowlisted: listed.Verdict == access.Allowed,
+		}
+
+		// Check if request should be throttled; events an operator rule pinned
+		// into an exempt class (e.g. admin) skip the breaker and concurrency
+		// limit but stay subject to rate limits
+		_, throttleSpan := tracing.Start(ctx, "throttle")
+		admission := h.admit(ev)
+		throttleSpan.SetAttributes(
+			tracing.Bool("allowlisted", ev.allowlisted),
+			tracing.Bool("throttled", admission.Throttled),
+			tracing.String("throttle.reason", admission.Reason),
+		)
+		throttleSpan.End()
+
+		if admission.Throttled {
 			h.logger.Warn("Request throttled by QoS",
 				zap.String("user_id", msgInfo.UserID),
-				zap.Int("priority", priority))
+				zap.String("group_id", ev.groupID()),
+				zap.Int("priority", priority),
+				zap.String("class", decision.Class),
+				zap.String("reason", admission.Reason),
+				zap.String("policy", ev.policy.OnThrottle))
 
-			// Return throttled response
-			ackResponse := GenDispatchACK(false) // Indicate processing failed
-			h.writeJSONResponse(rw, http.StatusTooManyRequests, ackResponse)
+			// Throttled events are not delivery failures, so they are kept
+			// out of the circuit breaker's window
+			span.SetAttributes(tracing.String("policy.on_throttle", ev.policy.OnThrottle))
+			h.handleThrottled(rw, ev)
+			return
+		}
 
-			// Update QoS metrics
-			h.qosManager.UpdateMetrics(time.Since(startTime), false)
+		if ev.policy.OnFailure == config.PolicyFailAck {
+			h.deliverBeforeAck(rw, ev, admission)
 			return
 		}
 
@@ -154,12 +285,19 @@ func (h *WebhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 		// Submit the request to the scheduler for asynchronous processing
 		go func() {
-			processingStart := time.Now()
-			success := h.scheduler.Submit(r.Context(), body, r.Header, bot, h.logger)
-			processingTime := time.Since(processingStart)
-
-			// Update QoS metrics with processing results
-			h.qosManager.UpdateMetrics(processingTime, success)
+			d := h.startDelivery(ev)
+			complete := func(success bool) {
+				h.finishDelivery(ev, admission, d, success)
+				if !success {
+					h.handleFailed(ev)
+				}
+			}
+			persisted := func() {
+				h.persistDelivery(admission, d)
+			}
+			if !h.scheduler.Submit(d.ctx, body, r.Header, botID, bot, decision, h.logger, scheduler.Completion{Done: complete, Persisted: persisted}) {
+				complete(false)
+			}
 		}()
 
 	case OpHeartbeat:
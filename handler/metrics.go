@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"strconv"
+
+	"qqbotrouter/metrics"
+)
+
+// Reasons a webhook request is rejected before its operation is handled
+const (
+	rejectUnknownBot   = "unknown_bot"
+	rejectBadSignature = "bad_signature"
+	rejectBadRequest   = "bad_request"
+)
+
+// handlerMetrics counts incoming webhook requests and their delivery outcomes
+type handlerMetrics struct {
+	requests   *metrics.CounterVec
+	rejected   *metrics.CounterVec
+	deliveries *metrics.CounterVec
+}
+
+// newHandlerMetrics creates the webhook metric families
+func newHandlerMetrics() handlerMetrics {
+	return handlerMetrics{
+		requests: metrics.NewCounterVec("qqbotrouter_webhook_requests_total",
+			"Verified webhook requests by bot, operation and dispatch event type.",
+			"bot", "op", "event_type"),
+		rejected: metrics.NewCounterVec("qqbotrouter_webhook_rejected_total",
+			"Webhook requests rejected before handling, by bot and reason.",
+			"bot", "reason"),
+		deliveries: metrics.NewCounterVec("qqbotrouter_deliveries_total",
+			"Admitted events by bot and whether any destination accepted them.",
+			"bot", "result"),
+	}
+}
+
+// opName returns the label value for an operation code
+func opName(op int) string {
+	switch op {
+	case OpEventDispatch:
+		return "dispatch"
+	case OpHeartbeat:
+		return "heartbeat"
+	case OpCallbackValidation:
+		return "callback_validation"
+	case OpLegacyChallenge:
+		return "legacy_challenge"
+	default:
+		return strconv.Itoa(op)
+	}
+}
+
+// deliveryResult returns the label value for a delivery outcome
+func deliveryResult(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
+
+// RegisterMetrics exposes webhook request and delivery counts on the registry
+func (h *WebhookHandler) RegisterMetrics(registry *metrics.Registry) error {
+	return registry.Register(h.metrics.requests, h.metrics.rejected, h.metrics.deliveries)
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/openapi"
+	"qqbotrouter/priority"
+	"qqbotrouter/qos"
+	"qqbotrouter/ratelimit"
+	"qqbotrouter/scheduler"
+	"qqbotrouter/tracing"
+	"qqbotrouter/utils"
+)
+
+// busyReplyInterval bounds how often one user is sent the busy reply
+const busyReplyInterval = time.Minute
+
+// busyReplyLimit allows one busy reply per user per busyReplyInterval
+var busyReplyLimit = ratelimit.Limit{Rate: 1 / busyReplyInterval.Seconds(), Burst: 1}
+
+// dispatchEvent is an incoming event with everything needed to deliver it again later
+type dispatchEvent struct {
+	ctx      context.Context
+	body     []byte
+	header   http.Header
+	botID    string
+	bot      config.BotConfig
+	decision *priority.Decision
+	info     utils.MessageInfo
+	policy   config.PolicyConfig
+
+	allowlisted bool // The access lists allowlisted the sender or conversation
+}
+
+// groupID returns the event's group openid, or its channel ID for guild messages
+func (ev *dispatchEvent) groupID() string {
+	if ev.info.GroupID != "" {
+		return ev.info.GroupID
+	}
+	return ev.info.ChannelID
+}
+
+// delivery is one attempt at delivering an admitted event
+type delivery struct {
+	ctx   context.Context // Carries the delivery span, the parent of queue and forward spans
+	span  *tracing.Span
+	start time.Time
+}
+
+// admit runs an event through QoS admission; allowlisted events bypass throttling
+func (h *WebhookHandler) admit(ev *dispatchEvent) qos.AdmissionResult {
+	if ev.allowlisted {
+		return qos.AdmissionResult{}
+	}
+	return h.qosManager.Admit(qos.Admission{
+		BotID:          ev.botID,
+		UserID:         ev.info.UserID,
+		GroupID:        ev.groupID(),
+		Priority:       ev.decision.Priority,
+		Class:          ev.decision.Class,
+		ThrottleExempt: ev.decision.ThrottleExempt,
+	})
+}
+
+// startDelivery marks an admitted event as in flight and opens its delivery span
+func (h *WebhookHandler) startDelivery(ev *dispatchEvent) delivery {
+	if h.stats != nil {
+		h.stats.RequestStarted()
+	}
+	ctx, span := tracing.Start(ev.ctx, "deliver")
+	return delivery{ctx: ctx, span: span, start: time.Now()}
+}
+
+// finishDelivery releases an admitted event's concurrency slot, records its
+// outcome with the circuit breaker that admitted it and closes its delivery span
+func (h *WebhookHandler) finishDelivery(ev *dispatchEvent, admission qos.AdmissionResult, d delivery, success bool) {
+	elapsed := time.Since(d.start)
+	if !success {
+		d.span.SetStatus(tracing.StatusError, "no destination accepted the event")
+	}
+	d.span.End()
+
+	admission.Done()
+	admission.Record(success)
+	h.qosManager.UpdateMetrics(ev.botID, elapsed, success)
+	h.metrics.deliveries.With(ev.botID, deliveryResult(success)).Inc()
+	if h.stats != nil {
+		h.stats.RecordRequest(ev.info.UserID, elapsed, success)
+	}
+}
+
+// persistDelivery releases an admitted event's concurrency slot and closes its
+// delivery span once the scheduler saved it for delivery after a restart
+func (h *WebhookHandler) persistDelivery(admission qos.AdmissionResult, d delivery) {
+	d.span.SetAttributes(tracing.Bool("persisted", true))
+	d.span.End()
+	admission.Done()
+}
+
+// handleThrottled responds to a throttled event according to the bot's on_throttle policy
+func (h *WebhookHandler) handleThrottled(rw http.ResponseWriter, ev *dispatchEvent) {
+	switch ev.policy.OnThrottle {
+	case config.PolicyAckDrop:
+		h.writeJSONResponse(rw, http.StatusOK, GenDispatchACK(true))
+	case config.PolicyAckDefer:
+		h.writeJSONResponse(rw, http.StatusOK, GenDispatchACK(true))
+		h.deferDelivery(ev, 1)
+	case config.PolicyBusyReply:
+		h.writeJSONResponse(rw, http.StatusOK, GenDispatchACK(true))
+		go h.sendBusyReply(ev)
+	default:
+		// fail_ack: refuse the event so the platform redelivers it later
+		h.writeJSONResponse(rw, http.StatusTooManyRequests, GenDispatchACK(false))
+	}
+}
+
+// handleFailed applies the bot's on_failure policy to an acknowledged event that could not be delivered
+func (h *WebhookHandler) handleFailed(ev *dispatchEvent) {
+	switch ev.policy.OnFailure {
+	case config.PolicyAckDefer:
+		h.deferDelivery(ev, 1)
+	case config.PolicyBusyReply:
+		go h.sendBusyReply(ev)
+	default:
+		h.logger.Warn("Dropping undeliverable event",
+			zap.String("bot", ev.botID),
+			zap.String("user_id", ev.info.UserID),
+			zap.String("event_type", ev.info.EventType))
+	}
+}
+
+// deliverBeforeAck delivers an event and holds the ACK until the outcome is
+// known or ack_timeout passes, reporting failure so the platform redelivers.
+// An event still in flight at the timeout may be delivered twice.
+func (h *WebhookHandler) deliverBeforeAck(rw http.ResponseWriter, ev *dispatchEvent, admission qos.AdmissionResult) {
+	result := make(chan bool, 1)
+	d := h.startDelivery(ev)
+	complete := func(success bool) {
+		h.finishDelivery(ev, admission, d, success)
+		result <- success
+	}
+	// Not persisted at shutdown: the failure ACK already makes the platform redeliver
+	if !h.scheduler.Submit(d.ctx, ev.body, ev.header, ev.botID, ev.bot, ev.decision, h.logger, scheduler.Completion{Done: complete}) {
+		complete(false)
+	}
+
+	timeout := config.ParseDurationOrDefault(ev.policy.AckTimeout, 3*time.Second)
+	select {
+	case success := <-result:
+		if success {
+			h.writeJSONResponse(rw, http.StatusOK, GenDispatchACK(true))
+			return
+		}
+	case <-time.After(timeout):
+		h.logger.Warn("Delivery did not finish before ACK timeout",
+			zap.String("bot", ev.botID),
+			zap.String("user_id", ev.info.UserID),
+			zap.Duration("timeout", timeout))
+	}
+	h.writeJSONResponse(rw, http.StatusServiceUnavailable, GenDispatchACK(false))
+}
+
+// deferDelivery queues an event for another delivery attempt after the
+// policy's defer delay, retrying until max_deferrals. The event is admitted
+// again once the delay has passed, so limits that throttled it still apply;
+// an event that is still throttled is deferred again.
+func (h *WebhookHandler) deferDelivery(ev *dispatchEvent, attempt int) {
+	if attempt > *ev.policy.MaxDeferrals {
+		h.logger.Warn("Dropping event after deferred retries",
+			zap.String("bot", ev.botID),
+			zap.String("user_id", ev.info.UserID),
+			zap.Int("attempts", attempt-1))
+		return
+	}
+
+	delay := config.ParseDurationOrDefault(ev.policy.DeferDelay, 10*time.Second)
+	ctx, span := tracing.Start(ev.ctx, "deferred_delivery",
+		tracing.WithAttributes(tracing.Int("attempt", attempt)))
+
+	// Set on release, before the scheduler queues the event
+	var admission qos.AdmissionResult
+	var d *delivery
+	queued := h.scheduler.Defer(ctx, ev.body, ev.header, ev.botID, ev.bot, ev.decision, h.logger, delay, scheduler.Completion{
+		Release: func() bool {
+			admission = h.admit(ev)
+			if admission.Throttled {
+				span.SetAttributes(tracing.String("throttle.reason", admission.Reason))
+				span.SetStatus(tracing.StatusError, "throttled again")
+				span.End()
+				h.logger.Info("Deferred event still throttled",
+					zap.String("bot", ev.botID),
+					zap.String("user_id", ev.info.UserID),
+					zap.String("reason", admission.Reason),
+					zap.Int("attempt", attempt))
+				h.deferDelivery(ev, attempt+1)
+				return false
+			}
+			started := h.startDelivery(ev)
+			d = &started
+			return true
+		},
+		Done: func(success bool) {
+			if d != nil {
+				h.finishDelivery(ev, admission, *d, success)
+			}
+			if !success {
+				span.SetStatus(tracing.StatusError, "no destination accepted the event")
+			}
+			span.End()
+			// Only attempts that were released and delivered are retried;
+			// the others failed because the scheduler is shutting down
+			if !success && d != nil {
+				h.deferDelivery(ev, attempt+1)
+			}
+		},
+		Persisted: func() {
+			if d != nil {
+				h.persistDelivery(admission, *d)
+			}
+			span.SetAttributes(tracing.Bool("persisted", true))
+			span.End()
+		},
+	})
+	if !queued {
+		span.SetStatus(tracing.StatusError, "could not defer event")
+		span.End()
+		h.logger.Warn("Could not defer event",
+			zap.String("bot", ev.botID),
+			zap.String("user_id", ev.info.UserID))
+		return
+	}
+	h.logger.Info("Event deferred",
+		zap.String("bot", ev.botID),
+		zap.String("user_id", ev.info.UserID),
+		zap.Int("attempt", attempt),
+		zap.Duration("delay", delay))
+}
+
+// sendBusyReply tells the user the bot is busy, at most once per user per busyReplyInterval
+func (h *WebhookHandler) sendBusyReply(ev *dispatchEvent) {
+	key := ev.botID + "|" + ev.info.UserID
+	if h.busyReplies.Allow([]ratelimit.Check{{Key: key, Limit: busyReplyLimit}}, time.Now()) >= 0 {
+		return
+	}
+
+	target := openapi.ReplyTarget{
+		EventType: ev.info.EventType,
+		UserID:    ev.info.UserID,
+		GroupID:   ev.info.GroupID,
+		GuildID:   ev.info.GuildID,
+		ChannelID: ev.info.ChannelID,
+		MessageID: ev.info.MessageID,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := h.openapi.Reply(ctx, ev.policy.AppID, ev.bot.Secret, target, ev.policy.BusyReply); err != nil {
+		h.logger.Warn("Failed to send busy reply",
+			zap.String("bot", ev.botID),
+			zap.String("user_id", ev.info.UserID),
+			zap.Error(err))
+		return
+	}
+	h.logger.Info("Sent busy reply",
+		zap.String("bot", ev.botID),
+		zap.String("user_id", ev.info.UserID))
+}
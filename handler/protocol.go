@@ -14,6 +14,7 @@ import (
 type WebhookPacket struct {
 	Op int             `json:"op"`
 	D  json.RawMessage `json:"d"`
+	T  string          `json:"t,omitempty"` // Event type, set on dispatch
 }
 
 type ChallengeData struct {
@@ -42,15 +43,16 @@ const (
 	OpLegacyChallenge    = 1  // Legacy Challenge
 )
 
-// GenDispatchACK generates ACK response for event dispatch
-// Always returns d=0 to indicate success, preventing platform from retrying
-// even when all forwards fail, to avoid repeated pushes that could crash the project
+// GenDispatchACK generates ACK response for event dispatch.
+// d=0 reports success; d=1 reports failure so the platform redelivers the
+// event. Whether a failure is reported is decided by the bot's policy.
 func GenDispatchACK(success bool) []byte {
-	// Always return success (data = 0) to prevent platform retry
-	// This avoids repeated pushes when all forward destinations fail
 	ack := ACKResponse{
 		Op:   OpHTTPCallbackACK,
-		Data: 0, // Always success to prevent retry
+		Data: 0,
+	}
+	if !success {
+		ack.Data = 1
 	}
 
 	response, _ := json.Marshal(ack)
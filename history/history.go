@@ -0,0 +1,340 @@
+package history
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/metrics"
+)
+
+const (
+	// historyFileVersion is the on-disk format version of a saved history
+	historyFileVersion = 1
+
+	// saveInterval is how often a persisted history is written to disk
+	saveInterval = 5 * time.Minute
+)
+
+// Point is one sampled value; T is a Unix timestamp in milliseconds
+type Point struct {
+	T int64   `json:"t"`
+	V float64 `json:"v"`
+}
+
+// Time returns the point's timestamp
+func (p Point) Time() time.Time {
+	return time.UnixMilli(p.T)
+}
+
+// ring holds the most recent points of a series, oldest first once full
+type ring struct {
+	points []Point
+	start  int // Index of the oldest point once the ring is full
+}
+
+// push appends a point, overwriting the oldest once capacity is reached
+func (r *ring) push(p Point, capacity int) {
+	if len(r.points) < capacity {
+		r.points = append(r.points, p)
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+// between returns the points with from <= T <= to in time order
+func (r *ring) between(from, to int64) []Point {
+	var out []Point
+	for i := range r.points {
+		p := r.points[(r.start+i)%len(r.points)]
+		if p.T >= from && p.T <= to {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// last returns the newest point, if any
+func (r *ring) last() (Point, bool) {
+	if len(r.points) == 0 {
+		return Point{}, false
+	}
+	return r.points[(r.start+len(r.points)-1)%len(r.points)], true
+}
+
+// series is the history of one labelled metric
+type series struct {
+	name   string
+	kind   string // metrics.TypeCounter or metrics.TypeGauge
+	labels []metrics.Label
+	points ring
+}
+
+// labelMap returns the series' labels keyed by name
+func (sr *series) labelMap() map[string]string {
+	labels := make(map[string]string, len(sr.labels))
+	for _, label := range sr.labels {
+		labels[label.Name] = label.Value
+	}
+	return labels
+}
+
+// SeriesInfo describes a stored series
+type SeriesInfo struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points int               `json:"points"`
+	Last   *Point            `json:"last,omitempty"`
+}
+
+// Store samples counters and gauges at a fixed interval and keeps each
+// series in a ring buffer sized to the retention period
+type Store struct {
+	mu        sync.RWMutex
+	series    map[string]*series
+	interval  time.Duration
+	retention time.Duration
+	capacity  int
+	gather    func() []metrics.Sample
+	path      string // Where the history is saved; empty keeps it in memory only
+}
+
+// NewStore creates a store that calls gather every interval and keeps
+// samples for the retention period
+func NewStore(interval, retention time.Duration, gather func() []metrics.Sample) *Store {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	if retention < interval {
+		retention = interval
+	}
+	return &Store{
+		series:    make(map[string]*series),
+		interval:  interval,
+		retention: retention,
+		capacity:  int(retention/interval) + 1,
+		gather:    gather,
+	}
+}
+
+// SetPath makes the store save its history to path and restore it with Load
+func (s *Store) SetPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+}
+
+// Interval returns how often metrics are sampled
+func (s *Store) Interval() time.Duration {
+	return s.interval
+}
+
+// Retention returns how long samples are kept
+func (s *Store) Retention() time.Duration {
+	return s.retention
+}
+
+// Sample records the current value of every gathered series
+func (s *Store) Sample(now time.Time) {
+	samples := s.gather()
+	t := now.UnixMilli()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sample := range samples {
+		key := sample.Key()
+		sr, ok := s.series[key]
+		if !ok {
+			sr = &series{name: sample.Name, kind: sample.Type, labels: sample.Labels}
+			s.series[key] = sr
+		}
+		sr.points.push(Point{T: t, V: sample.Value}, s.capacity)
+	}
+}
+
+// prune forgets series that have not been sampled within the retention period
+func (s *Store) prune(now time.Time) int {
+	cutoff := now.Add(-s.retention).UnixMilli()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for key, sr := range s.series {
+		if last, ok := sr.points.last(); !ok || last.T < cutoff {
+			delete(s.series, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Series lists the stored series ordered by name and labels
+func (s *Store) Series() []SeriesInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]string, 0, len(s.series))
+	for key := range s.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	infos := make([]SeriesInfo, 0, len(keys))
+	for _, key := range keys {
+		sr := s.series[key]
+		info := SeriesInfo{Name: sr.name, Type: sr.kind, Labels: sr.labelMap(), Points: len(sr.points.points)}
+		if last, ok := sr.points.last(); ok {
+			info.Last = &last
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Run samples metrics every interval until the context is cancelled, saving
+// the history periodically and once more on shutdown if a path is set
+func (s *Store) Run(ctx context.Context) error {
+	sampleTicker := time.NewTicker(s.interval)
+	defer sampleTicker.Stop()
+	saveTicker := time.NewTicker(saveInterval)
+	defer saveTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Save(); err != nil {
+				zap.L().Error("Failed to save metrics history", zap.Error(err))
+			}
+			return ctx.Err()
+		case now := <-sampleTicker.C:
+			s.Sample(now)
+		case now := <-saveTicker.C:
+			if removed := s.prune(now); removed > 0 {
+				zap.L().Debug("Idle metric series removed from history", zap.Int("removed", removed))
+			}
+			if err := s.Save(); err != nil {
+				zap.L().Error("Failed to save metrics history", zap.Error(err))
+			}
+		}
+	}
+}
+
+// historyFile is the on-disk format of a saved history
+type historyFile struct {
+	Version int          `json:"version"`
+	Series  []seriesFile `json:"series"`
+}
+
+// seriesFile is one saved series
+type seriesFile struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Labels []metrics.Label `json:"labels,omitempty"`
+	Points []Point         `json:"points"`
+}
+
+// Save writes the history to the store's path atomically as gzipped JSON
+func (s *Store) Save() error {
+	s.mu.RLock()
+	path := s.path
+	if path == "" {
+		s.mu.RUnlock()
+		return nil
+	}
+	file := historyFile{Version: historyFileVersion, Series: make([]seriesFile, 0, len(s.series))}
+	for _, sr := range s.series {
+		file.Series = append(file.Series, seriesFile{
+			Name:   sr.name,
+			Type:   sr.kind,
+			Labels: sr.labels,
+			Points: sr.points.between(0, 1<<63-1),
+		})
+	}
+	s.mu.RUnlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics history directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics history: %w", err)
+	}
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(file)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write metrics history: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace metrics history: %w", err)
+	}
+	return nil
+}
+
+// Load restores a saved history, dropping points older than the retention
+// period; a missing file is not an error
+func (s *Store) Load() error {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read metrics history: %w", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read metrics history: %w", err)
+	}
+	var file historyFile
+	if err := json.NewDecoder(zr).Decode(&file); err != nil {
+		return fmt.Errorf("failed to parse metrics history: %w", err)
+	}
+	if file.Version != historyFileVersion {
+		return fmt.Errorf("unsupported metrics history version %d", file.Version)
+	}
+
+	cutoff := time.Now().Add(-s.retention).UnixMilli()
+	restored := make(map[string]*series, len(file.Series))
+	for _, saved := range file.Series {
+		sr := &series{name: saved.Name, kind: saved.Type, labels: saved.Labels}
+		for _, p := range saved.Points {
+			if p.T >= cutoff {
+				sr.points.push(p, s.capacity)
+			}
+		}
+		if len(sr.points.points) > 0 {
+			restored[metrics.Sample{Name: saved.Name, Labels: saved.Labels}.Key()] = sr
+		}
+	}
+
+	s.mu.Lock()
+	s.series = restored
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,154 @@
+package history
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"qqbotrouter/metrics"
+)
+
+// Query selects the points of one metric over a time range
+type Query struct {
+	Name   string            // Metric name, required
+	Labels map[string]string // Series must carry every label with the given value
+	From   time.Time
+	To     time.Time
+	Step   time.Duration // Downsampling step; zero returns raw points
+	Rate   bool          // Return the per-second rate of a counter instead of its value
+}
+
+// Result is the queried history of one series
+type Result struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []Point           `json:"points"`
+}
+
+// ErrRateOfGauge is returned when a rate is requested for a gauge
+var ErrRateOfGauge = errors.New("rate only applies to counters")
+
+// Query returns the matching series ordered by labels. Downsampled gauges
+// average each step while counters keep the last value, as do rates.
+func (s *Store) Query(q Query) ([]Result, error) {
+	if q.Name == "" {
+		return nil, errors.New("metric name is required")
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-time.Hour)
+	}
+	if q.From.After(q.To) {
+		return nil, errors.New("from must not be after to")
+	}
+
+	s.mu.RLock()
+	var matched []Result
+	for key, sr := range s.series {
+		if sr.name != q.Name || !matches(sr.labels, q.Labels) {
+			continue
+		}
+		if q.Rate && sr.kind != metrics.TypeCounter {
+			s.mu.RUnlock()
+			return nil, ErrRateOfGauge
+		}
+		matched = append(matched, Result{
+			Name:   key, // Replaced below; keeps results sortable by labels
+			Type:   sr.kind,
+			Labels: sr.labelMap(),
+			Points: sr.points.between(q.From.UnixMilli(), q.To.UnixMilli()),
+		})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Name < matched[j].Name })
+	for i := range matched {
+		r := &matched[i]
+		r.Name = q.Name
+		if q.Rate {
+			r.Points = rate(r.Points)
+		}
+		if q.Step > 0 {
+			r.Points = downsample(r.Points, q.Step, r.Type == metrics.TypeGauge)
+		}
+		if r.Points == nil {
+			r.Points = []Point{}
+		}
+	}
+	return matched, nil
+}
+
+// matches reports whether labels carry every wanted label value
+func matches(labels []metrics.Label, want map[string]string) bool {
+	for name, value := range want {
+		found := false
+		for _, label := range labels {
+			if label.Name == name {
+				found = label.Value == value
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// rate converts counter values into per-second increases between consecutive
+// points. A drop in value is a counter reset, so the new value is the increase.
+func rate(points []Point) []Point {
+	if len(points) < 2 {
+		return nil
+	}
+	out := make([]Point, 0, len(points)-1)
+	for i := 1; i < len(points); i++ {
+		prev, cur := points[i-1], points[i]
+		elapsed := float64(cur.T-prev.T) / 1000
+		if elapsed <= 0 {
+			continue
+		}
+		increase := cur.V - prev.V
+		if increase < 0 {
+			increase = cur.V
+		}
+		out = append(out, Point{T: cur.T, V: increase / elapsed})
+	}
+	return out
+}
+
+// downsample groups points into step-aligned buckets, stamped with the start
+// of the bucket, averaging the values or keeping the last one
+func downsample(points []Point, step time.Duration, average bool) []Point {
+	stepMs := step.Milliseconds()
+	if stepMs <= 0 || len(points) == 0 {
+		return points
+	}
+
+	var out []Point
+	var sum float64
+	var n int
+	flush := func() {
+		if average {
+			out[len(out)-1].V = sum / float64(n)
+		}
+	}
+	for _, p := range points {
+		bucket := p.T - p.T%stepMs
+		if len(out) == 0 || out[len(out)-1].T != bucket {
+			if len(out) > 0 {
+				flush()
+			}
+			out = append(out, Point{T: bucket})
+			sum, n = 0, 0
+		}
+		out[len(out)-1].V = p.V
+		sum += p.V
+		n++
+	}
+	flush()
+	return out
+}
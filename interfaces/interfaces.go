@@ -20,12 +20,21 @@ type StatProvider interface {
 	// GetTotalRequests returns the total number of requests processed
 	GetTotalRequests() int64
 
-	// GetActiveConnections returns the number of active connections
+	// GetActiveConnections returns the number of requests in flight
 	GetActiveConnections() int
 
-	// RecordRequest records a new request with its processing time and success status
+	// RecordArrival records an incoming event from a user
+	RecordArrival(userID string, at time.Time)
+
+	// RequestStarted marks an accepted request as in flight until RecordRequest is called for it
+	RequestStarted()
+
+	// RecordRequest records a finished request with its processing time and success status
 	RecordRequest(userID string, processingTime time.Duration, success bool)
 
+	// RecordForward records the latency and outcome of forwarding a request to its destinations
+	RecordForward(latency time.Duration, success bool)
+
 	// GetSystemLoad returns the current system load (0.0 to 1.0)
 	GetSystemLoad() float64
 
@@ -34,6 +43,29 @@ type StatProvider interface {
 
 	// P90 returns the 90th percentile of message intervals
 	P90() time.Duration
+
+	// GetUserProfile returns a user's behaviour profile, or false if the user has not been seen
+	GetUserProfile(userID string) (UserProfile, bool)
+}
+
+// User tiers assigned from behaviour profiles
+const (
+	UserTierNew      = "new"      // Too little history to classify
+	UserTierCasual   = "casual"   // Occasional or irregular users
+	UserTierActive   = "active"   // Regular users active across the day
+	UserTierFlooding = "flooding" // Users sending more than the behaviour threshold per analysis window
+)
+
+// UserProfile summarises a user's observed behaviour
+type UserProfile struct {
+	Tier          string  `json:"tier"`
+	Messages      int64   `json:"messages"`       // Messages seen in total
+	RecentCount   int     `json:"recent_count"`   // Messages in the analysis window
+	DailyMessages float64 `json:"daily_messages"` // Decayed average messages per day
+	Burstiness    float64 `json:"burstiness"`     // Coefficient of variation of the gaps between messages; about 1 for steady random traffic
+	ErrorRate     float64 `json:"error_rate"`     // Decayed share of the user's requests that failed
+	ActiveHours   int     `json:"active_hours"`   // Hours of the day the user is regularly active in
+	HourShare     float64 `json:"hour_share"`     // Share of the user's activity that falls in the current hour of day
 }
 
 // QoSProvider defines the interface for QoS management
@@ -41,8 +73,8 @@ type QoSProvider interface {
 	// ShouldThrottle determines if a request should be throttled
 	ShouldThrottle(userID string, priority int) bool
 
-	// UpdateMetrics updates QoS metrics with processing results
-	UpdateMetrics(processingTime time.Duration, success bool)
+	// UpdateMetrics updates QoS metrics with a bot's processing results
+	UpdateMetrics(botID string, processingTime time.Duration, success bool)
 
 	// RecordUserActivity records user activity for ML training
 	RecordUserActivity(userID string, priority int, timestamp time.Time)
@@ -83,11 +115,27 @@ type Observer interface {
 	// RecordLatency records a new request latency
 	RecordLatency(latency time.Duration)
 
+	// RecordBotLatency records how long one of a bot's events took to process
+	RecordBotLatency(botID string, latency time.Duration)
+
+	// RecordDestinationLatency records how long a destination took to answer a forward
+	RecordDestinationLatency(destination string, latency time.Duration)
+
 	// HighLoadThreshold returns the current high-load threshold
 	HighLoadThreshold() time.Duration
 
 	// GetCurrentLoad returns the current system load
 	GetCurrentLoad() float64
+
+	// BotLoad returns a bot's recent latency relative to its high-load threshold (0.0 to 1.0)
+	BotLoad(botID string) float64
+}
+
+// SpamScorer defines the interface for classifying messages as spam
+type SpamScorer interface {
+	// SpamScore returns the probability that text is spam (0.0 to 1.0), or
+	// false if no trained model is available
+	SpamScore(text string) (float64, bool)
 }
 
 // ConfigProvider defines the interface for configuration management
@@ -104,3 +152,19 @@ type ConfigProvider interface {
 	// Reload reloads the configuration
 	Reload() error
 }
+
+// WorkerPoolController defines the interface for runtime control of a worker pool
+type WorkerPoolController interface {
+	// WorkerCount returns the number of running workers
+	WorkerCount() int
+
+	// BusyWorkers returns the number of workers currently processing a request
+	BusyWorkers() int
+
+	// GetQueueSize returns the current queue size
+	GetQueueSize() int
+
+	// Resize grows or shrinks the worker pool without dropping in-flight
+	// requests, within the pool's limits
+	Resize(size int) error
+}
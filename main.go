@@ -6,23 +6,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
 
+	"qqbotrouter/access"
+	"qqbotrouter/admin"
 	"qqbotrouter/autocert"
 	"qqbotrouter/config"
 	"qqbotrouter/handler"
+	"qqbotrouter/history"
 	"qqbotrouter/initialize"
 	"qqbotrouter/load"
+	"qqbotrouter/metrics"
 	"qqbotrouter/ml_trainer"
 	"qqbotrouter/observer"
 	"qqbotrouter/qos"
 	"qqbotrouter/scheduler"
 	"qqbotrouter/services"
+	"qqbotrouter/spam"
 	"qqbotrouter/stats"
+	"qqbotrouter/tracing"
 )
 
 var (
@@ -33,7 +40,7 @@ var (
 )
 
 // handleConfigReload handles configuration reload and updates relevant components
-func handleConfigReload(newConfig *config.Config, qosManager *qos.QoSManager, mainScheduler *scheduler.Scheduler) {
+func handleConfigReload(newConfig *config.Config, qosManager *qos.QoSManager, mainScheduler *scheduler.Scheduler, statsAnalyzer *stats.StatsAnalyzer) {
 	logger.Info("Processing configuration reload...")
 
 	// Update global config atomically
@@ -52,10 +59,20 @@ func handleConfigReload(newConfig *config.Config, qosManager *qos.QoSManager, ma
 
 	// Update QoS configuration
 	if qosManager != nil {
-		qosManager.UpdateConfig(&newConfig.QoS)
+		profiles, err := newConfig.BotQoSProfiles()
+		if err != nil {
+			logger.Error("Invalid bot QoS profiles, keeping global settings for all bots", zap.Error(err))
+		}
+		qosManager.UpdateConfig(&newConfig.QoS, profiles)
 		logger.Info("QoS configuration updated")
 	}
 
+	// Update user behaviour classification
+	if statsAnalyzer != nil {
+		behavior := newConfig.Scheduler.UserBehaviorAnalysis
+		statsAnalyzer.SetBehaviorSettings(config.ParseDurationOrDefault(behavior.AnalysisWindow, 15*time.Minute), behavior.BehaviorThreshold)
+	}
+
 	// Update Scheduler configuration
 	if mainScheduler != nil {
 		mainScheduler.UpdateConfig(&newConfig.Scheduler)
@@ -112,6 +129,8 @@ func initLogger(logLevel string) {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
+	// Make the logger available to components that log through zap.L()
+	zap.ReplaceGlobals(logger)
 	// Ensure logger is synced on exit
 	defer func() {
 		if err := logger.Sync(); err != nil {
@@ -146,10 +165,58 @@ func main() {
 	// 2. Initialize all QoS services
 	loadCounter := load.NewCounter()
 	statsAnalyzer := stats.NewStatsAnalyzer(cfg.Scheduler.UserBehaviorAnalysis.MinDataPointsForBaseline)
-	qosObserver := observer.NewObserver(time.Duration(cfg.QoS.DynamicLoadBalancing.LoadThreshold)*time.Millisecond, 100)
+	statsAnalyzer.SetCapacity(cfg.QoS.MaxConcurrentRequests)
+	statsAnalyzer.SetBehaviorSettings(
+		config.ParseDurationOrDefault(cfg.Scheduler.UserBehaviorAnalysis.AnalysisWindow, 15*time.Minute),
+		cfg.Scheduler.UserBehaviorAnalysis.BehaviorThreshold)
+	statsAnalyzer.SetProfilePath(filepath.Join(cfg.DataDir, "user_profiles.json"))
+	if err := statsAnalyzer.LoadProfiles(); err != nil {
+		logger.Error("Failed to load user profiles", zap.Error(err))
+	}
+	qosObserver := observer.NewObserver(100)
 	mlTrainer := ml_trainer.NewMLTrainer(statsAnalyzer)
 	qosManager := qos.NewQoSManager(&cfg.QoS, loadCounter, statsAnalyzer, qosObserver, logger)
+	if profiles, err := cfg.BotQoSProfiles(); err != nil {
+		logger.Error("Invalid bot QoS profiles, using global settings for all bots", zap.Error(err))
+	} else {
+		qosManager.SetBotProfiles(profiles)
+	}
 	mainScheduler := scheduler.NewScheduler(statsAnalyzer, &cfg.Scheduler, &cfg.QoS, loadCounter)
+	mainScheduler.SetSnapshotPath(filepath.Join(cfg.DataDir, "queue_snapshot.json"))
+	mainScheduler.SetLatencyObserver(qosManager.RecordForwardLatency)
+	mainScheduler.SetObserver(qosObserver)
+
+	// Spam classifier trained offline with cmd/spamtrain and online from operator feedback
+	spamClassifier := spam.NewClassifier(filepath.Join(cfg.DataDir, spam.ModelFile))
+	spamClassifier.SetFeedbackPath(filepath.Join(cfg.DataDir, spam.FeedbackFile))
+	if err := spamClassifier.Load(); err != nil {
+		logger.Error("Failed to load spam model, falling back to spam keywords", zap.Error(err))
+	}
+	mainScheduler.SetSpamScorer(spamClassifier)
+	mainScheduler.SetBotResolver(func(botID string) (config.BotConfig, bool) {
+		configMutex.RLock()
+		defer configMutex.RUnlock()
+		return currentConfig.GetBotConfig(botID)
+	})
+
+	accessLists := access.NewStore(filepath.Join(cfg.DataDir, "access_lists.json"))
+	if err := accessLists.Load(); err != nil {
+		logger.Error("Failed to load access lists", zap.Error(err))
+	}
+
+	// Metrics scraped from /metrics on the admin listener
+	metricsRegistry := metrics.NewRegistry()
+	for _, register := range []func(*metrics.Registry) error{
+		statsAnalyzer.RegisterMetrics,
+		qosObserver.RegisterMetrics,
+		mlTrainer.RegisterMetrics,
+		qosManager.RegisterMetrics,
+		mainScheduler.RegisterMetrics,
+	} {
+		if err := register(metricsRegistry); err != nil {
+			logger.Error("Failed to register metrics", zap.Error(err))
+		}
+	}
 
 	// 3. Set up graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -166,6 +233,82 @@ func main() {
 	serviceManager.AddService(mlTrainer)
 	serviceManager.AddService(qosManager)
 	serviceManager.AddService(mainScheduler)
+	serviceManager.AddService(accessLists)
+	serviceManager.AddService(spamClassifier)
+
+	// Metrics history sampled from the registry, for charts and incident review
+	var metricsHistory *history.Store
+	if monitoring := cfg.QoS.PerformanceMonitoring; monitoring.Enabled {
+		metricsHistory = history.NewStore(
+			config.ParseDurationOrDefault(monitoring.MetricsInterval, 10*time.Second),
+			config.ParseDurationOrDefault(monitoring.HistoryRetention, 24*time.Hour),
+			metricsRegistry.Gather)
+		if monitoring.Persist {
+			metricsHistory.SetPath(filepath.Join(cfg.DataDir, "metrics_history.json.gz"))
+			if err := metricsHistory.Load(); err != nil {
+				logger.Error("Failed to load metrics history", zap.Error(err))
+			}
+		}
+		serviceManager.AddService(metricsHistory)
+	}
+
+	// Per-event tracing, exported over OTLP or to a local file
+	if cfg.Tracing.Enabled {
+		exporter, err := tracing.NewExporter(cfg.Tracing, cfg.DataDir)
+		if err != nil {
+			logger.Error("Failed to create trace exporter, tracing disabled", zap.Error(err))
+		} else {
+			tracer := tracing.NewTracer(cfg.Tracing, exporter, logger)
+			tracing.SetTracer(tracer)
+			serviceManager.AddService(tracer)
+			logger.Info("Tracing enabled",
+				zap.String("exporter", cfg.Tracing.Exporter),
+				zap.Float64("sample_ratio", cfg.Tracing.SampleRatio))
+		}
+	}
+
+	// Admin API on a separate listener
+	if cfg.Admin.Enabled {
+		adminServer := admin.NewServer(cfg.Admin, logger)
+		adminServer.Handle("/admin/scheduler/workers", admin.NewWorkerPoolHandler(mainScheduler, logger))
+		adminServer.Handle("/admin/scheduler/expired", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.ExpiryStats()
+		}, logger))
+		adminServer.Handle("/admin/scheduler/shedding", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.ShedStats()
+		}, logger))
+		adminServer.Handle("/admin/scheduler/classes", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.ClassStats()
+		}, logger))
+		adminServer.Handle("/admin/scheduler/routes", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.RouteEndpointStats()
+		}, logger))
+		adminServer.Handle("/admin/scheduler/bots", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.BotStats()
+		}, logger))
+		adminServer.Handle("/admin/qos/concurrency", admin.NewSnapshotHandler(func() interface{} {
+			return qosManager.ConcurrencyStatus()
+		}, logger))
+		adminServer.Handle("/admin/qos/load", admin.NewSnapshotHandler(func() interface{} {
+			return map[string]interface{}{
+				"bots":     qosManager.LoadStatus(),
+				"observer": qosObserver.Status(),
+			}
+		}, logger))
+		adminServer.Handle("/admin/qos/breaker", admin.NewSnapshotHandler(func() interface{} {
+			return qosManager.BreakerStatus()
+		}, logger))
+		adminServer.Handle("/admin/access", admin.NewAccessListHandler(accessLists, logger))
+		adminServer.Handle("/admin/spam", admin.NewSpamHandler(spamClassifier, logger))
+		adminServer.Handle("/metrics", metricsRegistry)
+		if metricsHistory != nil {
+			adminServer.Handle("/admin/history", admin.NewHistoryHandler(metricsHistory, logger))
+		}
+		adminServer.Handle("/admin/priority/decisions", admin.NewSnapshotHandler(func() interface{} {
+			return mainScheduler.RecentDecisions()
+		}, logger))
+		serviceManager.AddService(adminServer)
+	}
 
 	serviceManager.StartAll(ctx)
 	logger.Info("All QoS services have been initialized and started.")
@@ -183,7 +326,7 @@ func main() {
 		}
 
 		reloadHandler := func(newConfig *config.Config) {
-			handleConfigReload(newConfig, qosManager, mainScheduler)
+			handleConfigReload(newConfig, qosManager, mainScheduler, statsAnalyzer)
 		}
 
 		configWatcher, err = config.NewConfigWatcher("config.yaml", reloadHandler, errorHandler)
@@ -201,7 +344,13 @@ func main() {
 
 	// 6. Set up HTTP/S servers
 	mux := http.NewServeMux()
-	mux.Handle("/", handler.NewWebhookHandler(cfg, logger, mainScheduler, qosManager))
+	webhookHandler := handler.NewWebhookHandler(cfg, logger, mainScheduler, qosManager)
+	webhookHandler.SetAccessLists(accessLists)
+	webhookHandler.SetStats(statsAnalyzer)
+	if err := webhookHandler.RegisterMetrics(metricsRegistry); err != nil {
+		logger.Error("Failed to register webhook metrics", zap.Error(err))
+	}
+	mux.Handle("/", webhookHandler)
 
 	server := &http.Server{
 		Addr:      ":" + cfg.HTTPSPort,
@@ -229,15 +378,7 @@ func main() {
 	<-sigChan
 	logger.Info("Shutdown signal received, starting graceful shutdown...")
 
-	// Cancel context to stop all background services
-	cancel()
-
-	// Wait for all background services to complete
-	logger.Info("Waiting for background services to complete...")
-	serviceManager.WaitForAll()
-	logger.Info("All background services stopped")
-
-	// Shutdown HTTP server with timeout
+	// Stop accepting webhooks first so nothing new enters the queue while it drains
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer shutdownCancel()
 
@@ -247,6 +388,14 @@ func main() {
 		logger.Info("Server shutdown completed successfully")
 	}
 
+	// Cancel context to stop all background services; the scheduler drains its queue
+	cancel()
+
+	// Wait for all background services to complete
+	logger.Info("Waiting for background services to complete...")
+	serviceManager.WaitForAll()
+	logger.Info("All background services stopped")
+
 	// Stop config watcher if running
 	if configWatcher != nil {
 		configWatcher.Stop()
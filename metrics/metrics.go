@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are latency histogram bounds in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// family is the name, help and label names shared by every series of a metric
+type family struct {
+	name       string
+	help       string
+	labelNames []string
+}
+
+// Name returns the metric family name
+func (f *family) Name() string {
+	return f.name
+}
+
+// key identifies a series by its label values, which must match the label names
+func (f *family) key(labelValues []string) string {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", f.name, len(labelValues), len(f.labelNames)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// value is a float64 updated atomically
+type value struct {
+	bits uint64
+}
+
+func (v *value) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+func (v *value) store(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Counter is a single counter series
+type Counter struct {
+	labelValues []string
+	v           value
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add adds a non-negative delta to the counter
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	family
+	mu     sync.RWMutex
+	series map[string]*Counter
+}
+
+// NewCounterVec creates a counter family with the given label names
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		family: family{name: name, help: help, labelNames: labelNames},
+		series: make(map[string]*Counter),
+	}
+}
+
+// With returns the series for the given label values, creating it on first use
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	key := v.key(labelValues)
+
+	v.mu.RLock()
+	c, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok := v.series[key]; ok {
+		return c
+	}
+	c = &Counter{labelValues: append([]string(nil), labelValues...)}
+	v.series[key] = c
+	return c
+}
+
+// Collect writes every series of the family
+func (v *CounterVec) Collect(w *Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	w.Header(v.name, v.help, TypeCounter)
+	for _, key := range sortedKeys(v.series) {
+		c := v.series[key]
+		w.Sample(v.name, v.labelNames, c.labelValues, c.v.load())
+	}
+}
+
+// Gauge is a single gauge series
+type Gauge struct {
+	labelValues []string
+	v           value
+}
+
+// Set sets the gauge to a value
+func (g *Gauge) Set(f float64) {
+	g.v.store(f)
+}
+
+// Add adds delta, which may be negative, to the gauge
+func (g *Gauge) Add(delta float64) {
+	g.v.add(delta)
+}
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct {
+	family
+	mu     sync.RWMutex
+	series map[string]*Gauge
+}
+
+// NewGaugeVec creates a gauge family with the given label names
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{
+		family: family{name: name, help: help, labelNames: labelNames},
+		series: make(map[string]*Gauge),
+	}
+}
+
+// With returns the series for the given label values, creating it on first use
+func (v *GaugeVec) With(labelValues ...string) *Gauge {
+	key := v.key(labelValues)
+
+	v.mu.RLock()
+	g, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return g
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if g, ok := v.series[key]; ok {
+		return g
+	}
+	g = &Gauge{labelValues: append([]string(nil), labelValues...)}
+	v.series[key] = g
+	return g
+}
+
+// Collect writes every series of the family
+func (v *GaugeVec) Collect(w *Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	w.Header(v.name, v.help, TypeGauge)
+	for _, key := range sortedKeys(v.series) {
+		g := v.series[key]
+		w.Sample(v.name, v.labelNames, g.labelValues, g.v.load())
+	}
+}
+
+// Histogram is a single histogram series
+type Histogram struct {
+	labelValues []string
+	mu          sync.Mutex
+	upperBounds []float64
+	counts      []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum         float64
+	count       uint64
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	i := sort.SearchFloat64s(h.upperBounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct {
+	family
+	upperBounds []float64
+	mu          sync.RWMutex
+	series      map[string]*Histogram
+}
+
+// NewHistogramVec creates a histogram family with the given bucket upper
+// bounds; a +Inf bucket is always added
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	upperBounds := append([]float64(nil), buckets...)
+	sort.Float64s(upperBounds)
+	if n := len(upperBounds); n > 0 && math.IsInf(upperBounds[n-1], 1) {
+		upperBounds = upperBounds[:n-1]
+	}
+	return &HistogramVec{
+		family:      family{name: name, help: help, labelNames: labelNames},
+		upperBounds: upperBounds,
+		series:      make(map[string]*Histogram),
+	}
+}
+
+// With returns the series for the given label values, creating it on first use
+func (v *HistogramVec) With(labelValues ...string) *Histogram {
+	key := v.key(labelValues)
+
+	v.mu.RLock()
+	h, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok := v.series[key]; ok {
+		return h
+	}
+	h = &Histogram{
+		labelValues: append([]string(nil), labelValues...),
+		upperBounds: v.upperBounds,
+		counts:      make([]uint64, len(v.upperBounds)+1),
+	}
+	v.series[key] = h
+	return h
+}
+
+// Collect writes the cumulative buckets, sum and count of every series
+func (v *HistogramVec) Collect(w *Writer) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	w.Header(v.name, v.help, TypeHistogram)
+	bucketLabels := append(append([]string(nil), v.labelNames...), "le")
+	for _, key := range sortedKeys(v.series) {
+		h := v.series[key]
+
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		bucketValues := append(append([]string(nil), h.labelValues...), "")
+		var cumulative uint64
+		for i, bound := range v.upperBounds {
+			cumulative += counts[i]
+			bucketValues[len(bucketValues)-1] = formatValue(bound)
+			w.Sample(v.name+"_bucket", bucketLabels, bucketValues, float64(cumulative))
+		}
+		bucketValues[len(bucketValues)-1] = "+Inf"
+		w.Sample(v.name+"_bucket", bucketLabels, bucketValues, float64(count))
+		w.Sample(v.name+"_sum", v.labelNames, h.labelValues, sum)
+		w.Sample(v.name+"_count", v.labelNames, h.labelValues, float64(count))
+	}
+}
+
+// EmitFunc reports one sample with label values matching the family's label names
+type EmitFunc func(value float64, labelValues ...string)
+
+// FuncCollector reads its samples from state owned elsewhere at scrape time,
+// e.g. queue depth or breaker state
+type FuncCollector struct {
+	family
+	metricType string
+	collect    func(emit EmitFunc)
+}
+
+// NewGaugeFunc creates a gauge family whose samples come from collect
+func NewGaugeFunc(name, help string, labelNames []string, collect func(emit EmitFunc)) *FuncCollector {
+	return &FuncCollector{
+		family:     family{name: name, help: help, labelNames: labelNames},
+		metricType: TypeGauge,
+		collect:    collect,
+	}
+}
+
+// NewCounterFunc creates a counter family whose samples come from collect;
+// the values it reports must only ever grow
+func NewCounterFunc(name, help string, labelNames []string, collect func(emit EmitFunc)) *FuncCollector {
+	return &FuncCollector{
+		family:     family{name: name, help: help, labelNames: labelNames},
+		metricType: TypeCounter,
+		collect:    collect,
+	}
+}
+
+// Collect writes the samples reported by the collect function, ordered by label values
+func (f *FuncCollector) Collect(w *Writer) {
+	type sample struct {
+		key         string
+		labelValues []string
+		value       float64
+	}
+	var samples []sample
+	f.collect(func(value float64, labelValues ...string) {
+		samples = append(samples, sample{
+			key:         f.key(labelValues),
+			labelValues: append([]string(nil), labelValues...),
+			value:       value,
+		})
+	})
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].key < samples[j].key })
+
+	w.Header(f.name, f.help, f.metricType)
+	for _, s := range samples {
+		w.Sample(f.name, f.labelNames, s.labelValues, s.value)
+	}
+}
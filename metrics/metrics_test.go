@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// render writes the collectors through a registry and returns the exposition text
+func render(t *testing.T, collectors ...Collector) string {
+	t.Helper()
+	r := NewRegistry()
+	if err := r.Register(collectors...); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	return out.String()
+}
+
+func TestCounterExposition(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		update func(v *CounterVec)
+		want   string
+	}{
+		{
+			name:   "no series",
+			labels: []string{"bot"},
+			update: func(v *CounterVec) {},
+			want:   "# HELP test_total Test counter.\n# TYPE test_total counter\n",
+		},
+		{
+			name:   "unlabelled",
+			update: func(v *CounterVec) { v.With().Inc(); v.With().Add(2.5) },
+			want:   "# HELP test_total Test counter.\n# TYPE test_total counter\ntest_total 3.5\n",
+		},
+		{
+			name:   "negative add is ignored",
+			update: func(v *CounterVec) { v.With().Inc(); v.With().Add(-4) },
+			want:   "# HELP test_total Test counter.\n# TYPE test_total counter\ntest_total 1\n",
+		},
+		{
+			name:   "series sorted by label values",
+			labels: []string{"bot", "reason"},
+			update: func(v *CounterVec) {
+				v.With("b", "rate").Inc()
+				v.With("a", "rate").Add(3)
+				v.With("a", "circuit").Inc()
+			},
+			want: "# HELP test_total Test counter.\n# TYPE test_total counter\n" +
+				"test_total{bot=\"a\",reason=\"circuit\"} 1\n" +
+				"test_total{bot=\"a\",reason=\"rate\"} 3\n" +
+				"test_total{bot=\"b\",reason=\"rate\"} 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewCounterVec("test_total", "Test counter.", tt.labels...)
+			tt.update(v)
+			if got := render(t, v); got != tt.want {
+				t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistogramExposition(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []float64
+		observe []float64
+		want    string
+	}{
+		{
+			name:    "cumulative buckets",
+			buckets: []float64{0.1, 1},
+			observe: []float64{0.05, 0.1, 0.5, 3},
+			want: "# HELP test_seconds Test histogram.\n# TYPE test_seconds histogram\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"0.1\"} 2\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"1\"} 3\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"+Inf\"} 4\n" +
+				"test_seconds_sum{bot=\"a\"} 3.65\n" +
+				"test_seconds_count{bot=\"a\"} 4\n",
+		},
+		{
+			name:    "unsorted bounds with explicit +Inf",
+			buckets: []float64{math.Inf(1), 2, 0.5},
+			observe: []float64{1},
+			want: "# HELP test_seconds Test histogram.\n# TYPE test_seconds histogram\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"0.5\"} 0\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"2\"} 1\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"+Inf\"} 1\n" +
+				"test_seconds_sum{bot=\"a\"} 1\n" +
+				"test_seconds_count{bot=\"a\"} 1\n",
+		},
+		{
+			name:    "NaN is not observed",
+			buckets: []float64{1},
+			observe: []float64{math.NaN(), 0.5},
+			want: "# HELP test_seconds Test histogram.\n# TYPE test_seconds histogram\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"1\"} 1\n" +
+				"test_seconds_bucket{bot=\"a\",le=\"+Inf\"} 1\n" +
+				"test_seconds_sum{bot=\"a\"} 0.5\n" +
+				"test_seconds_count{bot=\"a\"} 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewHistogramVec("test_seconds", "Test histogram.", tt.buckets, "bot")
+			for _, value := range tt.observe {
+				v.With("a").Observe(value)
+			}
+			if got := render(t, v); got != tt.want {
+				t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	tests := []struct {
+		name  string
+		help  string
+		label string
+		want  string
+	}{
+		{
+			name:  "plain",
+			help:  "Plain help.",
+			label: "bot-1",
+			want:  "# HELP test_total Plain help.\n# TYPE test_total counter\ntest_total{bot=\"bot-1\"} 1\n",
+		},
+		{
+			name:  "quotes only escaped in labels",
+			help:  `Say "hi".`,
+			label: `say "hi"`,
+			want:  "# HELP test_total Say \"hi\".\n# TYPE test_total counter\ntest_total{bot=\"say \\\"hi\\\"\"} 1\n",
+		},
+		{
+			name:  "backslashes and newlines",
+			help:  "C:\\path\nnext",
+			label: "C:\\path\nnext",
+			want:  "# HELP test_total C:\\\\path\\nnext\n# TYPE test_total counter\ntest_total{bot=\"C:\\\\path\\nnext\"} 1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewCounterVec("test_total", tt.help, "bot")
+			v.With(tt.label).Inc()
+			if got := render(t, v); got != tt.want {
+				t.Errorf("exposition mismatch\ngot:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{0, "0"},
+		{42, "42"},
+		{0.25, "0.25"},
+		{1e21, "1e+21"},
+		{math.Inf(1), "+Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   []string
+		wantErr bool
+	}{
+		{name: "unique", names: []string{"a_total", "b_total"}},
+		{name: "colons allowed", names: []string{"ns:a_total"}},
+		{name: "duplicate", names: []string{"a_total", "a_total"}, wantErr: true},
+		{name: "leading digit", names: []string{"1_total"}, wantErr: true},
+		{name: "dash", names: []string{"a-total"}, wantErr: true},
+		{name: "empty", names: []string{""}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			var err error
+			for _, name := range tt.names {
+				if err = r.Register(NewCounterVec(name, "Help.")); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Register error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGatherSkipsHistograms(t *testing.T) {
+	counter := NewCounterVec("test_total", "Counter.", "bot")
+	counter.With(`a"b`).Add(2)
+	gauge := NewGaugeVec("test_depth", "Gauge.")
+	gauge.With().Set(-1)
+	histogram := NewHistogramVec("test_seconds", "Histogram.", DefaultBuckets)
+	histogram.With().Observe(0.2)
+
+	r := NewRegistry()
+	if err := r.Register(counter, gauge, histogram); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	samples := r.Gather()
+
+	want := []struct {
+		key   string
+		typ   string
+		value float64
+	}{
+		{`test_total{bot="a\"b"}`, TypeCounter, 2},
+		{"test_depth", TypeGauge, -1},
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("Gather returned %d samples, want %d: %+v", len(samples), len(want), samples)
+	}
+	for i, w := range want {
+		if samples[i].Key() != w.key || samples[i].Type != w.typ || samples[i].Value != w.value {
+			t.Errorf("sample %d = %s %s %v, want %s %s %v",
+				i, samples[i].Key(), samples[i].Type, samples[i].Value, w.key, w.typ, w.value)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types as written in # TYPE lines
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Collector is a metric family that can write its current samples
+type Collector interface {
+	// Name returns the metric family name
+	Name() string
+
+	// Collect writes the family's HELP and TYPE lines and its samples
+	Collect(w *Writer)
+}
+
+// Registry holds the collectors exposed on the metrics endpoint
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+	names      map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Register adds collectors to the registry; names must be unique
+func (r *Registry) Register(collectors ...Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range collectors {
+		if r.names[c.Name()] {
+			return fmt.Errorf("metric %q is already registered", c.Name())
+		}
+		if !validName(c.Name()) {
+			return fmt.Errorf("invalid metric name %q", c.Name())
+		}
+	}
+	for _, c := range collectors {
+		r.names[c.Name()] = true
+		r.collectors = append(r.collectors, c)
+	}
+	return nil
+}
+
+// WriteText writes every registered family in the text exposition format,
+// in registration order
+func (r *Registry) WriteText(out io.Writer) error {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	w := &Writer{buf: bufio.NewWriter(out)}
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+	return w.buf.Flush()
+}
+
+// Label is a label name and value of a gathered sample
+type Label struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Sample is one counter or gauge series value read from the registry
+type Sample struct {
+	Name   string
+	Type   string
+	Labels []Label
+	Value  float64
+}
+
+// Key identifies the series as it appears in the text format, e.g. name{bot="a"}
+func (s Sample) Key() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	var b strings.Builder
+	b.WriteString(s.Name)
+	b.WriteByte('{')
+	for i, label := range s.Labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabelValue(label.Value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Gather returns the current value of every counter and gauge series.
+// Histograms are left out; their buckets are only useful to a scraper.
+func (r *Registry) Gather() []Sample {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	var samples []Sample
+	w := &Writer{buf: bufio.NewWriter(io.Discard), gathered: &samples}
+	for _, c := range collectors {
+		c.Collect(w)
+	}
+	return samples
+}
+
+// ServeHTTP serves the registry for scraping
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Render first so a failing collector cannot leave a half-written response
+	var body bytes.Buffer
+	if err := r.WriteText(&body); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", ContentType)
+	rw.Write(body.Bytes())
+}
+
+// Writer writes samples in the text exposition format
+type Writer struct {
+	buf        *bufio.Writer
+	gathered   *[]Sample // Set by Gather to also collect samples as values
+	metricType string    // Type of the family being written
+}
+
+// Header writes the HELP and TYPE lines of a family
+func (w *Writer) Header(name, help, metricType string) {
+	w.buf.WriteString("# HELP ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(escapeHelp(help))
+	w.buf.WriteString("\n# TYPE ")
+	w.buf.WriteString(name)
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(metricType)
+	w.buf.WriteByte('\n')
+	w.metricType = metricType
+}
+
+// Sample writes one sample line; names and values pair up by index
+func (w *Writer) Sample(name string, labelNames, labelValues []string, value float64) {
+	if w.gathered != nil && w.metricType != TypeHistogram {
+		labels := make([]Label, len(labelNames))
+		for i, label := range labelNames {
+			labels[i] = Label{Name: label, Value: labelValues[i]}
+		}
+		*w.gathered = append(*w.gathered, Sample{Name: name, Type: w.metricType, Labels: labels, Value: value})
+	}
+
+	w.buf.WriteString(name)
+	if len(labelNames) > 0 {
+		w.buf.WriteByte('{')
+		for i, label := range labelNames {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(label)
+			w.buf.WriteString(`="`)
+			w.buf.WriteString(escapeLabelValue(labelValues[i]))
+			w.buf.WriteByte('"')
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteByte(' ')
+	w.buf.WriteString(formatValue(value))
+	w.buf.WriteByte('\n')
+}
+
+// formatValue renders a sample value, spelling out infinities and NaN
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and newlines in HELP text
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// escapeLabelValue escapes backslashes, newlines and quotes in a label value
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// validName reports whether s is a valid metric or label name
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		letter := c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns a map's keys in order, so scrapes list series stably
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,147 @@
+package ml_trainer
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// seasonSlots is the number of seasonal slots, one per hour of the day
+	seasonSlots = 24
+
+	// seasonWeight is the EWMA weight of each sample in its hour's baseline
+	// once the slot has warmed up; about a day and a half of memory
+	seasonWeight = 0.01
+
+	// residualWeight is the EWMA weight of each residual in the anomaly
+	// score, damping single noisy minutes
+	residualWeight = 0.5
+
+	// varianceWeight is the EWMA weight of each squared residual in the scale
+	varianceWeight = 0.02
+
+	// minScale is the smallest residual standard deviation, in log space,
+	// so perfectly steady traffic does not turn every wobble into an anomaly
+	minScale = 0.1
+
+	// warmupSamples is how many minutes a slot learns before it scores
+	warmupSamples = 30
+
+	// anomalyZ is the smoothed residual z-score beyond which a minute is anomalous
+	anomalyZ = 4.0
+
+	// sustainSamples is how many consecutive anomalous minutes in the same
+	// direction make a regime change rather than a spike
+	sustainSamples = 5
+)
+
+// seasonalModel forecasts log1p of a per-minute series from an hour-of-day
+// seasonal baseline and scores the EWMA of its residuals. Anomalous samples
+// are clipped to the edge of the normal band before they update the
+// baseline, so a spike barely moves it while a lasting shift keeps scoring.
+type seasonalModel struct {
+	baseline [seasonSlots]float64
+	samples  [seasonSlots]int
+	residual float64 // EWMA of residuals
+	variance float64 // EWMA of squared residuals
+	last     float64 // Latest observation, seeds slots not seen yet
+	seen     bool
+}
+
+// scale returns the residual standard deviation
+func (m *seasonalModel) scale() float64 {
+	return math.Max(math.Sqrt(m.variance), minScale)
+}
+
+// update scores y against the slot's baseline, then fits the baseline to it.
+// The z-score is zero while the slot is still warming up.
+func (m *seasonalModel) update(y float64, slot int) (expected, z float64) {
+	if m.samples[slot] == 0 {
+		// An hour not seen yet starts from the latest value
+		m.baseline[slot] = y
+		if m.seen {
+			m.baseline[slot] = m.last
+		}
+	}
+	m.last, m.seen = y, true
+
+	expected = m.baseline[slot]
+	residual := y - expected
+	warm := m.samples[slot] >= warmupSamples
+	m.samples[slot]++
+	if !warm {
+		// Running mean until the slot has enough samples to score
+		m.baseline[slot] += (y - m.baseline[slot]) / float64(m.samples[slot])
+		return expected, 0
+	}
+
+	scale := m.scale()
+	m.residual = residualWeight*residual + (1-residualWeight)*m.residual
+	z = m.residual / scale
+
+	// Fit to the clipped value so outliers cannot drag the baseline, and
+	// keep them out of the scale so a lasting shift cannot hide itself
+	band := anomalyZ * scale
+	clipped := math.Max(-band, math.Min(band, residual))
+	m.baseline[slot] += seasonWeight * clipped
+	if clipped == residual {
+		m.variance = varianceWeight*residual*residual + (1-varianceWeight)*m.variance
+	}
+	return expected, z
+}
+
+// rebase shifts every slot by the current residual, keeping the daily shape
+// but accepting the new level as normal
+func (m *seasonalModel) rebase() {
+	for i := range m.baseline {
+		m.baseline[i] += m.residual
+	}
+	m.residual = 0
+}
+
+// feature is one monitored series with its model and anomaly streak
+type feature struct {
+	name      string
+	model     seasonalModel
+	value     float64 // Latest observation in its own units
+	expected  float64 // Latest forecast in the same units
+	z         float64 // Latest smoothed residual z-score
+	streak    int     // Consecutive anomalous minutes in the current direction
+	direction int     // +1 above, -1 below the forecast
+}
+
+// observe scores a new per-minute value and updates the anomaly streak
+func (f *feature) observe(value float64, slot int) {
+	expected, z := f.model.update(math.Log1p(value), slot)
+	f.value, f.expected, f.z = value, math.Expm1(expected), z
+
+	switch {
+	case math.Abs(z) < anomalyZ:
+		f.streak, f.direction = 0, 0
+	case int(math.Copysign(1, z)) == f.direction:
+		f.streak++
+	default:
+		f.streak, f.direction = 1, int(math.Copysign(1, z))
+	}
+}
+
+// sustained reports whether the feature has been anomalous long enough to be a regime change
+func (f *feature) sustained() bool {
+	return f.streak >= sustainSamples
+}
+
+// reason describes the feature's shift for the logs
+func (f *feature) reason() string {
+	verb := "rose"
+	if f.direction < 0 {
+		verb = "fell"
+	}
+	return fmt.Sprintf("%s %s to %.1f (expected %.1f, z=%.1f) for %d minutes",
+		f.name, verb, f.value, f.expected, f.z, f.streak)
+}
+
+// rebase accepts the feature's current level as its new normal
+func (f *feature) rebase() {
+	f.model.rebase()
+	f.streak, f.direction = 0, 0
+}
@@ -2,54 +2,153 @@ package ml_trainer
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"go.uber.org/zap"
+
+	"qqbotrouter/metrics"
 	"qqbotrouter/stats"
 )
 
-// MLTrainer defines, trains, and runs the LSTM autoencoder model.
+const (
+	// sampleInterval is how often traffic is sampled and scored
+	sampleInterval = time.Minute
+
+	// regimeCooldown is the least time between two regime changes
+	regimeCooldown = 15 * time.Minute
+)
+
+// MLTrainer watches per-minute message counts, active users and forward
+// latency for traffic regime changes. Each series is compared with an
+// hour-of-day seasonal baseline; when the smoothed residual stays far outside
+// its usual spread for several minutes the traffic regime has changed, and
+// the StatsAnalyzer is told to rebuild its behaviour baselines.
 type MLTrainer struct {
 	statsAnalyzer *stats.StatsAnalyzer
-	// Add fields for the LSTM model, data, etc.
+
+	mu           sync.Mutex
+	features     []*feature // Messages, active users and latency, in that order
+	lastArrivals int64
+	lastSwitch   time.Time
+
+	regimeChanges *metrics.CounterVec
 }
 
 // NewMLTrainer creates a new MLTrainer.
 func NewMLTrainer(statsAnalyzer *stats.StatsAnalyzer) *MLTrainer {
 	return &MLTrainer{
 		statsAnalyzer: statsAnalyzer,
+		features: []*feature{
+			{name: "messages_per_minute"},
+			{name: "active_users"},
+			{name: "latency_ms"},
+		},
+		lastArrivals: statsAnalyzer.GetArrivalTotal(),
+		regimeChanges: metrics.NewCounterVec("qqbotrouter_regime_changes_total",
+			"Traffic regime changes detected, by the feature that shifted.", "feature"),
+	}
+}
+
+// trainModel samples the last minute of traffic, scores it against each
+// feature's model and signals a mode switch on a sustained shift
+func (m *MLTrainer) trainModel(now time.Time) {
+	arrivals := m.statsAnalyzer.GetArrivalTotal()
+	activeUsers := m.statsAnalyzer.GetActiveUsers(sampleInterval)
+	latency := m.statsAnalyzer.GetAverageResponseTime()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := arrivals - m.lastArrivals
+	m.lastArrivals = arrivals
+	slot := now.Hour()
+
+	values := []float64{float64(messages), float64(activeUsers), float64(latency) / float64(time.Millisecond)}
+	for i, f := range m.features {
+		if f.name == "latency_ms" && latency == 0 {
+			continue // Nothing forwarded yet
+		}
+		f.observe(values[i], slot)
+		if f.streak == 1 {
+			zap.L().Debug("Traffic anomaly",
+				zap.String("feature", f.name),
+				zap.Float64("value", f.value),
+				zap.Float64("expected", f.expected),
+				zap.Float64("z", f.z))
+		}
+	}
+
+	var reasons []string
+	for _, f := range m.features {
+		if f.sustained() {
+			reasons = append(reasons, f.reason())
+		}
 	}
+	if len(reasons) == 0 || now.Sub(m.lastSwitch) < regimeCooldown {
+		return
+	}
+
+	for _, f := range m.features {
+		if f.sustained() {
+			m.regimeChanges.With(f.name).Inc()
+		}
+	}
+	for _, f := range m.features {
+		f.rebase()
+	}
+	m.lastSwitch = now
+	m.statsAnalyzer.ModeSwitched()
+
+	zap.L().Warn("Traffic regime change detected, resetting behaviour baselines",
+		zap.Strings("reasons", reasons))
 }
 
-// trainModel implements the ML training logic
-func (m *MLTrainer) trainModel() {
-	// 1. Collect time series data (e.g., message count, active users)
-	// 2. Preprocess the data
-	// 3. Feed the data into the LSTM autoencoder
-	// 4. Calculate the reconstruction error
-	// 5. If the error is high, signal a mode switch
-	// m.statsAnalyzer.ModeSwitched()
+// anomalyScores returns the latest residual z-score of each feature
+func (m *MLTrainer) anomalyScores() map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scores := make(map[string]float64, len(m.features))
+	for _, f := range m.features {
+		scores[f.name] = f.z
+	}
+	return scores
+}
 
-	// TODO: Implement actual ML training logic
+// RegisterMetrics exposes anomaly scores and regime changes on the registry
+func (m *MLTrainer) RegisterMetrics(registry *metrics.Registry) error {
+	return registry.Register(
+		m.regimeChanges,
+		metrics.NewGaugeFunc("qqbotrouter_traffic_anomaly_score",
+			"Latest residual z-score of each traffic feature against its seasonal forecast.",
+			[]string{"feature"},
+			func(emit metrics.EmitFunc) {
+				for name, z := range m.anomalyScores() {
+					emit(z, name)
+				}
+			}),
+	)
 }
 
 // Run starts the ML trainer with context support
 func (m *MLTrainer) Run(ctx context.Context) error {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(sampleInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ticker.C:
-			m.trainModel()
+		case now := <-ticker.C:
+			m.trainModel(now)
 		}
 	}
 }
 
 // GetTickerInterval returns the interval for periodic execution
 func (m *MLTrainer) GetTickerInterval() string {
-	return "5m"
+	return "1m"
 }
 
 // RunWithContext starts the ML trainer with context support (deprecated, use Run instead)
@@ -60,8 +159,8 @@ func (m *MLTrainer) RunWithContext(ctx context.Context, ticker *time.Ticker) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			m.trainModel()
+		case now := <-ticker.C:
+			m.trainModel(now)
 		}
 	}
 }
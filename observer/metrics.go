@@ -0,0 +1,39 @@
+package observer
+
+import (
+	"time"
+
+	"qqbotrouter/metrics"
+)
+
+// RegisterMetrics exposes the high-load threshold and load of every bot and destination
+func (o *Observer) RegisterMetrics(registry *metrics.Registry) error {
+	each := func(emit func(scope, name string, s SeriesStatus)) {
+		status := o.Status()
+		emit("overall", "", status.Overall)
+		for botID, s := range status.Bots {
+			emit("bot", botID, s)
+		}
+		for destination, s := range status.Destinations {
+			emit("destination", destination, s)
+		}
+	}
+	return registry.Register(
+		metrics.NewGaugeFunc("qqbotrouter_latency_threshold_seconds",
+			"High-load latency threshold derived from each scope's latency history (P95).",
+			[]string{"scope", "name"},
+			func(emit metrics.EmitFunc) {
+				each(func(scope, name string, s SeriesStatus) {
+					emit((time.Duration(s.ThresholdMS) * time.Millisecond).Seconds(), scope, name)
+				})
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_observed_load",
+			"Recent latency as a fraction of the high-load threshold, per scope.",
+			[]string{"scope", "name"},
+			func(emit metrics.EmitFunc) {
+				each(func(scope, name string, s SeriesStatus) {
+					emit(s.Load, scope, name)
+				})
+			}),
+	)
+}
@@ -6,28 +6,101 @@ import (
 	"time"
 
 	"qqbotrouter/interfaces"
-
-	"github.com/montanaflynn/stats"
+	"qqbotrouter/sketch"
 )
 
 // Ensure Observer implements Observer interface
 var _ interfaces.Observer = (*Observer)(nil)
 
-// Observer monitors request latency and adjusts the high-load threshold.
+const (
+	// recentHalfLife is how quickly latencies lose weight in the current load
+	recentHalfLife = 30 * time.Second
+
+	// baselineHalfLife is how quickly latencies lose weight in the high-load threshold
+	baselineHalfLife = 10 * time.Minute
+
+	// idleAfter is how long a bot or destination may go without samples
+	// before its series is forgotten
+	idleAfter = time.Hour
+
+	// minRecentWeight is the decayed sample count below which a series is
+	// treated as idle and reports no load
+	minRecentWeight = 1.0
+)
+
+// latencySeries tracks the latencies of one scope: all traffic, a bot or a destination
+type latencySeries struct {
+	recent    *sketch.Quantiles // Latencies in milliseconds, weighted to the last minute or so
+	baseline  *sketch.Quantiles // Latencies in milliseconds, weighted to the last tens of minutes
+	threshold time.Duration     // P95 of the baseline, zero until enough samples were seen
+	lastSeen  time.Time
+}
+
+// newLatencySeries creates an empty series
+func newLatencySeries() *latencySeries {
+	return &latencySeries{
+		recent:   sketch.New(recentHalfLife),
+		baseline: sketch.New(baselineHalfLife),
+	}
+}
+
+// record adds a latency sample
+func (s *latencySeries) record(latency time.Duration, now time.Time) {
+	ms := float64(latency) / float64(time.Millisecond)
+	s.recent.Add(ms, now)
+	s.baseline.Add(ms, now)
+	s.lastSeen = now
+}
+
+// refresh recomputes the threshold once the baseline holds minDataPoints samples
+func (s *latencySeries) refresh(now time.Time, minDataPoints int) {
+	if s.baseline.Count(now) < float64(minDataPoints) {
+		return
+	}
+	s.threshold = time.Duration(s.baseline.Quantile(0.95) * float64(time.Millisecond))
+}
+
+// load returns the recent mean latency as a fraction of the threshold (0.0 to 1.0)
+func (s *latencySeries) load(now time.Time) float64 {
+	if s.threshold <= 0 || s.recent.Count(now) < minRecentWeight {
+		return 0
+	}
+	thresholdMs := float64(s.threshold) / float64(time.Millisecond)
+	return min(s.recent.Mean()/thresholdMs, 1.0)
+}
+
+// SeriesStatus reports the latency state of one scope
+type SeriesStatus struct {
+	ThresholdMS  int64   `json:"threshold_ms"`   // High-load threshold, the P95 of the baseline
+	RecentMeanMS float64 `json:"recent_mean_ms"` // Mean of recent latencies
+	Load         float64 `json:"load"`           // Recent mean as a fraction of the threshold
+}
+
+// Status reports the overall latency state and that of each bot and destination
+type Status struct {
+	Overall      SeriesStatus            `json:"overall"`
+	Bots         map[string]SeriesStatus `json:"bots"`
+	Destinations map[string]SeriesStatus `json:"destinations"`
+}
+
+// Observer monitors request latency overall, per bot and per destination, and
+// derives each one's high-load threshold from its own latency history.
 type Observer struct {
-	mutex             sync.RWMutex
-	latencies         []float64
-	highLoadThreshold time.Duration
-	latencyThreshold  time.Duration
-	minDataPoints     int
+	mutex         sync.RWMutex
+	overall       *latencySeries
+	bots          map[string]*latencySeries
+	destinations  map[string]*latencySeries
+	minDataPoints int
 }
 
-// NewObserver creates a new Observer.
-func NewObserver(latencyThreshold time.Duration, minDataPoints int) *Observer {
+// NewObserver creates a new Observer. A threshold is only computed once a
+// series has seen minDataPoints latencies.
+func NewObserver(minDataPoints int) *Observer {
 	return &Observer{
-		latencies:        make([]float64, 0, 1000),
-		latencyThreshold: latencyThreshold,
-		minDataPoints:    minDataPoints,
+		overall:       newLatencySeries(),
+		bots:          make(map[string]*latencySeries),
+		destinations:  make(map[string]*latencySeries),
+		minDataPoints: minDataPoints,
 	}
 }
 
@@ -35,8 +108,31 @@ func NewObserver(latencyThreshold time.Duration, minDataPoints int) *Observer {
 func (o *Observer) RecordLatency(latency time.Duration) {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
+	o.overall.record(latency, time.Now())
+}
 
-	o.latencies = append(o.latencies, float64(latency.Milliseconds()))
+// RecordBotLatency records how long one of a bot's events took to process
+func (o *Observer) RecordBotLatency(botID string, latency time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	seriesFor(o.bots, botID).record(latency, time.Now())
+}
+
+// RecordDestinationLatency records how long a destination took to answer a forward
+func (o *Observer) RecordDestinationLatency(destination string, latency time.Duration) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	seriesFor(o.destinations, destination).record(latency, time.Now())
+}
+
+// seriesFor returns the series for a key, creating it on first use
+func seriesFor(series map[string]*latencySeries, key string) *latencySeries {
+	s, ok := series[key]
+	if !ok {
+		s = newLatencySeries()
+		series[key] = s
+	}
+	return s
 }
 
 // HighLoadThreshold returns the current high-load threshold.
@@ -44,7 +140,7 @@ func (o *Observer) HighLoadThreshold() time.Duration {
 	o.mutex.RLock()
 	defer o.mutex.RUnlock()
 
-	return o.highLoadThreshold
+	return o.overall.threshold
 }
 
 // GetCurrentLoad returns the current system load based on recent latencies
@@ -52,27 +148,62 @@ func (o *Observer) GetCurrentLoad() float64 {
 	o.mutex.RLock()
 	defer o.mutex.RUnlock()
 
-	if len(o.latencies) == 0 {
-		return 0.0
+	return o.overall.load(time.Now())
+}
+
+// BotLoad returns a bot's recent latency as a fraction of its own high-load
+// threshold, or 0 if the bot has too little history
+func (o *Observer) BotLoad(botID string) float64 {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	s, ok := o.bots[botID]
+	if !ok {
+		return 0
 	}
+	return s.load(time.Now())
+}
+
+// DestinationLoad returns a destination's recent latency as a fraction of its
+// own high-load threshold, or 0 if it has too little history
+func (o *Observer) DestinationLoad(destination string) float64 {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
 
-	// Calculate load as the ratio of current average latency to threshold
-	var sum float64
-	for _, latency := range o.latencies {
-		sum += latency
+	s, ok := o.destinations[destination]
+	if !ok {
+		return 0
 	}
-	avgLatency := sum / float64(len(o.latencies))
-	thresholdMs := float64(o.latencyThreshold.Milliseconds())
+	return s.load(time.Now())
+}
+
+// Status returns the latency state overall, per bot and per destination
+func (o *Observer) Status() Status {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
 
-	if thresholdMs == 0 {
-		return 0.0
+	now := time.Now()
+	status := Status{
+		Overall:      seriesStatus(o.overall, now),
+		Bots:         make(map[string]SeriesStatus, len(o.bots)),
+		Destinations: make(map[string]SeriesStatus, len(o.destinations)),
 	}
+	for botID, s := range o.bots {
+		status.Bots[botID] = seriesStatus(s, now)
+	}
+	for destination, s := range o.destinations {
+		status.Destinations[destination] = seriesStatus(s, now)
+	}
+	return status
+}
 
-	load := avgLatency / thresholdMs
-	if load > 1.0 {
-		return 1.0
+// seriesStatus summarises a series
+func seriesStatus(s *latencySeries, now time.Time) SeriesStatus {
+	return SeriesStatus{
+		ThresholdMS:  s.threshold.Milliseconds(),
+		RecentMeanMS: s.recent.Mean(),
+		Load:         s.load(now),
 	}
-	return load
 }
 
 // Run starts the observer with context support
@@ -108,23 +239,21 @@ func (o *Observer) RunWithContext(ctx context.Context, ticker *time.Ticker) {
 	}
 }
 
-// updateHighLoadThreshold calculates the P95 latency and updates the threshold.
+// updateHighLoadThreshold recalculates the P95 threshold of every series and
+// forgets bots and destinations that have gone idle.
 func (o *Observer) updateHighLoadThreshold() {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 
-	if len(o.latencies) < o.minDataPoints {
-		return
-	}
-
-	p95, err := stats.Percentile(o.latencies, 95)
-	if err != nil {
-		// Handle error, e.g., log it
-		return
+	now := time.Now()
+	o.overall.refresh(now, o.minDataPoints)
+	for _, series := range []map[string]*latencySeries{o.bots, o.destinations} {
+		for key, s := range series {
+			if now.Sub(s.lastSeen) > idleAfter {
+				delete(series, key)
+				continue
+			}
+			s.refresh(now, o.minDataPoints)
+		}
 	}
-
-	o.highLoadThreshold = time.Duration(p95) * time.Millisecond
-
-	// Reset latencies after calculation
-	o.latencies = make([]float64, 0, 1000)
 }
@@ -0,0 +1,190 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default QQ Bot OpenAPI endpoints
+const (
+	DefaultTokenURL = "https://bots.qq.com/app/getAppAccessToken"
+	DefaultAPIURL   = "https://api.sgroup.qq.com"
+)
+
+// tokenRefreshMargin is how long before expiry a cached access token is renewed
+const tokenRefreshMargin = 60 * time.Second
+
+// ReplyTarget identifies the conversation and message a passive reply answers
+type ReplyTarget struct {
+	EventType string
+	UserID    string
+	GroupID   string
+	GuildID   string
+	ChannelID string
+	MessageID string
+}
+
+// accessToken is a cached app access token
+type accessToken struct {
+	value   string
+	expires time.Time
+}
+
+// Client sends messages through the QQ Bot OpenAPI, caching access tokens per app
+type Client struct {
+	tokenURL   string
+	apiURL     string
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]accessToken
+}
+
+// NewClient creates a new Client using the public OpenAPI endpoints
+func NewClient(timeout time.Duration) *Client {
+	return NewClientWithEndpoints(DefaultTokenURL, DefaultAPIURL, timeout)
+}
+
+// NewClientWithEndpoints creates a new Client using the given token and API endpoints
+func NewClientWithEndpoints(tokenURL, apiURL string, timeout time.Duration) *Client {
+	return &Client{
+		tokenURL:   tokenURL,
+		apiURL:     apiURL,
+		httpClient: &http.Client{Timeout: timeout},
+		tokens:     make(map[string]accessToken),
+	}
+}
+
+// Reply sends a passive text reply to the message described by target
+func (c *Client) Reply(ctx context.Context, appID, clientSecret string, target ReplyTarget, content string) error {
+	path, payload, err := replyRequest(target, content)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.token(ctx, appID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode reply: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create reply request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "QQBot "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("reply rejected with status %d: %s", resp.StatusCode, detail)
+	}
+	return nil
+}
+
+// replyRequest picks the API path and payload for a passive reply to the event type
+func replyRequest(target ReplyTarget, content string) (string, map[string]interface{}, error) {
+	switch target.EventType {
+	case "GROUP_AT_MESSAGE_CREATE", "GROUP_MESSAGE_CREATE":
+		if target.GroupID == "" {
+			return "", nil, fmt.Errorf("group reply needs a group openid")
+		}
+		return "/v2/groups/" + target.GroupID + "/messages", v2Reply(target, content), nil
+	case "C2C_MESSAGE_CREATE":
+		if target.UserID == "" {
+			return "", nil, fmt.Errorf("c2c reply needs a user openid")
+		}
+		return "/v2/users/" + target.UserID + "/messages", v2Reply(target, content), nil
+	case "AT_MESSAGE_CREATE", "MESSAGE_CREATE":
+		if target.ChannelID == "" {
+			return "", nil, fmt.Errorf("channel reply needs a channel id")
+		}
+		return "/channels/" + target.ChannelID + "/messages", map[string]interface{}{
+			"content": content,
+			"msg_id":  target.MessageID,
+		}, nil
+	case "DIRECT_MESSAGE_CREATE":
+		if target.GuildID == "" {
+			return "", nil, fmt.Errorf("direct message reply needs a guild id")
+		}
+		return "/dms/" + target.GuildID + "/messages", map[string]interface{}{
+			"content": content,
+			"msg_id":  target.MessageID,
+		}, nil
+	default:
+		return "", nil, fmt.Errorf("cannot reply to event type %q", target.EventType)
+	}
+}
+
+// v2Reply builds the payload of a group or C2C text reply
+func v2Reply(target ReplyTarget, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"content":  content,
+		"msg_type": 0,
+		"msg_id":   target.MessageID,
+		"msg_seq":  1,
+	}
+}
+
+// token returns a valid access token for the app, fetching a new one when needed
+func (c *Client) token(ctx context.Context, appID, clientSecret string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.tokens[appID]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"appId": appID, "clientSecret": clientSecret})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch access token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("access token request failed with status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string          `json:"access_token"`
+		ExpiresIn   json.RawMessage `json:"expires_in"` // Sent as a string, accepted as a number too
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("access token response has no token")
+	}
+
+	seconds, err := strconv.Atoi(string(bytes.Trim(result.ExpiresIn, `"`)))
+	if err != nil {
+		seconds = 0
+	}
+	expires := time.Now().Add(time.Duration(seconds)*time.Second - tokenRefreshMargin)
+
+	c.mu.Lock()
+	c.tokens[appID] = accessToken{value: result.AccessToken, expires: expires}
+	c.mu.Unlock()
+	return result.AccessToken, nil
+}
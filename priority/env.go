@@ -0,0 +1,121 @@
+package priority
+
+import (
+	"time"
+
+	"qqbotrouter/interfaces"
+)
+
+// RuleEnv exposes an event to rule expressions. Variables:
+//
+//	bot, bot.id, user, user.id, user.requests_1m, user.requests_10m,
+//	user.tier, user.messages_per_day, user.burstiness, user.error_rate,
+//	user.hour_share (only defined once the user has a profile),
+//	group, group.id, guild, guild.id, channel, channel.id,
+//	event.type, event.id, message.id,
+//	message, message.content, message.length, content.type, load, error_rate, hour,
+//	spam.score (only defined once a trained spam model scored the message),
+//	attachments.count, attachments.images, attachments.videos, attachments.audio,
+//	attachments.files, attachments.size, has.markdown, has.ark, has.embed
+type RuleEnv struct {
+	Input *Input
+	Stats interfaces.StatProvider
+	Lists map[string]map[string]bool
+}
+
+// Lookup implements rules.Env
+func (e *RuleEnv) Lookup(name string) (interface{}, bool) {
+	in := e.Input
+	switch name {
+	case "bot", "bot.id":
+		return in.BotID, true
+	case "user", "user.id":
+		return in.UserID, true
+	case "user.requests_1m":
+		if e.Stats != nil {
+			return float64(e.Stats.GetUserRequestCount(in.UserID, time.Minute)), true
+		}
+	case "user.requests_10m":
+		if e.Stats != nil {
+			return float64(e.Stats.GetUserRequestCount(in.UserID, 10*time.Minute)), true
+		}
+	case "user.tier", "user.messages_per_day", "user.burstiness", "user.error_rate", "user.hour_share":
+		if e.Stats != nil {
+			if profile, ok := e.Stats.GetUserProfile(in.UserID); ok {
+				return profileVariable(profile, name), true
+			}
+		}
+	case "group", "group.id":
+		return in.Info.GroupID, true
+	case "guild", "guild.id":
+		return in.Info.GuildID, true
+	case "channel", "channel.id":
+		return in.Info.ChannelID, true
+	case "event.type":
+		return in.EventType, true
+	case "event.id":
+		return in.Info.EventID, true
+	case "message.id":
+		return in.Info.MessageID, true
+	case "message", "message.content":
+		return in.Message, true
+	case "message.length":
+		return float64(len([]rune(in.Message))), true
+	case "content.type":
+		return in.ContentType, true
+	case "spam.score":
+		if in.SpamScored {
+			return in.SpamScore, true
+		}
+	case "attachments.count":
+		return float64(in.Info.Attachments.Count), true
+	case "attachments.images":
+		return float64(in.Info.Attachments.Images), true
+	case "attachments.videos":
+		return float64(in.Info.Attachments.Videos), true
+	case "attachments.audio":
+		return float64(in.Info.Attachments.Audio), true
+	case "attachments.files":
+		return float64(in.Info.Attachments.Files), true
+	case "attachments.size":
+		return float64(in.Info.Attachments.TotalSize), true
+	case "has.markdown":
+		return in.Info.Attachments.HasMarkdown, true
+	case "has.ark":
+		return in.Info.Attachments.HasArk, true
+	case "has.embed":
+		return in.Info.Attachments.HasEmbed, true
+	case "hour":
+		return float64(in.Received.Hour()), true
+	case "load":
+		if e.Stats != nil {
+			return e.Stats.GetSystemLoad(), true
+		}
+	case "error_rate":
+		if e.Stats != nil {
+			return e.Stats.GetErrorRate(), true
+		}
+	}
+	return nil, false
+}
+
+// profileVariable returns the user.* variable backed by a behaviour profile
+func profileVariable(profile interfaces.UserProfile, name string) interface{} {
+	switch name {
+	case "user.tier":
+		return profile.Tier
+	case "user.messages_per_day":
+		return profile.DailyMessages
+	case "user.burstiness":
+		return profile.Burstiness
+	case "user.error_rate":
+		return profile.ErrorRate
+	default:
+		return profile.HourShare
+	}
+}
+
+// InList implements rules.Env
+func (e *RuleEnv) InList(list, value string) bool {
+	return e.Lists[list][value]
+}
@@ -0,0 +1,196 @@
+package priority
+
+import (
+	"sync"
+	"time"
+
+	"qqbotrouter/config"
+	"qqbotrouter/interfaces"
+	"qqbotrouter/utils"
+)
+
+// recentDecisionLimit bounds how many decisions are kept for inspection
+const recentDecisionLimit = 200
+
+// Input is the event information available to scoring stages
+type Input struct {
+	BotID       string
+	UserID      string
+	Message     string
+	EventType   string
+	ContentType string
+	Info        utils.MessageInfo
+	Received    time.Time
+	SpamScore   float64 // Probability the message is spam, valid when SpamScored
+	SpamScored  bool    // A trained spam model scored the message
+}
+
+// Env is the shared state scoring stages read from
+type Env struct {
+	Config *config.SchedulerConfig
+	Stats  interfaces.StatProvider
+}
+
+// Stage is one pluggable step of the priority pipeline. It returns the
+// adjustment it applies on top of the running score and a short reason.
+type Stage interface {
+	Name() string
+	Score(input *Input, env *Env) (delta int, reason string)
+}
+
+// PinningStage is a stage that can also set the score outright, as an
+// operator rule with an "=N" action does. When pinned is true the score
+// becomes the base priority plus delta and no further stages run. Only a
+// pinned score can place an event in a throttle-exempt class.
+type PinningStage interface {
+	Stage
+	ScoreOrPin(input *Input, env *Env) (delta int, reason string, pinned bool)
+}
+
+// StageResult records one stage's contribution to a decision
+type StageResult struct {
+	Stage  string `json:"stage"`
+	Delta  int    `json:"delta"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Decision is the priority computed once for an event, with the per-stage breakdown
+type Decision struct {
+	BotID          string        `json:"bot_id"`
+	UserID         string        `json:"user_id"`
+	EventType      string        `json:"event_type,omitempty"`
+	ContentType    string        `json:"content_type,omitempty"`
+	Base           int           `json:"base"`
+	Priority       int           `json:"priority"`
+	Class          string        `json:"class,omitempty"`
+	ThrottleExempt bool          `json:"throttle_exempt,omitempty"`
+	Pinned         bool          `json:"pinned,omitempty"` // An operator rule set the priority outright
+	Clamped        bool          `json:"clamped,omitempty"`
+	SpamScore      *float64      `json:"spam_score,omitempty"` // Nil when no spam model scored the event
+	Stages         []StageResult `json:"stages"`
+	At             time.Time     `json:"at"`
+}
+
+// Pipeline runs scoring stages in order and keeps recent decisions for inspection.
+type Pipeline struct {
+	mu     sync.RWMutex
+	stages []Stage
+	recent []Decision
+	next   int
+}
+
+// NewPipeline creates a pipeline with the given stages.
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{
+		stages: stages,
+		recent: make([]Decision, 0, recentDecisionLimit),
+	}
+}
+
+// SetStages replaces the pipeline's stages
+func (p *Pipeline) SetStages(stages ...Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = stages
+}
+
+// Evaluate scores an event starting from the configured base priority and
+// clamps the result to the configured range.
+func (p *Pipeline) Evaluate(input *Input, env *Env) *Decision {
+	p.mu.RLock()
+	stages := p.stages
+	p.mu.RUnlock()
+
+	settings := env.Config.PrioritySettings
+	decision := &Decision{
+		BotID:       input.BotID,
+		UserID:      input.UserID,
+		EventType:   input.EventType,
+		ContentType: input.ContentType,
+		Base:        settings.BasePriority,
+		Stages:      make([]StageResult, 0, len(stages)),
+		At:          input.Received,
+	}
+	if input.SpamScored {
+		spamScore := input.SpamScore
+		decision.SpamScore = &spamScore
+	}
+
+	score := settings.BasePriority
+	for _, stage := range stages {
+		delta, reason, pinned := scoreStage(stage, input, env)
+		if pinned {
+			// A pinned score replaces everything before it and ends the pipeline
+			delta = settings.BasePriority + delta - score
+		} else if delta == 0 && reason == "" {
+			continue
+		}
+		score += delta
+		decision.Stages = append(decision.Stages, StageResult{
+			Stage:  stage.Name(),
+			Delta:  delta,
+			Reason: reason,
+		})
+		if pinned {
+			decision.Pinned = true
+			break
+		}
+	}
+
+	// Ensure priority is within valid range
+	if score < settings.MinPriority {
+		score = settings.MinPriority
+		decision.Clamped = true
+	} else if score > settings.MaxPriority {
+		score = settings.MaxPriority
+		decision.Clamped = true
+	}
+	decision.Priority = score
+
+	// Attach the priority class so throttling and scheduling agree on it. A
+	// computed score can reach any class from message content alone, so
+	// throttle exemption needs an operator rule to have pinned the score.
+	decision.Class = config.DefaultPriorityClass
+	if class, ok := env.Config.PriorityClass(score); ok {
+		decision.Class = class.Name
+		decision.ThrottleExempt = class.ThrottleExempt && decision.Pinned
+	}
+
+	p.record(decision)
+	return decision
+}
+
+// scoreStage runs one stage, asking pinning stages whether they pin the score
+func scoreStage(stage Stage, input *Input, env *Env) (int, string, bool) {
+	if pinning, ok := stage.(PinningStage); ok {
+		return pinning.ScoreOrPin(input, env)
+	}
+	delta, reason := stage.Score(input, env)
+	return delta, reason, false
+}
+
+// record keeps a copy of the decision in the recent ring buffer
+func (p *Pipeline) record(decision *Decision) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.recent) < recentDecisionLimit {
+		p.recent = append(p.recent, *decision)
+		return
+	}
+	p.recent[p.next] = *decision
+	p.next = (p.next + 1) % recentDecisionLimit
+}
+
+// Recent returns the most recent decisions, newest first
+func (p *Pipeline) Recent() []Decision {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	result := make([]Decision, 0, len(p.recent))
+	for i := 0; i < len(p.recent); i++ {
+		idx := (p.next - 1 - i + 2*len(p.recent)) % len(p.recent)
+		result = append(result, p.recent[idx])
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package priority
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	"qqbotrouter/interfaces"
+	"qqbotrouter/utils"
+)
+
+// KeywordStage pushes spam to the bottom of the range and messages with
+// priority keywords to the top. Spam is judged by the classifier's score when
+// a trained model scored the message, and by spam keywords otherwise.
+type KeywordStage struct{}
+
+func (s *KeywordStage) Name() string { return "keywords" }
+
+func (s *KeywordStage) Score(input *Input, env *Env) (int, string) {
+	classification := env.Config.MessageClassification
+	if !classification.Enabled {
+		return 0, ""
+	}
+
+	span := env.Config.PrioritySettings.MaxPriority - env.Config.PrioritySettings.MinPriority
+	if classification.SpamDetection {
+		if input.SpamScored {
+			if penalty := spamPenalty(input.SpamScore, classification.SpamThreshold, span); penalty < 0 {
+				return penalty, fmt.Sprintf("spam score %.2f", input.SpamScore)
+			}
+		} else if utils.IsSpamPattern(input.Message, classification.SpamKeywords) {
+			return -span, "spam pattern"
+		}
+	}
+	if utils.IsHighPriorityMessage(input.Message, classification.PriorityKeywords) {
+		return span, "priority keyword"
+	}
+	return 0, ""
+}
+
+// spamPenalty scales the spam penalty from nothing at a score of 0.5 to the
+// whole priority span at the threshold and above
+func spamPenalty(score, threshold float64, span int) int {
+	if score <= 0.5 {
+		return 0
+	}
+	if threshold <= 0.5 || score >= threshold {
+		return -span
+	}
+	return -int(float64(span) * (score - 0.5) / (threshold - 0.5))
+}
+
+// UserTierStage rewards users whose profile classifies them as active and
+// penalises users flooding the analysis window, by the fast user bonus.
+type UserTierStage struct{}
+
+func (s *UserTierStage) Name() string { return "user_tier" }
+
+func (s *UserTierStage) Score(input *Input, env *Env) (int, string) {
+	if !env.Config.UserBehaviorAnalysis.Enabled || env.Stats == nil {
+		return 0, ""
+	}
+	profile, ok := env.Stats.GetUserProfile(input.UserID)
+	if !ok {
+		return 0, ""
+	}
+	switch profile.Tier {
+	case interfaces.UserTierActive:
+		return env.Config.PrioritySettings.FastUserBonus, "active user"
+	case interfaces.UserTierFlooding:
+		return -env.Config.PrioritySettings.FastUserBonus, "flooding user"
+	}
+	return 0, ""
+}
+
+// intervalHistoryLimit bounds how many users' last request times are kept;
+// the least recently seen users are forgotten first
+const intervalHistoryLimit = 10000
+
+// RequestIntervalStage penalises users whose messages arrive much faster than
+// the P50 message interval baseline.
+type RequestIntervalStage struct {
+	mu       sync.Mutex
+	maxUsers int
+	users    map[string]*list.Element
+	lru      *list.List // Most recently seen first, holding *lastRequest
+}
+
+// lastRequest is the time of a user's most recent request
+type lastRequest struct {
+	userID string
+	at     time.Time
+}
+
+// NewRequestIntervalStage creates a new RequestIntervalStage.
+func NewRequestIntervalStage() *RequestIntervalStage {
+	return &RequestIntervalStage{
+		maxUsers: intervalHistoryLimit,
+		users:    make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (s *RequestIntervalStage) Name() string { return "request_interval" }
+
+func (s *RequestIntervalStage) Score(input *Input, env *Env) (int, string) {
+	lastRequestTime, exists := s.swapLastRequest(input.UserID, input.Received)
+
+	if !exists {
+		return 0, ""
+	}
+
+	requestInterval := input.Received.Sub(lastRequestTime)
+	p50Baseline := env.Stats.P50()
+	penalty := env.Config.PrioritySettings.HighLoadAdjustment
+	if penalty > 0 {
+		penalty = -penalty
+	}
+
+	// If user's request interval is much shorter than P50 baseline, consider it spam
+	if p50Baseline > 0 && requestInterval < p50Baseline/3 {
+		return penalty * 2, "interval below P50/3"
+	} else if p50Baseline > 0 && requestInterval < p50Baseline/2 {
+		return penalty, "interval below P50/2"
+	}
+	return 0, ""
+}
+
+// swapLastRequest records a user's request time and returns the previous one,
+// evicting the least recently seen user once the history is full
+func (s *RequestIntervalStage) swapLastRequest(userID string, at time.Time) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.users[userID]; ok {
+		entry := elem.Value.(*lastRequest)
+		previous := entry.at
+		entry.at = at
+		s.lru.MoveToFront(elem)
+		return previous, true
+	}
+
+	s.users[userID] = s.lru.PushFront(&lastRequest{userID: userID, at: at})
+	for s.lru.Len() > s.maxUsers {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.users, oldest.Value.(*lastRequest).userID)
+	}
+	return time.Time{}, false
+}
+
+// Reset clears the per-user request history
+func (s *RequestIntervalStage) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = make(map[string]*list.Element)
+	s.lru.Init()
+}
@@ -0,0 +1,59 @@
+package priority
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestIntervalHistory(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxUsers  int
+		users     []string // Users seen in order, one second apart
+		retry     string   // User seen again afterwards
+		wantKnown bool     // Whether the retried user's previous request is remembered
+		wantLen   int
+	}{
+		{name: "within capacity keeps history", maxUsers: 3, users: []string{"a", "b", "c"}, retry: "a", wantKnown: true, wantLen: 3},
+		{name: "oldest is evicted", maxUsers: 2, users: []string{"a", "b", "c"}, retry: "a", wantLen: 2},
+		{name: "newest survives eviction", maxUsers: 2, users: []string{"a", "b", "c"}, retry: "c", wantKnown: true, wantLen: 2},
+		{name: "a request refreshes recency", maxUsers: 2, users: []string{"a", "b", "a", "c"}, retry: "a", wantKnown: true, wantLen: 2},
+		{name: "refreshed user pushes out the other", maxUsers: 2, users: []string{"a", "b", "a", "c"}, retry: "b", wantLen: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewRequestIntervalStage()
+			s.maxUsers = tt.maxUsers
+			start := time.Unix(1700000000, 0)
+			for i, user := range tt.users {
+				s.swapLastRequest(user, start.Add(time.Duration(i)*time.Second))
+			}
+
+			// The remembered time is the retried user's latest request
+			var want time.Time
+			for i, user := range tt.users {
+				if user == tt.retry {
+					want = start.Add(time.Duration(i) * time.Second)
+				}
+			}
+			got, known := s.swapLastRequest(tt.retry, start.Add(time.Minute))
+			if known != tt.wantKnown || (known && !got.Equal(want)) {
+				t.Errorf("previous request of %q = %v, %v; want %v, %v", tt.retry, got, known, want, tt.wantKnown)
+			}
+			if len(s.users) != tt.wantLen || s.lru.Len() != tt.wantLen {
+				t.Errorf("history holds %d users (%d in LRU), want %d", len(s.users), s.lru.Len(), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestRequestIntervalReset(t *testing.T) {
+	s := NewRequestIntervalStage()
+	now := time.Unix(1700000000, 0)
+	s.swapLastRequest("a", now)
+	s.Reset()
+	if _, known := s.swapLastRequest("a", now); known {
+		t.Error("history survived Reset")
+	}
+}
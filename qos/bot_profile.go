@@ -0,0 +1,145 @@
+package qos
+
+import (
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/ratelimit"
+)
+
+// botQoS is the QoS configuration and state of one bot. Each bot has its own
+// breaker, buckets and concurrency limit so a noisy bot cannot throttle others.
+type botQoS struct {
+	cfg         *config.QoSConfig
+	profiled    bool // cfg is the bot's own profile rather than the global config
+	limiter     *ratelimit.Limiter
+	breaker     *CircuitBreaker
+	concurrency *ConcurrencyLimiter
+	load        loadFactor // Scales the concurrency limit under dynamic load balancing
+}
+
+// newBotQoS creates the state of a bot with the given configuration
+func newBotQoS(cfg *config.QoSConfig, profiled bool, logger *zap.Logger) *botQoS {
+	return &botQoS{
+		cfg:         cfg,
+		profiled:    profiled,
+		limiter:     ratelimit.NewLimiter(cfg.RateLimits.MaxEntries),
+		breaker:     NewCircuitBreaker(breakerSettingsFrom(cfg)),
+		concurrency: newConcurrencyLimiterFrom(cfg, logger),
+	}
+}
+
+// newConcurrencyLimiterFrom creates a concurrency limiter from the adaptive throttling settings
+func newConcurrencyLimiterFrom(cfg *config.QoSConfig, logger *zap.Logger) *ConcurrencyLimiter {
+	settings := cfg.AdaptiveThrottling
+	algorithm, err := NewLimitAlgorithm(cfg)
+	if err != nil {
+		logger.Error("Invalid concurrency limit algorithm, falling back to gradient", zap.Error(err))
+		algorithm = NewGradientLimit(settings.Tolerance, settings.AdaptationRate)
+	}
+	return NewConcurrencyLimiter(algorithm, settings.InitialLimit, settings.MinLimit, settings.MaxLimit)
+}
+
+// reconfigure applies a new configuration, resetting only the state whose settings changed
+func (b *botQoS) reconfigure(botID string, cfg *config.QoSConfig, profiled bool, logger *zap.Logger) {
+	old := b.cfg
+	b.cfg = cfg
+	b.profiled = profiled
+
+	// Apply circuit breaker settings, resetting its state if the trip conditions changed
+	resetBreaker := old.CircuitBreaker.Enabled != cfg.CircuitBreaker.Enabled ||
+		old.CircuitBreaker.FailureThreshold != cfg.CircuitBreaker.FailureThreshold ||
+		old.CircuitBreaker.FailureRate != cfg.CircuitBreaker.FailureRate ||
+		old.CircuitBreaker.Window != cfg.CircuitBreaker.Window
+	b.breaker.Configure(breakerSettingsFrom(cfg), resetBreaker)
+	if resetBreaker {
+		logger.Info("Circuit breaker configuration updated, resetting state", zap.String("bot_id", botID))
+	}
+
+	// Start a fresh concurrency limiter if its settings changed; requests
+	// already admitted release their slots on the old limiter
+	if old.AdaptiveThrottling != cfg.AdaptiveThrottling {
+		b.concurrency = newConcurrencyLimiterFrom(cfg, logger)
+		logger.Info("Adaptive throttling configuration updated, resetting concurrency limit", zap.String("bot_id", botID))
+	}
+
+	// Rebuild the bucket table if its bound changed; rates apply on the next request
+	if old.RateLimits.MaxEntries != cfg.RateLimits.MaxEntries {
+		b.limiter = ratelimit.NewLimiter(cfg.RateLimits.MaxEntries)
+		logger.Info("Rate limit table size updated, resetting buckets",
+			zap.String("bot_id", botID),
+			zap.Int("max_entries", cfg.RateLimits.MaxEntries))
+	}
+}
+
+// SetBotProfiles sets the QoS configuration of bots that override the global
+// settings, as returned by config.Config.BotQoSProfiles. Other bots use the
+// global configuration.
+func (qm *QoSManager) SetBotProfiles(profiles map[string]config.QoSConfig) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	qm.setProfilesLocked(profiles)
+	qm.reconfigureBotsLocked()
+}
+
+// setProfilesLocked stores copies of the bot profiles; qm.mu must be held
+func (qm *QoSManager) setProfilesLocked(profiles map[string]config.QoSConfig) {
+	qm.profiles = make(map[string]*config.QoSConfig, len(profiles))
+	for botID, profile := range profiles {
+		profile := profile
+		qm.profiles[botID] = &profile
+
+		// A value inherited from the global configuration was already reported
+		if profile.DynamicLoadBalancing.LoadThreshold != qm.qosConfig.DynamicLoadBalancing.LoadThreshold {
+			qm.warnLegacyLoadThreshold(botID, &profile)
+		}
+	}
+}
+
+// configFor returns the configuration that applies to a bot; qm.mu must be held
+func (qm *QoSManager) configFor(botID string) (*config.QoSConfig, bool) {
+	if profile, ok := qm.profiles[botID]; ok {
+		return profile, true
+	}
+	return qm.qosConfig, false
+}
+
+// bot returns a bot's QoS state, creating it on first use; qm.mu must be held
+func (qm *QoSManager) bot(botID string) *botQoS {
+	qm.botsMu.Lock()
+	defer qm.botsMu.Unlock()
+
+	if b, ok := qm.bots[botID]; ok {
+		return b
+	}
+	cfg, profiled := qm.configFor(botID)
+	b := newBotQoS(cfg, profiled, qm.logger)
+	b.breaker.Subscribe(func(event BreakerEvent) {
+		qm.onBreakerTransition(botID, event)
+	})
+	qm.bots[botID] = b
+	return b
+}
+
+// reconfigureBotsLocked applies the current global config and profiles to every bot; qm.mu must be held
+func (qm *QoSManager) reconfigureBotsLocked() {
+	qm.botsMu.Lock()
+	defer qm.botsMu.Unlock()
+
+	for botID, b := range qm.bots {
+		cfg, profiled := qm.configFor(botID)
+		b.reconfigure(botID, cfg, profiled, qm.logger)
+	}
+}
+
+// snapshotBots returns the current bot states keyed by bot ID
+func (qm *QoSManager) snapshotBots() map[string]*botQoS {
+	qm.botsMu.Lock()
+	defer qm.botsMu.Unlock()
+
+	bots := make(map[string]*botQoS, len(qm.bots))
+	for botID, b := range qm.bots {
+		bots[botID] = b
+	}
+	return bots
+}
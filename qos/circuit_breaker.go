@@ -0,0 +1,328 @@
+package qos
+
+import (
+	"sync"
+	"time"
+
+	"qqbotrouter/config"
+)
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // Requests flow normally
+	BreakerOpen                         // Requests are rejected until the recovery timeout passes
+	BreakerHalfOpen                     // A limited number of trial requests probe for recovery
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state by name
+func (s BreakerState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// BreakerEvent describes a circuit breaker state transition
+type BreakerEvent struct {
+	From        BreakerState `json:"from"`
+	To          BreakerState `json:"to"`
+	Reason      string       `json:"reason"`
+	At          time.Time    `json:"at"`
+	FailureRate float64      `json:"failure_rate"`
+	Failures    int          `json:"failures"`
+	Requests    int          `json:"requests"`
+}
+
+// BreakerStatus is a snapshot of a circuit breaker
+type BreakerStatus struct {
+	State       BreakerState   `json:"state"`
+	Since       time.Time      `json:"since"`
+	FailureRate float64        `json:"failure_rate"`
+	Failures    int            `json:"failures"`
+	Requests    int            `json:"requests"`
+	Trials      int            `json:"trials"`
+	Transitions []BreakerEvent `json:"transitions"`
+}
+
+// breakerSettings holds the parsed circuit breaker configuration
+type breakerSettings struct {
+	failureThreshold int
+	failureRate      float64
+	window           time.Duration
+	recoveryTimeout  time.Duration
+	halfOpenRequests int
+}
+
+// breakerSettingsFrom parses the circuit breaker section of the QoS configuration
+func breakerSettingsFrom(cfg *config.QoSConfig) breakerSettings {
+	settings := breakerSettings{
+		failureThreshold: cfg.CircuitBreaker.FailureThreshold,
+		failureRate:      cfg.CircuitBreaker.FailureRate,
+		window:           config.ParseDurationOrDefault(cfg.CircuitBreaker.Window, 60*time.Second),
+		recoveryTimeout:  config.ParseDurationOrDefault(cfg.CircuitBreaker.RecoveryTimeout, 30*time.Second),
+		halfOpenRequests: cfg.CircuitBreaker.HalfOpenRequests,
+	}
+	if settings.failureThreshold < 1 {
+		settings.failureThreshold = 1
+	}
+	if settings.halfOpenRequests < 1 {
+		settings.halfOpenRequests = 1
+	}
+	return settings
+}
+
+const (
+	breakerBuckets     = 10 // Number of buckets the rolling window is split into
+	breakerEventsLimit = 50 // Number of recent transitions kept for inspection
+)
+
+// outcomeBucket counts request outcomes for one slice of the rolling window
+type outcomeBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// CircuitBreaker is a closed/open/half-open breaker driven by the failure
+// rate over a rolling window. While half-open it admits a limited number of
+// trial requests; one failure reopens it and enough successes close it.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	settings  breakerSettings
+	state     BreakerState
+	changedAt time.Time
+	buckets   [breakerBuckets]outcomeBucket
+
+	// Half-open trial accounting
+	trials         int
+	trialSuccesses int
+
+	listeners []func(BreakerEvent)
+	events    []BreakerEvent
+}
+
+// NewCircuitBreaker creates a new closed CircuitBreaker
+func NewCircuitBreaker(settings breakerSettings) *CircuitBreaker {
+	return &CircuitBreaker{
+		settings:  settings,
+		state:     BreakerClosed,
+		changedAt: time.Now(),
+	}
+}
+
+// Subscribe registers a function called after every state transition
+func (cb *CircuitBreaker) Subscribe(listener func(BreakerEvent)) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.listeners = append(cb.listeners, listener)
+}
+
+// Allow reports whether a request may pass and whether it is a trial. While
+// half-open each allowed request takes one of the trial slots.
+func (cb *CircuitBreaker) Allow() (allowed, trial bool) {
+	cb.mu.Lock()
+	now := time.Now()
+	var event *BreakerEvent
+
+	if cb.state == BreakerOpen && now.Sub(cb.changedAt) >= cb.settings.recoveryTimeout {
+		event = cb.transitionLocked(BreakerHalfOpen, "recovery timeout elapsed", now)
+	}
+
+	allowed = true
+	switch cb.state {
+	case BreakerOpen:
+		allowed = false
+	case BreakerHalfOpen:
+		// Trials whose outcome never arrived would block recovery forever,
+		// so the slots are handed out again after another recovery timeout
+		if cb.trials >= cb.settings.halfOpenRequests && now.Sub(cb.changedAt) >= cb.settings.recoveryTimeout {
+			cb.trials = cb.trialSuccesses
+			cb.changedAt = now
+		}
+		if cb.trials < cb.settings.halfOpenRequests {
+			cb.trials++
+			trial = true
+		} else {
+			allowed = false
+		}
+	}
+	cb.mu.Unlock()
+
+	cb.publish(event)
+	return allowed, trial
+}
+
+// Record records the outcome of an allowed request; trial is what Allow
+// reported for it
+func (cb *CircuitBreaker) Record(success, trial bool) {
+	cb.mu.Lock()
+	now := time.Now()
+	var event *BreakerEvent
+
+	switch cb.state {
+	case BreakerClosed:
+		cb.addOutcomeLocked(success, now)
+		failures, requests := cb.totalsLocked(now)
+		if failures >= cb.settings.failureThreshold && float64(failures)/float64(requests) >= cb.settings.failureRate {
+			event = cb.transitionLocked(BreakerOpen, "failure rate above threshold", now)
+		}
+	case BreakerHalfOpen:
+		if !trial {
+			// Only trial requests decide whether the breaker recovers
+			break
+		}
+		if !success {
+			event = cb.transitionLocked(BreakerOpen, "trial request failed", now)
+			break
+		}
+		cb.trialSuccesses++
+		if cb.trialSuccesses >= cb.settings.halfOpenRequests {
+			event = cb.transitionLocked(BreakerClosed, "trial requests succeeded", now)
+		}
+	case BreakerOpen:
+		// Outcomes of requests admitted before the breaker opened carry no new information
+	}
+	cb.mu.Unlock()
+
+	cb.publish(event)
+}
+
+// Configure applies new settings; when reset is true the breaker also returns to closed
+func (cb *CircuitBreaker) Configure(settings breakerSettings, reset bool) {
+	cb.mu.Lock()
+	cb.settings = settings
+	var event *BreakerEvent
+	if reset {
+		now := time.Now()
+		if cb.state != BreakerClosed {
+			event = cb.transitionLocked(BreakerClosed, "configuration changed", now)
+		}
+		cb.buckets = [breakerBuckets]outcomeBucket{}
+	}
+	cb.mu.Unlock()
+
+	cb.publish(event)
+}
+
+// State returns the current state
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// Status returns a snapshot of the breaker and its recent transitions
+func (cb *CircuitBreaker) Status() BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	failures, requests := cb.totalsLocked(time.Now())
+	status := BreakerStatus{
+		State:       cb.state,
+		Since:       cb.changedAt,
+		Failures:    failures,
+		Requests:    requests,
+		Trials:      cb.trials,
+		Transitions: append([]BreakerEvent(nil), cb.events...),
+	}
+	if requests > 0 {
+		status.FailureRate = float64(failures) / float64(requests)
+	}
+	return status
+}
+
+// transitionLocked moves the breaker to a new state and returns the event to publish; cb.mu must be held
+func (cb *CircuitBreaker) transitionLocked(to BreakerState, reason string, now time.Time) *BreakerEvent {
+	failures, requests := cb.totalsLocked(now)
+	event := BreakerEvent{
+		From:     cb.state,
+		To:       to,
+		Reason:   reason,
+		At:       now,
+		Failures: failures,
+		Requests: requests,
+	}
+	if requests > 0 {
+		event.FailureRate = float64(failures) / float64(requests)
+	}
+
+	cb.state = to
+	cb.changedAt = now
+	cb.trials = 0
+	cb.trialSuccesses = 0
+	if to == BreakerClosed {
+		// Start the closed state with a clean window so old failures cannot reopen it
+		cb.buckets = [breakerBuckets]outcomeBucket{}
+	}
+
+	cb.events = append(cb.events, event)
+	if len(cb.events) > breakerEventsLimit {
+		cb.events = cb.events[len(cb.events)-breakerEventsLimit:]
+	}
+	return &event
+}
+
+// publish delivers an event to the listeners outside the breaker lock
+func (cb *CircuitBreaker) publish(event *BreakerEvent) {
+	if event == nil {
+		return
+	}
+	cb.mu.Lock()
+	listeners := make([]func(BreakerEvent), len(cb.listeners))
+	copy(listeners, cb.listeners)
+	cb.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(*event)
+	}
+}
+
+// bucketWidth returns the span of time covered by one bucket
+func (cb *CircuitBreaker) bucketWidth() time.Duration {
+	width := cb.settings.window / breakerBuckets
+	if width <= 0 {
+		width = time.Second
+	}
+	return width
+}
+
+// addOutcomeLocked counts an outcome in the bucket covering now; cb.mu must be held
+func (cb *CircuitBreaker) addOutcomeLocked(success bool, now time.Time) {
+	width := cb.bucketWidth()
+	start := now.Truncate(width)
+	bucket := &cb.buckets[(now.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = outcomeBucket{start: start}
+	}
+	if success {
+		bucket.successes++
+	} else {
+		bucket.failures++
+	}
+}
+
+// totalsLocked sums the outcomes inside the rolling window; cb.mu must be held
+func (cb *CircuitBreaker) totalsLocked(now time.Time) (failures, requests int) {
+	oldest := now.Add(-cb.settings.window)
+	for _, bucket := range cb.buckets {
+		if bucket.start.IsZero() || !bucket.start.After(oldest) {
+			continue
+		}
+		failures += bucket.failures
+		requests += bucket.successes + bucket.failures
+	}
+	return failures, requests
+}
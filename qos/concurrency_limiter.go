@@ -0,0 +1,197 @@
+package qos
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"qqbotrouter/config"
+)
+
+// LimitSample is one measurement fed to a LimitAlgorithm
+type LimitSample struct {
+	Latency  time.Duration // Forward latency of the delivery
+	InFlight int           // Requests in flight when the sample was taken
+	Dropped  bool          // The delivery failed on every destination
+}
+
+// LimitAlgorithm derives a new concurrency limit from the current one and a latency sample
+type LimitAlgorithm interface {
+	Update(limit float64, sample LimitSample) float64
+}
+
+// AIMDLimit grows the limit by one per sample while latency stays under the
+// target and cuts it by a constant ratio when a sample is slow or dropped.
+type AIMDLimit struct {
+	latencyTarget time.Duration
+	backoffRatio  float64
+}
+
+// NewAIMDLimit creates a new AIMDLimit
+func NewAIMDLimit(latencyTarget time.Duration, backoffRatio float64) *AIMDLimit {
+	if backoffRatio <= 0 || backoffRatio >= 1 {
+		backoffRatio = 0.9
+	}
+	return &AIMDLimit{latencyTarget: latencyTarget, backoffRatio: backoffRatio}
+}
+
+// Update implements LimitAlgorithm
+func (a *AIMDLimit) Update(limit float64, sample LimitSample) float64 {
+	if sample.Dropped || sample.Latency > a.latencyTarget {
+		return limit * a.backoffRatio
+	}
+	// Only grow while the limit is actually being used
+	if float64(sample.InFlight)*2 >= limit {
+		return limit + 1
+	}
+	return limit
+}
+
+// GradientLimit compares each sample against a slowly moving latency
+// baseline. While latency stays within the tolerance the limit grows by a
+// queue allowance of sqrt(limit); when latency rises the limit shrinks in
+// proportion, as in Netflix's gradient2 limiter.
+type GradientLimit struct {
+	tolerance float64
+	smoothing float64
+	baseline  float64 // Long-term latency EWMA in nanoseconds
+}
+
+// gradientBaselineWeight is the weight of each sample in the long-term latency baseline
+const gradientBaselineWeight = 2.0 / 601.0
+
+// NewGradientLimit creates a new GradientLimit
+func NewGradientLimit(tolerance, smoothing float64) *GradientLimit {
+	if tolerance < 1 {
+		tolerance = 1.5
+	}
+	if smoothing <= 0 || smoothing > 1 {
+		smoothing = 0.2
+	}
+	return &GradientLimit{tolerance: tolerance, smoothing: smoothing}
+}
+
+// Update implements LimitAlgorithm
+func (g *GradientLimit) Update(limit float64, sample LimitSample) float64 {
+	latency := float64(sample.Latency)
+	if latency <= 0 {
+		return limit
+	}
+	if g.baseline == 0 {
+		g.baseline = latency
+	} else {
+		g.baseline = g.baseline*(1-gradientBaselineWeight) + latency*gradientBaselineWeight
+	}
+
+	// After a long slow period let the baseline recover instead of pinning the limit low
+	if g.baseline/latency > 2 {
+		g.baseline *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1.0, g.tolerance*g.baseline/latency))
+	if sample.Dropped {
+		gradient = 0.5
+	}
+	newLimit := limit*gradient + math.Sqrt(limit)
+	newLimit = limit*(1-g.smoothing) + newLimit*g.smoothing
+
+	// Don't grow the limit while it is not being used
+	if newLimit > limit && float64(sample.InFlight) < limit/2 {
+		return limit
+	}
+	return newLimit
+}
+
+// NewLimitAlgorithm creates the limit algorithm selected by the adaptive throttling configuration
+func NewLimitAlgorithm(cfg *config.QoSConfig) (LimitAlgorithm, error) {
+	settings := cfg.AdaptiveThrottling
+	switch settings.Algorithm {
+	case "", "gradient":
+		return NewGradientLimit(settings.Tolerance, settings.AdaptationRate), nil
+	case "aimd":
+		return NewAIMDLimit(config.ParseDurationOrDefault(settings.LatencyTarget, 2*time.Second), settings.BackoffRatio), nil
+	default:
+		return nil, fmt.Errorf("unknown concurrency limit algorithm %q", settings.Algorithm)
+	}
+}
+
+// ConcurrencyStatus is a snapshot of a concurrency limiter
+type ConcurrencyStatus struct {
+	Limit    int `json:"limit"`
+	InFlight int `json:"in_flight"`
+}
+
+// ConcurrencyLimiter bounds the number of requests in flight and adjusts the
+// bound from observed forward latency.
+type ConcurrencyLimiter struct {
+	mu        sync.Mutex
+	algorithm LimitAlgorithm
+	limit     float64
+	minLimit  float64
+	maxLimit  float64
+	inFlight  int
+}
+
+// NewConcurrencyLimiter creates a new ConcurrencyLimiter
+func NewConcurrencyLimiter(algorithm LimitAlgorithm, initialLimit, minLimit, maxLimit int) *ConcurrencyLimiter {
+	if minLimit < 1 {
+		minLimit = 1
+	}
+	if maxLimit < minLimit {
+		maxLimit = minLimit
+	}
+	limiter := &ConcurrencyLimiter{
+		algorithm: algorithm,
+		minLimit:  float64(minLimit),
+		maxLimit:  float64(maxLimit),
+	}
+	limiter.limit = limiter.clamp(float64(initialLimit))
+	return limiter
+}
+
+// Acquire takes a slot if fewer than share of the limit are in flight.
+// Passing a share below 1 keeps headroom for more important requests.
+func (l *ConcurrencyLimiter) Acquire(share float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if float64(l.inFlight) >= math.Max(1, l.limit*share) {
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+// Release returns a slot taken by Acquire
+func (l *ConcurrencyLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight > 0 {
+		l.inFlight--
+	}
+}
+
+// Observe feeds a forward latency sample to the algorithm and updates the limit
+func (l *ConcurrencyLimiter) Observe(latency time.Duration, success bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = l.clamp(l.algorithm.Update(l.limit, LimitSample{
+		Latency:  latency,
+		InFlight: l.inFlight,
+		Dropped:  !success,
+	}))
+}
+
+// Status returns the current limit and in-flight count
+func (l *ConcurrencyLimiter) Status() ConcurrencyStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return ConcurrencyStatus{Limit: int(l.limit), InFlight: l.inFlight}
+}
+
+// clamp keeps a limit within the configured bounds
+func (l *ConcurrencyLimiter) clamp(limit float64) float64 {
+	return math.Max(l.minLimit, math.Min(l.maxLimit, limit))
+}
@@ -0,0 +1,150 @@
+package qos
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+)
+
+const (
+	// minLoadFactor is the smallest share of its concurrency limit an overloaded bot keeps
+	minLoadFactor = 0.2
+
+	// defaultAdjustmentFactor is the load factor step when none is configured
+	defaultAdjustmentFactor = 0.1
+)
+
+// loadFactor scales a bot's concurrency limit under dynamic load balancing.
+// It is 1 while the bot's observed latency stays under its threshold.
+type loadFactor struct {
+	bits uint64 // float64 bits, accessed atomically; zero means 1
+}
+
+// get returns the current factor
+func (f *loadFactor) get() float64 {
+	bits := atomic.LoadUint64(&f.bits)
+	if bits == 0 {
+		return 1
+	}
+	return math.Float64frombits(bits)
+}
+
+// set stores a new factor
+func (f *loadFactor) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+// LoadStatus reports a bot's observed load and the resulting admission factor
+type LoadStatus struct {
+	Load       float64 `json:"load"`       // Recent latency relative to the bot's own high-load threshold
+	Factor     float64 `json:"factor"`     // Share of the concurrency limit currently admitted
+	Overloaded bool    `json:"overloaded"` // Load is above dynamic_load_balancing.load_threshold
+}
+
+// adjustLoadFactors steps each bot's load factor down while the observer
+// reports its load above the configured threshold and back up once it recovers
+func (qm *QoSManager) adjustLoadFactors() {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	for botID, b := range qm.snapshotBots() {
+		settings := b.cfg.DynamicLoadBalancing
+		old := b.load.get()
+		if !settings.Enabled || qm.observer == nil {
+			if old != 1 {
+				b.load.set(1)
+			}
+			continue
+		}
+
+		step := settings.AdjustmentFactor
+		if step <= 0 {
+			step = defaultAdjustmentFactor
+		}
+		load := qm.observer.BotLoad(botID)
+		threshold := loadThreshold(b.cfg)
+		factor := old
+		if load > threshold {
+			factor = math.Max(minLoadFactor, old-step)
+		} else {
+			factor = math.Min(1, old+step)
+		}
+		if factor == old {
+			continue
+		}
+		b.load.set(factor)
+
+		if factor < old {
+			qm.logger.Warn("Bot latency above its high-load threshold, reducing admitted concurrency",
+				zap.String("bot_id", botID),
+				zap.Float64("load", load),
+				zap.Float64("load_threshold", threshold),
+				zap.Float64("factor", factor))
+		} else {
+			qm.logger.Info("Bot latency back under its high-load threshold, restoring admitted concurrency",
+				zap.String("bot_id", botID),
+				zap.Float64("load", load),
+				zap.Float64("factor", factor))
+		}
+	}
+}
+
+// loadThreshold returns the load above which a bot counts as overloaded, as a
+// fraction of its P95. Values above 1 are millisecond thresholds from before
+// the threshold was relative; they cannot be converted and take the default.
+func loadThreshold(cfg *config.QoSConfig) float64 {
+	if threshold := cfg.DynamicLoadBalancing.LoadThreshold; threshold <= 1 {
+		return threshold
+	}
+	return config.GetDefaultQoSConfig().DynamicLoadBalancing.LoadThreshold
+}
+
+// warnLegacyLoadThreshold logs a load_threshold still written in milliseconds;
+// botID is empty for the global configuration
+func (qm *QoSManager) warnLegacyLoadThreshold(botID string, cfg *config.QoSConfig) {
+	settings := cfg.DynamicLoadBalancing
+	if !settings.Enabled || settings.LoadThreshold <= 1 {
+		return
+	}
+	fields := []zap.Field{
+		zap.Float64("load_threshold", settings.LoadThreshold),
+		zap.Float64("using", loadThreshold(cfg)),
+	}
+	if botID != "" {
+		fields = append(fields, zap.String("bot_id", botID))
+	}
+	qm.logger.Warn("dynamic_load_balancing.load_threshold is a fraction of each bot's P95 latency (0.0 to 1.0), "+
+		"not milliseconds; ignoring the configured value", fields...)
+}
+
+// loadBalancingInterval returns how often load factors are adjusted
+func (qm *QoSManager) loadBalancingInterval() time.Duration {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	interval := config.ParseDurationOrDefault(qm.qosConfig.DynamicLoadBalancing.MonitoringInterval, 30*time.Second)
+	if interval <= 0 {
+		return 30 * time.Second
+	}
+	return interval
+}
+
+// LoadStatus returns the observed load and admission factor of each bot
+func (qm *QoSManager) LoadStatus() map[string]LoadStatus {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	status := make(map[string]LoadStatus)
+	for botID, b := range qm.snapshotBots() {
+		s := LoadStatus{Factor: b.load.get()}
+		if qm.observer != nil {
+			s.Load = qm.observer.BotLoad(botID)
+		}
+		s.Overloaded = b.cfg.DynamicLoadBalancing.Enabled && s.Load > loadThreshold(b.cfg)
+		status[botID] = s
+	}
+	return status
+}
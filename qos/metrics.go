@@ -0,0 +1,61 @@
+package qos
+
+import (
+	"qqbotrouter/metrics"
+)
+
+// breakerStates lists every breaker state, so each bot exposes one series per state
+var breakerStates = []BreakerState{BreakerClosed, BreakerOpen, BreakerHalfOpen}
+
+// RegisterMetrics exposes throttle counts, breaker state and concurrency limits on the registry
+func (qm *QoSManager) RegisterMetrics(registry *metrics.Registry) error {
+	return registry.Register(
+		qm.throttledTotal,
+		metrics.NewGaugeFunc("qqbotrouter_circuit_breaker_state",
+			"Circuit breaker state per bot; the series for the current state is 1.",
+			[]string{"bot", "state"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range qm.BreakerStatus() {
+					for _, state := range breakerStates {
+						current := 0.0
+						if status.State == state {
+							current = 1
+						}
+						emit(current, botID, state.String())
+					}
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_circuit_breaker_failure_rate",
+			"Failure rate in each bot's circuit breaker window.",
+			[]string{"bot"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range qm.BreakerStatus() {
+					emit(status.FailureRate, botID)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_load_factor",
+			"Share of each bot's concurrency limit admitted under dynamic load balancing.",
+			[]string{"bot"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range qm.LoadStatus() {
+					emit(status.Factor, botID)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_concurrency_limit",
+			"Adaptive concurrency limit per bot.",
+			[]string{"bot"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range qm.ConcurrencyStatus() {
+					emit(float64(status.Limit), botID)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_concurrency_in_flight",
+			"Requests holding a concurrency slot per bot.",
+			[]string{"bot"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range qm.ConcurrencyStatus() {
+					emit(float64(status.InFlight), botID)
+				}
+			}),
+	)
+}
@@ -1,35 +1,80 @@
 package qos
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"math"
+	"net/http"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"qqbotrouter/config"
 	"qqbotrouter/interfaces"
+	"qqbotrouter/metrics"
+	"qqbotrouter/ratelimit"
 )
 
+// Reasons reported when a request is throttled
+const (
+	ThrottleReasonCircuitOpen = "circuit_open"
+	ThrottleReasonConcurrency = "concurrency_limit"
+	ThrottleReasonUserRate    = "user_rate_limit"
+	ThrottleReasonGroupRate   = "group_rate_limit"
+	ThrottleReasonBotRate     = "bot_rate_limit"
+)
+
+// Admission describes an incoming event asking to be accepted
+type Admission struct {
+	BotID          string
+	UserID         string
+	GroupID        string // Group openid, or channel ID for guild messages
+	Priority       int
+	Class          string
+	ThrottleExempt bool // Skip the circuit breaker and concurrency limit; rate limits still apply
+}
+
+// AdmissionResult is the outcome of an admission check
+type AdmissionResult struct {
+	Throttled bool
+	Reason    string // One of the ThrottleReason constants when throttled
+
+	slot    *ConcurrencyLimiter // Concurrency slot held by an admitted request
+	breaker *CircuitBreaker     // Breaker that admitted the request, nil if it was skipped
+	trial   bool                // The request is one of the breaker's half-open trials
+}
+
+// Done releases the concurrency slot held by an admitted request once its
+// delivery has finished. It is safe to call on throttled results.
+func (r AdmissionResult) Done() {
+	if r.slot != nil {
+		r.slot.Release()
+	}
+}
+
 // QoSManager manages Quality of Service policies
 type QoSManager struct {
-	qosConfig          *config.QoSConfig
-	loadProvider       interfaces.LoadProvider
-	statsProvider      interfaces.StatProvider
-	observer           interfaces.Observer
-	logger             *zap.Logger
-	mu                 sync.RWMutex
-	throttlingStrategy ThrottlingStrategy // Strategy for adaptive throttling
-
-	// Circuit breaker state
-	circuitOpen     bool
-	circuitOpenTime time.Time
-	failureCount    int
-
-	// Adaptive throttling state
-	throttleLevel  float64 // 0.0 to 1.0
-	lastAdjustment time.Time
-
-	// Performance metrics
+	qosConfig     *config.QoSConfig
+	loadProvider  interfaces.LoadProvider
+	statsProvider interfaces.StatProvider
+	observer      interfaces.Observer
+	logger        *zap.Logger
+	mu            sync.RWMutex
+	profiles      map[string]*config.QoSConfig // Bots with their own QoS configuration
+
+	// Throttled request counts by reason
+	countsMu       sync.Mutex
+	throttleCounts map[string]int64
+	throttledTotal *metrics.CounterVec // Throttled requests by bot and reason, for scraping
+
+	// Breakers, buckets and concurrency limits, isolated per bot
+	botsMu sync.Mutex
+	bots   map[string]*botQoS
+
+	// Performance metrics, guarded by perfMu so recording a delivery does not
+	// contend with admission
+	perfMu          sync.Mutex
 	responseTimeP50 time.Duration
 	responseTimeP90 time.Duration
 	throughput      float64
@@ -37,170 +82,248 @@ type QoSManager struct {
 
 // NewQoSManager creates a new QoS manager
 func NewQoSManager(qosConfig *config.QoSConfig, loadProvider interfaces.LoadProvider, statsProvider interfaces.StatProvider, observer interfaces.Observer, logger *zap.Logger) *QoSManager {
-	return &QoSManager{
-		qosConfig:          qosConfig,
-		loadProvider:       loadProvider,
-		statsProvider:      statsProvider,
-		observer:           observer,
-		logger:             logger,
-		throttleLevel:      0.0,
-		lastAdjustment:     time.Now(),
-		throttlingStrategy: NewAdaptiveThrottlingStrategy(0.7, 0.3), // Default strategy
+	qm := &QoSManager{
+		qosConfig:      qosConfig,
+		loadProvider:   loadProvider,
+		statsProvider:  statsProvider,
+		observer:       observer,
+		logger:         logger,
+		profiles:       make(map[string]*config.QoSConfig),
+		bots:           make(map[string]*botQoS),
+		throttleCounts: make(map[string]int64),
+		throttledTotal: metrics.NewCounterVec("qqbotrouter_throttled_total",
+			"Events rejected by QoS admission, by bot and reason.", "bot", "reason"),
 	}
+	qm.warnLegacyLoadThreshold("", qosConfig)
+	return qm
 }
 
-// ShouldThrottle determines if a request should be throttled
+// ShouldThrottle determines if a request should be throttled. It does not
+// hold a concurrency slot; use Admit for requests that are then delivered.
 func (qm *QoSManager) ShouldThrottle(userID string, priority int) bool {
+	result := qm.Admit(Admission{UserID: userID, Priority: priority})
+	result.Done()
+	return result.Throttled
+}
+
+// Record feeds the delivery outcome of an admitted request to the circuit
+// breaker that admitted it. Requests that skipped the breaker are not counted.
+func (r AdmissionResult) Record(success bool) {
+	if r.breaker != nil {
+		r.breaker.Record(success, r.trial)
+	}
+}
+
+// Admit decides whether an event is accepted and, if not, why. An admitted
+// request holds a concurrency slot until Done is called on the result.
+func (qm *QoSManager) Admit(req Admission) AdmissionResult {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
+	b := qm.bot(req.BotID)
 
-	// Check circuit breaker
-	if qm.isCircuitOpen() {
-		return true
+	// Check token-bucket rate limits
+	if reason := b.checkRateLimits(req); reason != "" {
+		return qm.throttled(req.BotID, reason)
 	}
-
-	// Check adaptive throttling
-	if qm.shouldAdaptiveThrottle(priority) {
-		return true
+	if req.ThrottleExempt {
+		return AdmissionResult{}
 	}
 
-	return false
-}
-
-// isCircuitOpen checks if circuit breaker is open
-func (qm *QoSManager) isCircuitOpen() bool {
-	if !qm.qosConfig.CircuitBreaker.Enabled {
-		return false
+	// Take a concurrency slot
+	result := AdmissionResult{}
+	if b.cfg.AdaptiveThrottling.Enabled {
+		result.slot = b.concurrency
+		if !result.slot.Acquire(concurrencyShare(req.Priority) * b.load.get()) {
+			return qm.throttled(req.BotID, ThrottleReasonConcurrency)
+		}
 	}
 
-	if qm.circuitOpen {
-		// Check if we should try to close the circuit
-		recoveryTimeout := qm.qosConfig.ParseDuration(qm.qosConfig.CircuitBreaker.RecoveryTimeout)
-		if time.Since(qm.circuitOpenTime) > recoveryTimeout {
-			qm.circuitOpen = false
-			qm.failureCount = 0
-			qm.logger.Info("Circuit breaker closed, attempting recovery")
-			return false
+	// Check the circuit breaker last so a half-open trial slot is only taken
+	// by a request that is otherwise admitted
+	if b.cfg.CircuitBreaker.Enabled {
+		allowed, trial := b.breaker.Allow()
+		if !allowed {
+			result.Done()
+			return qm.throttled(req.BotID, ThrottleReasonCircuitOpen)
 		}
-		return true
+		result.breaker, result.trial = b.breaker, trial
 	}
 
-	return false
+	return result
 }
 
-// shouldAdaptiveThrottle checks if request should be throttled based on adaptive policy
-func (qm *QoSManager) shouldAdaptiveThrottle(priority int) bool {
-	if !qm.qosConfig.AdaptiveThrottling.Enabled {
-		return false
-	}
-
-	currentLoad := qm.loadProvider.Get()
-	maxLoad := qm.qosConfig.SystemLimits.MaxLoad
+// throttled counts a throttled request and builds its result
+func (qm *QoSManager) throttled(botID, reason string) AdmissionResult {
+	qm.countsMu.Lock()
+	qm.throttleCounts[reason]++
+	qm.countsMu.Unlock()
+	qm.throttledTotal.With(botID, reason).Inc()
+	return AdmissionResult{Throttled: true, Reason: reason}
+}
 
-	// Calculate load ratio
-	loadRatio := float64(currentLoad) / float64(maxLoad)
+// checkRateLimits consults the user, group and bot buckets for the request's
+// priority class, returning the reason for the first one that is exhausted
+func (b *botQoS) checkRateLimits(req Admission) string {
+	limits := b.cfg.RateLimits
+	if !limits.Enabled {
+		return ""
+	}
 
-	// High priority requests have lower throttle probability
-	throttleProbability := qm.throttleLevel * (1.0 - float64(priority)/10.0)
+	// Classes with their own limits also get their own buckets
+	scopes, override := limits.ScopesForClass(req.Class)
+	prefix := ""
+	if override {
+		prefix = req.Class + "|"
+	}
 
-	// Increase throttle probability under high load
-	if loadRatio > qm.qosConfig.SystemLimits.HighLoadThreshold {
-		throttleProbability *= (1.0 + loadRatio)
+	var checks []ratelimit.Check
+	var reasons []string
+	if req.UserID != "" && req.UserID != "unknown" {
+		checks = append(checks, ratelimit.Check{Key: "user|" + prefix + req.UserID, Limit: toLimit(scopes.User)})
+		reasons = append(reasons, ThrottleReasonUserRate)
+	}
+	if req.GroupID != "" {
+		checks = append(checks, ratelimit.Check{Key: "group|" + prefix + req.GroupID, Limit: toLimit(scopes.Group)})
+		reasons = append(reasons, ThrottleReasonGroupRate)
 	}
+	checks = append(checks, ratelimit.Check{Key: "bot|" + prefix, Limit: toLimit(scopes.Bot)})
+	reasons = append(reasons, ThrottleReasonBotRate)
 
-	// Simple probability-based throttling
-	return throttleProbability > 0.5
+	if rejected := b.limiter.Allow(checks, time.Now()); rejected >= 0 {
+		return reasons[rejected]
+	}
+	return ""
 }
 
-// UpdateMetrics updates QoS metrics and adjusts policies
-func (qm *QoSManager) UpdateMetrics(responseTime time.Duration, success bool) {
-	qm.mu.Lock()
-	defer qm.mu.Unlock()
-
-	// Update circuit breaker state
-	qm.updateCircuitBreaker(success)
-
-	// Update adaptive throttling
-	qm.updateAdaptiveThrottling(responseTime)
+// toLimit converts a configured token bucket into a ratelimit.Limit
+func toLimit(cfg config.TokenBucketConfig) ratelimit.Limit {
+	return ratelimit.Limit{Rate: cfg.Rate, Burst: cfg.Burst}
+}
 
-	// Update performance metrics
-	qm.updatePerformanceMetrics(responseTime)
+// breakerAlert is the payload posted to the alert webhook on a breaker transition
+type breakerAlert struct {
+	BotID string `json:"bot_id"`
+	BreakerEvent
 }
 
-// updateCircuitBreaker updates circuit breaker state based on request success
-func (qm *QoSManager) updateCircuitBreaker(success bool) {
-	if !qm.qosConfig.CircuitBreaker.Enabled {
-		return
+// onBreakerTransition logs a bot's circuit breaker state changes and forwards them to the alert webhook
+func (qm *QoSManager) onBreakerTransition(botID string, event BreakerEvent) {
+	fields := []zap.Field{
+		zap.String("bot_id", botID),
+		zap.Stringer("from", event.From),
+		zap.Stringer("to", event.To),
+		zap.String("reason", event.Reason),
+		zap.Float64("failure_rate", event.FailureRate),
+		zap.Int("failures", event.Failures),
+		zap.Int("requests", event.Requests),
 	}
-
-	if success {
-		qm.failureCount = 0
+	if event.To == BreakerOpen {
+		qm.logger.Warn("Circuit breaker opened", fields...)
 	} else {
-		qm.failureCount++
-		if qm.failureCount >= qm.qosConfig.CircuitBreaker.FailureThreshold {
-			qm.circuitOpen = true
-			qm.circuitOpenTime = time.Now()
-			qm.logger.Warn("Circuit breaker opened due to high failure rate",
-				zap.Int("failure_count", qm.failureCount))
-		}
+		qm.logger.Info("Circuit breaker state changed", fields...)
 	}
+
+	// Transitions can fire while qm.mu is held, so the alert reads the config on its own goroutine
+	go qm.sendBreakerAlert(botID, event)
 }
 
-// updateAdaptiveThrottling adjusts throttle level using the configured strategy
-func (qm *QoSManager) updateAdaptiveThrottling(responseTime time.Duration) {
-	if !qm.qosConfig.AdaptiveThrottling.Enabled {
+// sendBreakerAlert posts a state transition to the bot's alert webhook, if any
+func (qm *QoSManager) sendBreakerAlert(botID string, event BreakerEvent) {
+	qm.mu.RLock()
+	cfg, _ := qm.configFor(botID)
+	webhook := cfg.CircuitBreaker.AlertWebhook
+	qm.mu.RUnlock()
+	if webhook == "" {
 		return
 	}
 
-	// Only adjust throttling every few seconds to avoid oscillation
-	adjustmentInterval := qm.qosConfig.SystemLimits.AdjustmentInterval
-	if adjustmentDuration, err := time.ParseDuration(adjustmentInterval); err == nil {
-		if time.Since(qm.lastAdjustment) < adjustmentDuration {
-			return
-		}
-	} else if time.Since(qm.lastAdjustment) < 5*time.Second {
+	payload, err := json.Marshal(breakerAlert{BotID: botID, BreakerEvent: event})
+	if err != nil {
+		qm.logger.Error("Failed to encode circuit breaker alert", zap.Error(err))
 		return
 	}
 
-	// Use strategy pattern for throttling calculation
-	newInterval, err := qm.throttlingStrategy.UpdateThrottling(qm.qosConfig, qm.observer, qm.statsProvider)
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(payload))
 	if err != nil {
-		qm.logger.Error("Failed to update throttling", zap.Error(err))
+		qm.logger.Error("Failed to send circuit breaker alert", zap.String("webhook", webhook), zap.Error(err))
 		return
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		qm.logger.Warn("Circuit breaker alert rejected",
+			zap.String("webhook", webhook),
+			zap.Int("status_code", resp.StatusCode))
+	}
+}
 
-	// Convert interval to throttle level (0.0 to 1.0)
-	baseInterval := time.Duration(qm.qosConfig.AdaptiveThrottling.BaseInterval) * time.Millisecond
-	maxInterval := time.Duration(qm.qosConfig.AdaptiveThrottling.MaxInterval) * time.Millisecond
+// BreakerStatus returns each bot's circuit breaker state and recent transitions
+func (qm *QoSManager) BreakerStatus() map[string]BreakerStatus {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
 
-	if newInterval <= baseInterval {
-		qm.throttleLevel = 0.0
-	} else if newInterval >= maxInterval {
-		qm.throttleLevel = 1.0
-	} else {
-		// Linear interpolation between base and max interval
-		qm.throttleLevel = float64(newInterval-baseInterval) / float64(maxInterval-baseInterval)
+	bots := qm.snapshotBots()
+	status := make(map[string]BreakerStatus, len(bots))
+	for botID, b := range bots {
+		status[botID] = b.breaker.Status()
 	}
+	return status
+}
 
-	qm.logger.Info("Updated throttle level using strategy",
-		zap.Float64("throttle_level", qm.throttleLevel),
-		zap.Duration("new_interval", newInterval),
-		zap.Duration("response_time", responseTime))
+// concurrencyShare returns the fraction of a concurrency limit a request of
+// the given priority may fill, keeping headroom for more important requests
+func concurrencyShare(priority int) float64 {
+	return math.Max(0.5, math.Min(1.0, 0.5+float64(priority)/20.0))
+}
 
-	qm.lastAdjustment = time.Now()
+// RecordForwardLatency feeds a bot's forward latency into its concurrency limiter
+func (qm *QoSManager) RecordForwardLatency(botID string, latency time.Duration, success bool) {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+
+	b := qm.bot(botID)
+	if !b.cfg.AdaptiveThrottling.Enabled {
+		return
+	}
+	b.concurrency.Observe(latency, success)
 }
 
-// SetThrottlingStrategy allows changing the throttling strategy
-func (qm *QoSManager) SetThrottlingStrategy(strategy ThrottlingStrategy) {
-	qm.mu.Lock()
-	defer qm.mu.Unlock()
-	qm.throttlingStrategy = strategy
+// ConcurrencyStatus returns the concurrency limit and in-flight count of each bot
+func (qm *QoSManager) ConcurrencyStatus() map[string]ConcurrencyStatus {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	return qm.concurrencyStatusLocked()
+}
+
+// concurrencyStatusLocked reports the bots with adaptive throttling enabled; qm.mu must be held
+func (qm *QoSManager) concurrencyStatusLocked() map[string]ConcurrencyStatus {
+	status := make(map[string]ConcurrencyStatus)
+	for botID, b := range qm.snapshotBots() {
+		if b.cfg.AdaptiveThrottling.Enabled {
+			status[botID] = b.concurrency.Status()
+		}
+	}
+	return status
+}
+
+// UpdateMetrics updates QoS metrics with the outcome of a bot's delivery
+func (qm *QoSManager) UpdateMetrics(botID string, responseTime time.Duration, success bool) {
+	// Feed the observer, whose per-bot thresholds drive dynamic load balancing
+	if qm.observer != nil {
+		qm.observer.RecordLatency(responseTime)
+		qm.observer.RecordBotLatency(botID, responseTime)
+	}
+
+	// Update performance metrics
+	qm.updatePerformanceMetrics(responseTime)
 }
 
 // updatePerformanceMetrics updates performance tracking metrics
 func (qm *QoSManager) updatePerformanceMetrics(responseTime time.Duration) {
 	// Simple moving average for response times
 	// In a real implementation, this would use more sophisticated metrics
+	qm.perfMu.Lock()
+	defer qm.perfMu.Unlock()
 	qm.responseTimeP90 = (qm.responseTimeP90*9 + responseTime) / 10
 	qm.responseTimeP50 = (qm.responseTimeP50*9 + responseTime) / 10
 }
@@ -210,15 +333,49 @@ func (qm *QoSManager) GetMetrics() map[string]interface{} {
 	qm.mu.RLock()
 	defer qm.mu.RUnlock()
 
+	qm.countsMu.Lock()
+	throttled := make(map[string]int64, len(qm.throttleCounts))
+	for reason, count := range qm.throttleCounts {
+		throttled[reason] = count
+	}
+	qm.countsMu.Unlock()
+
+	qm.perfMu.Lock()
+	p50, p90 := qm.responseTimeP50, qm.responseTimeP90
+	qm.perfMu.Unlock()
+
+	rateLimitKeys := 0
+	circuitOpen := false
+	bots := make(map[string]interface{})
+	for botID, b := range qm.snapshotBots() {
+		breaker := b.breaker.Status()
+		rateLimitKeys += b.limiter.Len()
+		circuitOpen = circuitOpen || breaker.State == BreakerOpen
+		bots[botID] = map[string]interface{}{
+			"profiled":        b.profiled,
+			"circuit_state":   breaker.State.String(),
+			"failure_count":   breaker.Failures,
+			"failure_rate":    breaker.FailureRate,
+			"rate_limit_keys": b.limiter.Len(),
+			"load_factor":     b.load.get(),
+		}
+	}
+
 	return map[string]interface{}{
-		"throttle_level":    qm.throttleLevel,
-		"circuit_open":      qm.circuitOpen,
-		"failure_count":     qm.failureCount,
+		"throttled":         throttled,
+		"rate_limit_keys":   rateLimitKeys,
+		"concurrency":       qm.concurrencyStatusLocked(),
+		"circuit_open":      circuitOpen,
+		"bots":              bots,
 		"current_load":      qm.loadProvider.Get(),
-		"response_time_p50": qm.responseTimeP50.Milliseconds(),
-		"response_time_p90": qm.responseTimeP90.Milliseconds(),
+		"response_time_p50": p50.Milliseconds(),
+		"response_time_p90": p90.Milliseconds(),
 		"stats_p50":         qm.statsProvider.P50().Milliseconds(),
 		"stats_p90":         qm.statsProvider.P90().Milliseconds(),
+		"error_rate":        qm.statsProvider.GetErrorRate(),
+		"in_flight":         qm.statsProvider.GetActiveConnections(),
+		"system_load":       qm.statsProvider.GetSystemLoad(),
+		"total_requests":    qm.statsProvider.GetTotalRequests(),
 	}
 }
 
@@ -237,12 +394,19 @@ func (qm *QoSManager) monitoringLoop(ctx context.Context) error {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
+	// The load balancing interval is re-read each time so hot reloads apply
+	balance := time.NewTimer(qm.loadBalancingInterval())
+	defer balance.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-ticker.C:
 			qm.performPeriodicAdjustments()
+		case <-balance.C:
+			qm.adjustLoadFactors()
+			balance.Reset(qm.loadBalancingInterval())
 		}
 	}
 }
@@ -253,45 +417,40 @@ func (qm *QoSManager) performPeriodicAdjustments() {
 	qm.logger.Debug("QoS metrics update", zap.Any("metrics", metrics))
 
 	// Log important state changes
-	if qm.circuitOpen {
-		qm.logger.Warn("Circuit breaker is open", zap.Any("metrics", metrics))
+	for botID, b := range qm.snapshotBots() {
+		if b.breaker.State() == BreakerOpen {
+			qm.logger.Warn("Circuit breaker is open", zap.String("bot_id", botID))
+		}
 	}
 
-	if qm.throttleLevel > 0.5 {
-		qm.logger.Warn("High throttle level detected", zap.Any("metrics", metrics))
+	for botID, status := range qm.ConcurrencyStatus() {
+		if status.InFlight >= status.Limit {
+			qm.logger.Warn("Bot is at its concurrency limit",
+				zap.String("bot_id", botID),
+				zap.Int("limit", status.Limit),
+				zap.Int("in_flight", status.InFlight))
+		}
 	}
 }
 
-// UpdateConfig updates the QoS configuration during hot reload
-func (qm *QoSManager) UpdateConfig(newConfig *config.QoSConfig) {
+// UpdateConfig updates the global QoS configuration and the bot profiles
+// during hot reload. Each bot keeps its state unless its effective settings changed.
+func (qm *QoSManager) UpdateConfig(newConfig *config.QoSConfig, profiles map[string]config.QoSConfig) {
 	qm.mu.Lock()
 	defer qm.mu.Unlock()
 
-	oldConfig := qm.qosConfig
 	qm.qosConfig = newConfig
-
-	// Reset circuit breaker if configuration changed
-	if oldConfig.CircuitBreaker.Enabled != newConfig.CircuitBreaker.Enabled ||
-		oldConfig.CircuitBreaker.FailureThreshold != newConfig.CircuitBreaker.FailureThreshold {
-		qm.circuitOpen = false
-		qm.failureCount = 0
-		qm.logger.Info("Circuit breaker configuration updated, resetting state")
-	}
-
-	// Reset adaptive throttling if configuration changed
-	if oldConfig.AdaptiveThrottling.Enabled != newConfig.AdaptiveThrottling.Enabled ||
-		oldConfig.AdaptiveThrottling.BaseThreshold != newConfig.AdaptiveThrottling.BaseThreshold ||
-		oldConfig.AdaptiveThrottling.MaxThreshold != newConfig.AdaptiveThrottling.MaxThreshold {
-		qm.throttleLevel = 0.0
-		qm.lastAdjustment = time.Now()
-		qm.logger.Info("Adaptive throttling configuration updated, resetting state")
-	}
+	qm.warnLegacyLoadThreshold("", newConfig)
+	qm.setProfilesLocked(profiles)
+	qm.reconfigureBotsLocked()
 
 	// Log configuration update
 	qm.logger.Info("QoS configuration updated",
 		zap.Bool("circuit_breaker_enabled", newConfig.CircuitBreaker.Enabled),
 		zap.Bool("adaptive_throttling_enabled", newConfig.AdaptiveThrottling.Enabled),
-		zap.Int("max_load", newConfig.SystemLimits.MaxLoad))
+		zap.Bool("rate_limits_enabled", newConfig.RateLimits.Enabled),
+		zap.Int("max_load", newConfig.SystemLimits.MaxLoad),
+		zap.Int("bot_profiles", len(profiles)))
 }
 
 // Helper functions
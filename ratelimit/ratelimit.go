@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Limit is a token-bucket rate: Rate tokens per second with room for Burst tokens.
+// A zero Rate means unlimited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited reports whether the limit never rejects
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// bucket is the state of one token bucket
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accrued since the last update, capped at the burst size
+func (b *bucket) refill(limit Limit, now time.Time) {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * limit.Rate
+	}
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+}
+
+// Check is one bucket to consult in a single admission decision
+type Check struct {
+	Key   string
+	Limit Limit
+}
+
+// Limiter holds token buckets keyed by string in an LRU-bounded table, so
+// memory stays fixed no matter how many distinct users or groups appear.
+type Limiter struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+// NewLimiter creates a new Limiter holding at most maxEntries buckets.
+func NewLimiter(maxEntries int) *Limiter {
+	if maxEntries < 1 {
+		maxEntries = 1
+	}
+	return &Limiter{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Allow consults every check and takes one token from each bucket only if all
+// of them have a token available. It returns the index of the first check
+// that rejected the request, or -1 if it was allowed.
+func (l *Limiter) Allow(checks []Check, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := make([]*bucket, len(checks))
+	for i, check := range checks {
+		if check.Limit.Unlimited() {
+			continue
+		}
+		b := l.getLocked(check.Key)
+		b.refill(check.Limit, now)
+		if b.tokens < 1 {
+			return i
+		}
+		buckets[i] = b
+	}
+
+	for _, b := range buckets {
+		if b != nil {
+			b.tokens--
+		}
+	}
+	return -1
+}
+
+// getLocked returns the bucket for key, creating it and evicting the least
+// recently used bucket if the table is full; l.mu must be held
+func (l *Limiter) getLocked(key string) *bucket {
+	if element, ok := l.entries[key]; ok {
+		l.lru.MoveToFront(element)
+		return element.Value.(*bucket)
+	}
+
+	if l.lru.Len() >= l.maxEntries {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.entries, oldest.Value.(*bucket).key)
+	}
+
+	b := &bucket{key: key}
+	l.entries[key] = l.lru.PushFront(b)
+	return b
+}
+
+// Len returns the number of tracked buckets
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	perSecond := Limit{Rate: 1, Burst: 2}
+
+	// call is one Allow at an offset from the start of the test
+	type call struct {
+		at     time.Duration
+		checks []Check
+		want   int
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "burst then reject",
+			calls: []call{
+				{at: 0, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: 0, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: 0, checks: []Check{{"u", perSecond}}, want: 0},
+			},
+		},
+		{
+			name: "refills at the rate",
+			calls: []call{
+				{at: 0, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: 0, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: 500 * time.Millisecond, checks: []Check{{"u", perSecond}}, want: 0},
+				{at: time.Second, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: time.Second, checks: []Check{{"u", perSecond}}, want: 0},
+			},
+		},
+		{
+			name: "refill is capped at the burst",
+			calls: []call{
+				{at: 0, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: time.Hour, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: time.Hour, checks: []Check{{"u", perSecond}}, want: -1},
+				{at: time.Hour, checks: []Check{{"u", perSecond}}, want: 0},
+			},
+		},
+		{
+			name: "burst below one still admits one",
+			calls: []call{
+				{at: 0, checks: []Check{{"u", Limit{Rate: 1}}}, want: -1},
+				{at: 0, checks: []Check{{"u", Limit{Rate: 1}}}, want: 0},
+			},
+		},
+		{
+			name: "unlimited never rejects",
+			calls: []call{
+				{at: 0, checks: []Check{{"u", Limit{}}}, want: -1},
+				{at: 0, checks: []Check{{"u", Limit{Burst: 1}}}, want: -1},
+				{at: 0, checks: []Check{{"u", Limit{Rate: -1}}}, want: -1},
+			},
+		},
+		{
+			name: "keys are independent",
+			calls: []call{
+				{at: 0, checks: []Check{{"a", Limit{Rate: 1, Burst: 1}}}, want: -1},
+				{at: 0, checks: []Check{{"a", Limit{Rate: 1, Burst: 1}}}, want: 0},
+				{at: 0, checks: []Check{{"b", Limit{Rate: 1, Burst: 1}}}, want: -1},
+			},
+		},
+		{
+			name: "reports the first exhausted check",
+			calls: []call{
+				{at: 0, checks: []Check{{"group", Limit{Rate: 1, Burst: 1}}}, want: -1},
+				{at: 0, checks: []Check{{"user", perSecond}, {"group", Limit{Rate: 1, Burst: 1}}, {"bot", perSecond}}, want: 1},
+			},
+		},
+		{
+			name: "a rejection takes no token from the other buckets",
+			calls: []call{
+				{at: 0, checks: []Check{{"bot", Limit{Rate: 1, Burst: 1}}}, want: -1},
+				{at: 0, checks: []Check{{"user", Limit{Rate: 1, Burst: 1}}, {"bot", Limit{Rate: 1, Burst: 1}}}, want: 1},
+				{at: 0, checks: []Check{{"user", Limit{Rate: 1, Burst: 1}}}, want: -1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(100)
+			start := time.Unix(1700000000, 0)
+			for i, c := range tt.calls {
+				if got := l.Allow(c.checks, start.Add(c.at)); got != c.want {
+					t.Fatalf("call %d at %v: Allow = %d, want %d", i, c.at, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterEviction(t *testing.T) {
+	oneShot := Limit{Rate: 0.001, Burst: 1}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		keys       []string // Keys used in order, each taking its only token
+		retry      string   // Key tried again afterwards
+		wantRetry  int      // -1 if the retried key was evicted and starts with a full bucket
+		wantLen    int
+	}{
+		{name: "within capacity keeps state", maxEntries: 3, keys: []string{"a", "b", "c"}, retry: "a", wantRetry: 0, wantLen: 3},
+		{name: "oldest is evicted", maxEntries: 2, keys: []string{"a", "b", "c"}, retry: "a", wantRetry: -1, wantLen: 2},
+		{name: "newest survives eviction", maxEntries: 2, keys: []string{"a", "b", "c"}, retry: "c", wantRetry: 0, wantLen: 2},
+		{name: "use refreshes recency", maxEntries: 2, keys: []string{"a", "b", "a", "c"}, retry: "a", wantRetry: 0, wantLen: 2},
+		{name: "refreshed key pushes out the other", maxEntries: 2, keys: []string{"a", "b", "a", "c"}, retry: "b", wantRetry: -1, wantLen: 2},
+		{name: "capacity below one holds one bucket", maxEntries: 0, keys: []string{"a", "b"}, retry: "b", wantRetry: 0, wantLen: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.maxEntries)
+			now := time.Unix(1700000000, 0)
+			for _, key := range tt.keys {
+				l.Allow([]Check{{key, oneShot}}, now)
+			}
+			if got := l.Allow([]Check{{tt.retry, oneShot}}, now); got != tt.wantRetry {
+				t.Errorf("retry %q: Allow = %d, want %d", tt.retry, got, tt.wantRetry)
+			}
+			if got := l.Len(); got != tt.wantLen {
+				t.Errorf("Len = %d, want %d", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestUnlimitedChecksAreNotTracked(t *testing.T) {
+	l := NewLimiter(10)
+	l.Allow([]Check{{"a", Limit{}}, {"b", Limit{Rate: 1, Burst: 1}}}, time.Now())
+	if got := l.Len(); got != 1 {
+		t.Errorf("Len = %d, want 1", got)
+	}
+}
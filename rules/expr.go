@@ -0,0 +1,406 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Env supplies variable values and named lists to expressions at evaluation time
+type Env interface {
+	// Lookup returns the value of a dotted variable such as "event.type"
+	Lookup(name string) (interface{}, bool)
+
+	// InList reports whether value is a member of the named list, e.g. a user group
+	InList(list, value string) bool
+}
+
+// Expr is a compiled boolean expression
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses an expression such as
+//
+//	event.type == "GROUP_AT_MESSAGE_CREATE" && user.in("vip")
+//
+// Supported syntax: string, number and true/false literals, dotted variables,
+// == != < <= > >=, && || !, parentheses and the methods in(list...),
+// oneOf(value...), contains(s), startsWith(s), endsWith(s) and matches(regex).
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.peek().text, p.peek().pos)
+	}
+	return &Expr{source: src, root: root}, nil
+}
+
+// Eval evaluates the expression as a condition
+func (e *Expr) Eval(env Env) bool {
+	return truthy(e.root.eval(env))
+}
+
+// String returns the expression source
+func (e *Expr) String() string {
+	return e.source
+}
+
+// node is an evaluable expression tree node
+type node interface {
+	eval(env Env) interface{}
+}
+
+type literalNode struct{ value interface{} }
+
+func (n *literalNode) eval(env Env) interface{} { return n.value }
+
+type variableNode struct{ name string }
+
+func (n *variableNode) eval(env Env) interface{} {
+	value, _ := env.Lookup(n.name)
+	return value
+}
+
+type notNode struct{ operand node }
+
+func (n *notNode) eval(env Env) interface{} { return !truthy(n.operand.eval(env)) }
+
+type logicalNode struct {
+	op          string
+	left, right node
+}
+
+func (n *logicalNode) eval(env Env) interface{} {
+	if n.op == "&&" {
+		return truthy(n.left.eval(env)) && truthy(n.right.eval(env))
+	}
+	return truthy(n.left.eval(env)) || truthy(n.right.eval(env))
+}
+
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n *compareNode) eval(env Env) interface{} {
+	left, right := n.left.eval(env), n.right.eval(env)
+
+	if lf, lok := toNumber(left); lok {
+		if rf, rok := toNumber(right); rok {
+			switch n.op {
+			case "==":
+				return lf == rf
+			case "!=":
+				return lf != rf
+			case "<":
+				return lf < rf
+			case "<=":
+				return lf <= rf
+			case ">":
+				return lf > rf
+			case ">=":
+				return lf >= rf
+			}
+		}
+	}
+
+	ls, rs := toString(left), toString(right)
+	switch n.op {
+	case "==":
+		return ls == rs
+	case "!=":
+		return ls != rs
+	case "<":
+		return ls < rs
+	case "<=":
+		return ls <= rs
+	case ">":
+		return ls > rs
+	case ">=":
+		return ls >= rs
+	}
+	return false
+}
+
+type methodNode struct {
+	receiver node
+	method   string
+	args     []string
+	pattern  *regexp.Regexp
+}
+
+func (n *methodNode) eval(env Env) interface{} {
+	value := toString(n.receiver.eval(env))
+	switch n.method {
+	case "in":
+		for _, list := range n.args {
+			if env.InList(list, value) {
+				return true
+			}
+		}
+		return false
+	case "oneOf":
+		for _, arg := range n.args {
+			if value == arg {
+				return true
+			}
+		}
+		return false
+	case "contains":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(n.args[0]))
+	case "startsWith":
+		return strings.HasPrefix(value, n.args[0])
+	case "endsWith":
+		return strings.HasSuffix(value, n.args[0])
+	case "matches":
+		return n.pattern.MatchString(value)
+	}
+	return false
+}
+
+// methodArity is the number of arguments each method accepts (-1 means one or more)
+var methodArity = map[string]int{
+	"in":         -1,
+	"oneOf":      -1,
+	"contains":   1,
+	"startsWith": 1,
+	"endsWith":   1,
+	"matches":    1,
+}
+
+// parser is a recursive-descent parser over a token slice
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t := p.next()
+	if t.kind != kind {
+		return fmt.Errorf("expected %q at position %d, got %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOperator && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOperator && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.peek().kind == tokenOperator && p.peek().text == "!" {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokenOperator {
+		switch t.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			p.next()
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return &compareNode{op: t.text, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", t.text, t.pos)
+		}
+		return &literalNode{value: value}, nil
+	case tokenOperator:
+		if t.text == "-" && p.peek().kind == tokenNumber {
+			number := p.next()
+			value, err := strconv.ParseFloat(number.text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", number.text, number.pos)
+			}
+			return &literalNode{value: -value}, nil
+		}
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		}
+		return p.parsePath(t)
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+// parsePath parses a dotted variable, optionally ending in a method call
+func (p *parser) parsePath(first token) (node, error) {
+	parts := []string{first.text}
+	for p.peek().kind == tokenDot {
+		p.next()
+		ident := p.next()
+		if ident.kind != tokenIdent {
+			return nil, fmt.Errorf("expected name after '.' at position %d", ident.pos)
+		}
+
+		if p.peek().kind == tokenLParen {
+			return p.parseMethod(&variableNode{name: strings.Join(parts, ".")}, ident)
+		}
+		parts = append(parts, ident.text)
+	}
+	return &variableNode{name: strings.Join(parts, ".")}, nil
+}
+
+// parseMethod parses the argument list of a method call on receiver
+func (p *parser) parseMethod(receiver node, method token) (node, error) {
+	arity, ok := methodArity[method.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown method %q at position %d", method.text, method.pos)
+	}
+	p.next() // (
+
+	var args []string
+	for p.peek().kind != tokenRParen {
+		arg := p.next()
+		if arg.kind != tokenString && arg.kind != tokenNumber {
+			return nil, fmt.Errorf("method %s expects literal arguments, got %q at position %d", method.text, arg.text, arg.pos)
+		}
+		args = append(args, arg.text)
+		if p.peek().kind == tokenComma {
+			p.next()
+		} else if p.peek().kind != tokenRParen {
+			return nil, fmt.Errorf("expected ',' or ')' at position %d", p.peek().pos)
+		}
+	}
+	p.next() // )
+
+	if (arity == -1 && len(args) == 0) || (arity > 0 && len(args) != arity) {
+		return nil, fmt.Errorf("method %s called with %d arguments", method.text, len(args))
+	}
+
+	n := &methodNode{receiver: receiver, method: method.text, args: args}
+	if method.text == "matches" {
+		pattern, err := regexp.Compile(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for matches: %w", err)
+		}
+		n.pattern = pattern
+	}
+	return n, nil
+}
+
+// truthy converts a value to a boolean
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case nil:
+		return false
+	}
+	return true
+}
+
+// toNumber converts numeric values to float64; strings never count as numbers
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// toString converts a value to its string form
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+// testEnv is the environment expressions are evaluated against in tests
+func testEnv() *MapEnv {
+	return &MapEnv{
+		Vars: map[string]interface{}{
+			"event.type":     "GROUP_AT_MESSAGE_CREATE",
+			"user":           "u1",
+			"message":        "Please HELP me",
+			"message.length": float64(14),
+			"load":           0.75,
+			"count":          3,
+			"code":           "10",
+			"verified":       true,
+		},
+		Lists: map[string]map[string]bool{
+			"vip":    {"u1": true},
+			"banned": {"u9": true},
+		},
+	}
+}
+
+func TestCompileAndEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		// Literals and variables
+		{src: `true`, want: true},
+		{src: `false`, want: false},
+		{src: `verified`, want: true},
+		{src: `missing`, want: false},
+		{src: `missing.nested.name`, want: false},
+		{src: `"text"`, want: true},
+		{src: `""`, want: false},
+		{src: `0`, want: false},
+
+		// String comparison
+		{src: `event.type == "GROUP_AT_MESSAGE_CREATE"`, want: true},
+		{src: `event.type != 'GROUP_AT_MESSAGE_CREATE'`, want: false},
+		{src: `user == "u1"`, want: true},
+		{src: `"b" > "a"`, want: true},
+		{src: `missing == ""`, want: true},
+
+		// Numeric comparison, including ints from the environment
+		{src: `load > 0.5`, want: true},
+		{src: `load >= 0.75 && load <= 0.75`, want: true},
+		{src: `message.length < 20`, want: true},
+		{src: `count == 3`, want: true},
+		{src: `count > -1`, want: true},
+		{src: `9 < 10`, want: true},
+
+		// Strings never compare as numbers, so ordering is lexical
+		{src: `code == 10`, want: true},
+		{src: `code < 9`, want: true},
+		{src: `"9" < 10`, want: false},
+
+		// Logic and precedence
+		{src: `true || false && false`, want: true},
+		{src: `(true || false) && false`, want: false},
+		{src: `!verified`, want: false},
+		{src: `!!verified`, want: true},
+		{src: `!(load > 0.9) && user == "u1"`, want: true},
+
+		// Methods
+		{src: `user.in("vip")`, want: true},
+		{src: `user.in("banned", "vip")`, want: true},
+		{src: `user.in("banned")`, want: false},
+		{src: `user.in("nobody")`, want: false},
+		{src: `user.oneOf("u2", "u1")`, want: true},
+		{src: `count.oneOf(3)`, want: true},
+		{src: `message.contains("help")`, want: true},
+		{src: `message.startsWith("Please")`, want: true},
+		{src: `message.startsWith("please")`, want: false},
+		{src: `message.endsWith("me")`, want: true},
+		{src: `message.matches("(?i)^please\\s+help")`, want: true},
+		{src: `message.matches("^help")`, want: false},
+		{src: `event.type.startsWith("GROUP_")`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			expr, err := Compile(tt.src)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got := expr.Eval(testEnv()); got != tt.want {
+				t.Errorf("Eval = %v, want %v", got, tt.want)
+			}
+			if expr.String() != tt.src {
+				t.Errorf("String = %q, want %q", expr.String(), tt.src)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{src: ``, wantErr: `unexpected "" at position 0`},
+		{src: `user == "u1`, wantErr: "unterminated string at position 8"},
+		{src: `user == 'u1" `, wantErr: "unterminated string at position 8"},
+		{src: `user # 1`, wantErr: "unexpected character '#' at position 5"},
+		{src: `user == "u1" extra`, wantErr: `unexpected "extra" at position 13`},
+		{src: `(user == "u1"`, wantErr: `expected ")" at position 13`},
+		{src: `user ==`, wantErr: `unexpected "" at position 7`},
+		{src: `user.`, wantErr: "expected name after '.' at position 5"},
+		{src: `user.lookup("x")`, wantErr: `unknown method "lookup" at position 5`},
+		{src: `user.in(vip)`, wantErr: `method in expects literal arguments, got "vip" at position 8`},
+		{src: `user.in("vip" "gold")`, wantErr: "expected ',' or ')' at position 14"},
+		{src: `user.in()`, wantErr: "method in called with 0 arguments"},
+		{src: `message.contains("a", "b")`, wantErr: "method contains called with 2 arguments"},
+		{src: `message.matches("(")`, wantErr: "invalid pattern for matches"},
+		{src: `user.in("vip"`, wantErr: "expected ',' or ')' at position 13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := Compile(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Compile error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenDot
+	tokenArrow // "=>" separating a rule's condition from its action
+)
+
+// token is a single lexical token with its position in the source
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// operators lists multi- and single-character operators, longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "+", "-", "="}
+
+// tokenize splits an expression into tokens
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+	i := 0
+
+	for i < len(runes) {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenLParen, "(", i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenRParen, ")", i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{tokenComma, ",", i})
+			i++
+		case r == '.':
+			tokens = append(tokens, token{tokenDot, ".", i})
+			i++
+		case r == '=' && i+1 < len(runes) && runes[i+1] == '>':
+			tokens = append(tokens, token{tokenArrow, "=>", i})
+			i += 2
+		case r == '"' || r == '\'':
+			start := i
+			quote := r
+			var sb strings.Builder
+			i++
+			for i < len(runes) && runes[i] != quote {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokenString, sb.String(), start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[start:i]), start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[start:i]), start})
+		default:
+			matched := false
+			rest := string(runes[i:])
+			for _, op := range operators {
+				if strings.HasPrefix(rest, op) {
+					tokens = append(tokens, token{tokenOperator, op, i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{tokenEOF, "", len(runes)})
+	return tokens, nil
+}
@@ -0,0 +1,113 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is a condition paired with a priority adjustment, written as
+//
+//	<condition> => +3    add to the score
+//	<condition> => -2    subtract from the score
+//	<condition> => =8    set the score and stop evaluating further rules
+type Rule struct {
+	Condition *Expr
+	Set       bool
+	Amount    int
+	Source    string
+}
+
+// ParseRule parses a single rule
+func ParseRule(src string) (*Rule, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", src, err)
+	}
+
+	// The condition ends at the arrow, which the lexer never produces inside a string
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %w", src, err)
+	}
+	arrow := p.next()
+	if arrow.kind != tokenArrow {
+		if arrow.kind == tokenEOF {
+			return nil, fmt.Errorf("rule %q has no '=>' action", src)
+		}
+		return nil, fmt.Errorf("rule %q: unexpected %q at position %d", src, arrow.text, arrow.pos)
+	}
+	runes := []rune(src)
+	condition := &Expr{source: strings.TrimSpace(string(runes[:arrow.pos])), root: root}
+	action := strings.TrimSpace(string(runes[arrow.pos+2:]))
+
+	// The action is an optional "=", an optional sign and an integer
+	rule := &Rule{Condition: condition, Source: src}
+	if t := p.peek(); t.kind == tokenOperator && t.text == "=" {
+		rule.Set = true
+		p.next()
+	}
+	sign := 1
+	if t := p.peek(); t.kind == tokenOperator && (t.text == "+" || t.text == "-") {
+		if t.text == "-" {
+			sign = -1
+		}
+		p.next()
+	}
+	number := p.next()
+	amount, err := strconv.Atoi(number.text)
+	if number.kind != tokenNumber || err != nil || p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("rule %q has invalid action %q", src, action)
+	}
+	rule.Amount = sign * amount
+	return rule, nil
+}
+
+// ParseRules parses a list of rules, reporting the first error
+func ParseRules(sources []string) ([]*Rule, error) {
+	parsed := make([]*Rule, 0, len(sources))
+	for _, src := range sources {
+		rule, err := ParseRule(src)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, rule)
+	}
+	return parsed, nil
+}
+
+// Apply evaluates rules in order against env, starting from score. It returns
+// the resulting score, the sources of the rules that matched and whether a
+// "=N" rule set the score.
+func Apply(ruleList []*Rule, env Env, score int) (int, []string, bool) {
+	var matched []string
+	for _, rule := range ruleList {
+		if !rule.Condition.Eval(env) {
+			continue
+		}
+		matched = append(matched, rule.Source)
+		if rule.Set {
+			return rule.Amount, matched, true
+		}
+		score += rule.Amount
+	}
+	return score, matched, false
+}
+
+// MapEnv is a simple Env backed by maps, useful for callers with a fixed set of variables
+type MapEnv struct {
+	Vars  map[string]interface{}
+	Lists map[string]map[string]bool
+}
+
+// Lookup implements Env
+func (e *MapEnv) Lookup(name string) (interface{}, bool) {
+	value, ok := e.Vars[name]
+	return value, ok
+}
+
+// InList implements Env
+func (e *MapEnv) InList(list, value string) bool {
+	return e.Lists[list][value]
+}
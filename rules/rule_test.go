@@ -0,0 +1,144 @@
+package rules
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		src           string
+		wantCondition string
+		wantSet       bool
+		wantAmount    int
+	}{
+		{src: `user.in("vip") => +3`, wantCondition: `user.in("vip")`, wantAmount: 3},
+		{src: `user.in("vip") => 3`, wantCondition: `user.in("vip")`, wantAmount: 3},
+		{src: `load > 0.8 => -2`, wantCondition: `load > 0.8`, wantAmount: -2},
+		{src: `load > 0.8=>-2`, wantCondition: `load > 0.8`, wantAmount: -2},
+		{src: `user == "admin" => =10`, wantCondition: `user == "admin"`, wantSet: true, wantAmount: 10},
+		{src: `user == "admin" => = 10`, wantCondition: `user == "admin"`, wantSet: true, wantAmount: 10},
+		{src: `spam.score >= 0.9 => =-5`, wantCondition: `spam.score >= 0.9`, wantSet: true, wantAmount: -5},
+		{src: `true => +0`, wantCondition: `true`, wantAmount: 0},
+
+		// The arrow inside a string is part of the condition
+		{src: `message.contains("=>") => +1`, wantCondition: `message.contains("=>")`, wantAmount: 1},
+		{src: `message == 'a => b' => =7`, wantCondition: `message == 'a => b'`, wantSet: true, wantAmount: 7},
+		{src: `  user.in("vip")   =>   +3  `, wantCondition: `user.in("vip")`, wantAmount: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			rule, err := ParseRule(tt.src)
+			if err != nil {
+				t.Fatalf("ParseRule: %v", err)
+			}
+			if rule.Condition.String() != tt.wantCondition || rule.Set != tt.wantSet || rule.Amount != tt.wantAmount {
+				t.Errorf("got condition %q set %v amount %d, want %q %v %d",
+					rule.Condition.String(), rule.Set, rule.Amount, tt.wantCondition, tt.wantSet, tt.wantAmount)
+			}
+			if rule.Source != tt.src {
+				t.Errorf("Source = %q, want %q", rule.Source, tt.src)
+			}
+		})
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{src: `user.in("vip")`, wantErr: `has no '=>' action`},
+		{src: `user.in("vip") +3`, wantErr: `unexpected "+" at position 15`},
+		{src: `user == "a => +3`, wantErr: "unterminated string at position 8"},
+		{src: `user.in("vip") => `, wantErr: `has invalid action ""`},
+		{src: `user.in("vip") => +`, wantErr: `has invalid action "+"`},
+		{src: `user.in("vip") => +3 4`, wantErr: `has invalid action "+3 4"`},
+		{src: `user.in("vip") => +3 => +4`, wantErr: `has invalid action "+3 => +4"`},
+		{src: `user.in("vip") => +1.5`, wantErr: `has invalid action "+1.5"`},
+		{src: `user.in("vip") => ==3`, wantErr: `has invalid action "==3"`},
+		{src: `user.in("vip") => vip`, wantErr: `has invalid action "vip"`},
+		{src: `message.matches("[") => +1`, wantErr: "invalid pattern for matches"},
+		{src: ` => +1`, wantErr: `unexpected "=>" at position 1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := ParseRule(tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseRule error = %v, want %q", err, tt.wantErr)
+			}
+			if !strings.HasPrefix(err.Error(), "rule "+`"`) {
+				t.Errorf("error %q does not name the rule", err)
+			}
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{`true => +1`, `false => -1`})
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("ParseRules = %d rules, %v", len(rules), err)
+	}
+	if _, err := ParseRules([]string{`true => +1`, `true`, `user.in(`}); err == nil || !strings.Contains(err.Error(), `rule "true" has no`) {
+		t.Errorf("ParseRules error = %v, want the first invalid rule", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []string
+		wantScore   int
+		wantMatched []string
+		wantPinned  bool
+	}{
+		{name: "no rules", wantScore: 5},
+		{
+			name:      "no match",
+			rules:     []string{`user == "u2" => +3`},
+			wantScore: 5,
+		},
+		{
+			name:        "adjustments accumulate in order",
+			rules:       []string{`user.in("vip") => +3`, `load > 0.5 => -1`, `user == "u2" => +10`},
+			wantScore:   7,
+			wantMatched: []string{`user.in("vip") => +3`, `load > 0.5 => -1`},
+		},
+		{
+			name:        "set replaces the running score",
+			rules:       []string{`user.in("vip") => +3`, `verified => =2`},
+			wantScore:   2,
+			wantMatched: []string{`user.in("vip") => +3`, `verified => =2`},
+			wantPinned:  true,
+		},
+		{
+			name:        "set stops further rules",
+			rules:       []string{`verified => =9`, `user.in("vip") => +3`, `true => =1`},
+			wantScore:   9,
+			wantMatched: []string{`verified => =9`},
+			wantPinned:  true,
+		},
+		{
+			name:        "unmatched set does not stop",
+			rules:       []string{`!verified => =1`, `user.in("vip") => +3`},
+			wantScore:   8,
+			wantMatched: []string{`user.in("vip") => +3`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseRules(tt.rules)
+			if err != nil {
+				t.Fatalf("ParseRules: %v", err)
+			}
+			score, matched, pinned := Apply(parsed, testEnv(), 5)
+			if score != tt.wantScore || pinned != tt.wantPinned || !reflect.DeepEqual(matched, tt.wantMatched) {
+				t.Errorf("Apply = %d, %q, %v; want %d, %q, %v", score, matched, pinned, tt.wantScore, tt.wantMatched, tt.wantPinned)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"qqbotrouter/config"
+	"qqbotrouter/forwarder"
+)
+
+const (
+	// rewardLatencyScale is the delivery latency that halves an endpoint's reward
+	rewardLatencyScale = time.Second
+
+	// minArmPulls is the decayed delivery count below which an endpoint is tried
+	// again before any other is exploited
+	minArmPulls = 1.0
+)
+
+// banditSettings are the cognitive scheduling settings in effect for a selection
+type banditSettings struct {
+	learningRate float64
+	memory       time.Duration
+	threshold    float64
+}
+
+// newBanditSettings parses the cognitive scheduling configuration
+func newBanditSettings(cfg *config.SchedulerConfig) banditSettings {
+	cognitive := cfg.CognitiveScheduling
+	settings := banditSettings{
+		learningRate: cognitive.LearningRate,
+		memory:       config.ParseDurationOrDefault(cognitive.MemoryWindow, time.Hour),
+		threshold:    cognitive.AdaptationThreshold,
+	}
+	if settings.learningRate <= 0 || settings.learningRate > 1 {
+		settings.learningRate = 0.01
+	}
+	if settings.memory <= 0 {
+		settings.memory = time.Hour
+	}
+	return settings
+}
+
+// banditArm is what a route has learned about one of its endpoints
+type banditArm struct {
+	reward  float64   // Smoothed delivery reward, from 0 for failures to 1 for instant success
+	pulls   float64   // Deliveries, decayed with the memory window as of updated
+	updated time.Time // When pulls was last decayed
+}
+
+// decayTo ages the arm's delivery count to now
+func (a *banditArm) decayTo(now time.Time, memory time.Duration) {
+	if elapsed := now.Sub(a.updated); elapsed > 0 {
+		a.pulls *= math.Exp2(-float64(elapsed) / float64(memory))
+		a.updated = now
+	}
+}
+
+// banditRoute is one route's endpoints and the one it currently exploits
+type banditRoute struct {
+	botID   string
+	pattern string
+	arms    map[string]*banditArm
+	leader  string
+}
+
+// RouteEndpointStats reports what a bandit route has learned about one of its endpoints
+type RouteEndpointStats struct {
+	BotID      string  `json:"bot_id"`
+	Route      string  `json:"route"`
+	Endpoint   string  `json:"endpoint"`
+	Reward     float64 `json:"reward"`     // Smoothed delivery reward (0.0 to 1.0)
+	Deliveries float64 `json:"deliveries"` // Deliveries, decayed with the memory window
+	Leader     bool    `json:"leader"`     // The endpoint the route currently exploits
+}
+
+// destinationBandit learns per route which endpoint delivers fastest and most
+// reliably. Each endpoint keeps a smoothed reward and a delivery count that
+// decays over the memory window; selection follows UCB1, so endpoints with
+// few recent deliveries are explored again, and only switches away from the
+// current leader when another endpoint scores higher by the adaptation threshold.
+type destinationBandit struct {
+	mu     sync.Mutex
+	routes map[string]*banditRoute
+}
+
+// newDestinationBandit creates a bandit with nothing learned
+func newDestinationBandit() *destinationBandit {
+	return &destinationBandit{routes: make(map[string]*banditRoute)}
+}
+
+// routeKey identifies a bot's regex route
+func routeKey(botID, pattern string) string {
+	return botID + " " + pattern
+}
+
+// choose selects one of the route's endpoints and counts the delivery
+func (b *destinationBandit) choose(botID, pattern string, endpoints []string, settings banditSettings, now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := routeKey(botID, pattern)
+	route, ok := b.routes[key]
+	if !ok {
+		route = &banditRoute{botID: botID, pattern: pattern, arms: make(map[string]*banditArm)}
+		b.routes[key] = route
+	}
+
+	total := 0.0
+	for _, endpoint := range endpoints {
+		arm, ok := route.arms[endpoint]
+		if !ok {
+			arm = &banditArm{updated: now}
+			route.arms[endpoint] = arm
+		}
+		arm.decayTo(now, settings.memory)
+		total += arm.pulls
+	}
+
+	chosen := ""
+	for _, endpoint := range endpoints {
+		if route.arms[endpoint].pulls < minArmPulls {
+			chosen = endpoint // Explore endpoints with no recent deliveries first
+			break
+		}
+	}
+	if chosen == "" {
+		best, bestScore := "", math.Inf(-1)
+		leaderScore, hasLeader := 0.0, false
+		for _, endpoint := range endpoints {
+			arm := route.arms[endpoint]
+			score := arm.reward + math.Sqrt(2*math.Log(total)/arm.pulls)
+			if score > bestScore {
+				best, bestScore = endpoint, score
+			}
+			if endpoint == route.leader {
+				leaderScore, hasLeader = score, true
+			}
+		}
+		chosen = best
+		if hasLeader && bestScore-leaderScore < settings.threshold {
+			chosen = route.leader
+		}
+		route.leader = chosen
+	}
+
+	route.arms[chosen].pulls++
+	return chosen
+}
+
+// record folds the results of a delivery chosen by the bandit into the
+// endpoint's reward
+func (b *destinationBandit) record(key string, results []forwarder.ForwardResult, settings banditSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	route, ok := b.routes[key]
+	if !ok {
+		return
+	}
+	for _, result := range results {
+		arm, ok := route.arms[result.Destination]
+		if !ok {
+			continue
+		}
+		reward := 0.0
+		if result.Success {
+			reward = 1 / (1 + float64(result.Latency)/float64(rewardLatencyScale))
+		}
+		// Early deliveries are averaged so the first result is not drowned by
+		// the starting reward; later ones are smoothed with the learning rate
+		weight := max(1/max(arm.pulls, 1), settings.learningRate)
+		arm.reward += weight * (reward - arm.reward)
+	}
+}
+
+// stats returns what each route has learned about its endpoints
+func (b *destinationBandit) stats(now time.Time, memory time.Duration) []RouteEndpointStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := []RouteEndpointStats{}
+	for _, route := range b.routes {
+		for endpoint, arm := range route.arms {
+			arm.decayTo(now, memory)
+			stats = append(stats, RouteEndpointStats{
+				BotID:      route.botID,
+				Route:      route.pattern,
+				Endpoint:   endpoint,
+				Reward:     arm.reward,
+				Deliveries: arm.pulls,
+				Leader:     endpoint == route.leader,
+			})
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.BotID != b.BotID {
+			return a.BotID < b.BotID
+		}
+		if a.Route != b.Route {
+			return a.Route < b.Route
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return stats
+}
+
+// RouteEndpointStats returns what routes with selection: bandit have learned about their endpoints
+func (s *Scheduler) RouteEndpointStats() []RouteEndpointStats {
+	s.mu.RLock()
+	settings := newBanditSettings(s.schedulerConfig)
+	s.mu.RUnlock()
+	return s.bandit.stats(time.Now(), settings.memory)
+}
+
+// hashEndpoint picks the endpoint a user's events consistently go to
+func hashEndpoint(userID string, endpoints []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return endpoints[h.Sum32()%uint32(len(endpoints))]
+}
@@ -0,0 +1,238 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/forwarder"
+	"qqbotrouter/tracing"
+)
+
+// batchItem is one event waiting to be delivered as part of a batch
+type batchItem struct {
+	ctx    context.Context // Carries the event's trace
+	botID  string
+	body   []byte
+	logger *zap.Logger
+	done   func(forwarder.ForwardResult)
+}
+
+// batchSettings are the effective batch settings for a destination
+type batchSettings struct {
+	size   int
+	linger time.Duration
+	format string
+}
+
+// pendingBatch accumulates items for one destination until it is full or lingers too long
+type pendingBatch struct {
+	items    []batchItem
+	settings batchSettings
+	timer    *time.Timer
+}
+
+// batcher groups events per destination and hands full or expired batches to send.
+type batcher struct {
+	mu      sync.Mutex
+	pending map[string]*pendingBatch
+	send    func(destination string, settings batchSettings, items []batchItem)
+	wg      sync.WaitGroup // Batches being sent
+}
+
+// newBatcher creates a batcher that delivers batches with send
+func newBatcher(send func(destination string, settings batchSettings, items []batchItem)) *batcher {
+	return &batcher{
+		pending: make(map[string]*pendingBatch),
+		send:    send,
+	}
+}
+
+// add queues an item for a destination, sending the batch once it reaches the batch size
+func (b *batcher) add(destination string, settings batchSettings, item batchItem) {
+	b.mu.Lock()
+	batch, ok := b.pending[destination]
+	if !ok {
+		batch = &pendingBatch{settings: settings}
+		b.pending[destination] = batch
+	}
+	batch.items = append(batch.items, item)
+
+	if len(batch.items) >= settings.size {
+		items := b.takeLocked(destination)
+		b.mu.Unlock()
+		b.dispatch(destination, settings, items)
+		return
+	}
+
+	if batch.timer == nil {
+		// The timer may fire after its batch was sent while full, so it only
+		// flushes the batch it was started for and never a later one
+		batch.timer = time.AfterFunc(settings.linger, func() {
+			b.flushBatch(destination, batch)
+		})
+	}
+	b.mu.Unlock()
+}
+
+// takeLocked removes and returns the pending items for a destination; b.mu must be held
+func (b *batcher) takeLocked(destination string) []batchItem {
+	batch, ok := b.pending[destination]
+	if !ok {
+		return nil
+	}
+	if batch.timer != nil {
+		batch.timer.Stop()
+	}
+	delete(b.pending, destination)
+	return batch.items
+}
+
+// flush sends whatever is pending for a destination
+func (b *batcher) flush(destination string) {
+	b.flushBatch(destination, nil)
+}
+
+// flushBatch sends the pending batch for a destination, if it is still the
+// given batch; a nil batch matches whatever is pending
+func (b *batcher) flushBatch(destination string, batch *pendingBatch) {
+	b.mu.Lock()
+	pending, ok := b.pending[destination]
+	if !ok || (batch != nil && pending != batch) {
+		b.mu.Unlock()
+		return
+	}
+	settings := pending.settings
+	items := b.takeLocked(destination)
+	b.mu.Unlock()
+
+	b.dispatch(destination, settings, items)
+}
+
+// flushAll sends every pending batch and waits until all batches have been delivered
+func (b *batcher) flushAll() {
+	b.mu.Lock()
+	destinations := make([]string, 0, len(b.pending))
+	for destination := range b.pending {
+		destinations = append(destinations, destination)
+	}
+	b.mu.Unlock()
+
+	for _, destination := range destinations {
+		b.flush(destination)
+	}
+	b.wg.Wait()
+}
+
+// dispatch sends a batch in the background
+func (b *batcher) dispatch(destination string, settings batchSettings, items []batchItem) {
+	if len(items) == 0 {
+		return
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.send(destination, settings, items)
+	}()
+}
+
+// batchSettingsFor returns the batch settings for a destination if it opted into batch delivery
+func (s *Scheduler) batchSettingsFor(destination string) (batchSettings, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	delivery := s.schedulerConfig.BatchDelivery
+	if !delivery.Enabled {
+		return batchSettings{}, false
+	}
+	override, ok := delivery.Destinations[destination]
+	if !ok {
+		return batchSettings{}, false
+	}
+
+	settings := batchSettings{
+		size:   s.schedulerConfig.PriorityQueue.BatchSize,
+		linger: config.ParseDurationOrDefault(delivery.Linger, 500*time.Millisecond),
+		format: delivery.Format,
+	}
+	if override.BatchSize > 0 {
+		settings.size = override.BatchSize
+	}
+	if override.Linger != "" {
+		settings.linger = config.ParseDurationOrDefault(override.Linger, settings.linger)
+	}
+	if override.Format != "" {
+		settings.format = override.Format
+	}
+	if settings.size < 1 {
+		settings.size = 1
+	}
+	return settings, true
+}
+
+// sendBatch delivers a batch and reports each item's result back to its request
+func (s *Scheduler) sendBatch(destination string, settings batchSettings, items []batchItem) {
+	bodies := make([][]byte, len(items))
+	for i, item := range items {
+		bodies[i] = item.body
+	}
+
+	// A batch mixes events from several traces, so each item gets its own
+	// span and no traceparent is sent with the combined request
+	spans := make([]*tracing.Span, len(items))
+	for i, item := range items {
+		_, spans[i] = tracing.Start(item.ctx, "forward_batch",
+			tracing.WithKind(tracing.KindClient),
+			tracing.WithAttributes(
+				tracing.String("url.full", destination),
+				tracing.Int("batch.size", len(items)),
+			))
+	}
+
+	forwardTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ForwardTimeout)
+	start := time.Now()
+	results := forwarder.ForwardBatch(context.Background(), items[0].logger, destination, bodies, settings.format, s.loadProvider, forwardTimeout)
+	latency := time.Since(start)
+
+	// One latency sample per bot in the batch, successful if any of its items got through
+	botSuccess := make(map[string]bool)
+	for i, item := range items {
+		botSuccess[item.botID] = botSuccess[item.botID] || results[i].Success
+		s.observeForwards(item.botID, results[i:i+1])
+		if results[i].StatusCode != 0 {
+			spans[i].SetAttributes(tracing.Int("http.response.status_code", results[i].StatusCode))
+		}
+		if !results[i].Success {
+			spans[i].SetStatus(tracing.StatusError, "batch item not accepted")
+		}
+		spans[i].End()
+		item.done(results[i])
+	}
+	for botID, success := range botSuccess {
+		s.recordForwardLatency(botID, latency, success)
+	}
+}
+
+// resultCollector gathers forward results for a request whose destinations
+// complete at different times and fires onDone once all have reported.
+type resultCollector struct {
+	mu       sync.Mutex
+	results  []forwarder.ForwardResult
+	expected int
+	onDone   func([]forwarder.ForwardResult)
+}
+
+// add records one destination's result
+func (c *resultCollector) add(result forwarder.ForwardResult) {
+	c.mu.Lock()
+	c.results = append(c.results, result)
+	complete := len(c.results) == c.expected
+	c.mu.Unlock()
+
+	if complete {
+		c.onDone(c.results)
+	}
+}
@@ -0,0 +1,311 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"qqbotrouter/config"
+)
+
+// classQueue holds the queued requests of one priority class
+type classQueue struct {
+	pq       PriorityQueue
+	inFlight int // Requests handed to a worker and not yet finished
+}
+
+// ClassStatus reports queue and capacity usage for a priority class
+type ClassStatus struct {
+	Queued   int `json:"queued"`
+	InFlight int `json:"in_flight"`
+	Reserved int `json:"reserved"`
+	Cap      int `json:"cap,omitempty"`
+}
+
+// classLimits are a class's reservation and cap in workers for the current pool size
+type classLimits struct {
+	reserved int
+	cap      int
+}
+
+// limitsFor converts a class's shares into worker counts
+func limitsFor(class config.PriorityClassConfig, workers int) classLimits {
+	limits := classLimits{reserved: int(class.ReservedShare * float64(workers))}
+	if class.MaxShare > 0 {
+		limits.cap = int(class.MaxShare * float64(workers))
+		if limits.cap < 1 {
+			limits.cap = 1
+		}
+	}
+	return limits
+}
+
+// priorityClasses returns the configured priority classes
+func (s *Scheduler) priorityClasses() []config.PriorityClassConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.schedulerConfig.PriorityClasses
+}
+
+// classQueueLocked returns the queue for a class, creating it if needed; s.queueMu must be held
+func (s *Scheduler) classQueueLocked(name string) *classQueue {
+	q, ok := s.queues[name]
+	if !ok {
+		q = &classQueue{pq: make(PriorityQueue, 0)}
+		heap.Init(&q.pq)
+		s.queues[name] = q
+	}
+	return q
+}
+
+// enqueue pushes a request onto its class queue and wakes the dispatcher
+func (s *Scheduler) enqueue(request *Request) {
+	if request.class == "" {
+		s.mu.RLock()
+		request.class = s.schedulerConfig.ClassForPriority(request.priority)
+		s.mu.RUnlock()
+	}
+
+	request.enqueued = time.Now()
+	s.queueMu.Lock()
+	heap.Push(&s.classQueueLocked(request.class).pq, request)
+	s.queueMu.Unlock()
+
+	s.wake()
+}
+
+// wake nudges the dispatcher to look at the queues again
+func (s *Scheduler) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dequeue pops the next request a worker may take, or returns nil if none is
+// eligible. Each class may always use its own reserved workers; beyond that a
+// class only gets workers not held in reserve for other busy classes, and
+// never more than its cap. A class with nothing queued or in flight holds no
+// reserve, so its workers are lent out until it has work again. Among
+// eligible classes the highest priority head wins.
+func (s *Scheduler) dequeue() *Request {
+	classes := s.priorityClasses()
+	workers := s.WorkerCount()
+	if workers < 1 {
+		workers = 1
+	}
+	free := workers - s.BusyWorkers()
+
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	limits := make(map[string]classLimits, len(classes))
+	outstanding := 0 // Reserved workers not currently used by their busy class
+	for _, class := range classes {
+		l := limitsFor(class, workers)
+		limits[class.Name] = l
+		q, ok := s.queues[class.Name]
+		if !ok || (len(q.pq) == 0 && q.inFlight == 0) {
+			continue // Idle classes lend out their reserve
+		}
+		if q.inFlight < l.reserved {
+			outstanding += l.reserved - q.inFlight
+		}
+	}
+
+	var best *classQueue
+	bestIndex := -1
+	for _, name := range s.classOrderLocked(classes) {
+		q := s.queues[name]
+		if q == nil || len(q.pq) == 0 {
+			continue
+		}
+		l := limits[name]
+		if l.cap > 0 && q.inFlight >= l.cap {
+			continue
+		}
+		if q.inFlight >= l.reserved && free-outstanding <= 0 {
+			continue // Only reserved capacity is left, and it belongs to other classes
+		}
+		index := s.nextEligibleLocked(q, workers)
+		if index < 0 {
+			continue
+		}
+		if best == nil || q.pq[index].priority > best.pq[bestIndex].priority {
+			best, bestIndex = q, index
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	return heap.Remove(&best.pq, bestIndex).(*Request)
+}
+
+// botWorkerCap returns how many workers a bot's requests may hold at once, 0 for no cap
+func botWorkerCap(bot config.BotConfig, workers int) int {
+	share := bot.Scheduler.MaxWorkerShare
+	if share <= 0 {
+		return 0
+	}
+	limit := int(share * float64(workers))
+	if limit < 1 {
+		limit = 1
+	}
+	return limit
+}
+
+// botCappedLocked reports whether a request's bot already holds its share of workers; s.queueMu must be held
+func (s *Scheduler) botCappedLocked(request *Request, workers int) bool {
+	limit := botWorkerCap(request.BotConfig, workers)
+	return limit > 0 && s.botInFlight[request.BotID] >= limit
+}
+
+// nextEligibleLocked returns the index in q of the highest priority request
+// whose bot is below its worker cap, or -1 if there is none; s.queueMu must be held
+func (s *Scheduler) nextEligibleLocked(q *classQueue, workers int) int {
+	if !s.botCappedLocked(q.pq[0], workers) {
+		return 0
+	}
+
+	// The head's bot is at its cap, so look past it for other bots' requests
+	best := -1
+	for i, request := range q.pq {
+		if s.botCappedLocked(request, workers) {
+			continue
+		}
+		if best < 0 || request.priority > q.pq[best].priority ||
+			(request.priority == q.pq[best].priority && request.timestamp.Before(q.pq[best].timestamp)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// classOrderLocked lists configured classes first, then any other queues in name order; s.queueMu must be held
+func (s *Scheduler) classOrderLocked(classes []config.PriorityClassConfig) []string {
+	order := make([]string, 0, len(s.queues))
+	seen := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		order = append(order, class.Name)
+		seen[class.Name] = true
+	}
+	var others []string
+	for name := range s.queues {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(order, others...)
+}
+
+// acquireSlot counts a request against its class and bot when it is handed to a worker
+func (s *Scheduler) acquireSlot(request *Request) {
+	s.queueMu.Lock()
+	s.classQueueLocked(request.class).inFlight++
+	s.botInFlight[request.BotID]++
+	s.queueMu.Unlock()
+}
+
+// releaseSlot frees a request's class and bot slots and wakes the dispatcher
+func (s *Scheduler) releaseSlot(request *Request) {
+	s.queueMu.Lock()
+	if q, ok := s.queues[request.class]; ok && q.inFlight > 0 {
+		q.inFlight--
+	}
+	if s.botInFlight[request.BotID] > 1 {
+		s.botInFlight[request.BotID]--
+	} else {
+		delete(s.botInFlight, request.BotID)
+	}
+	s.queueMu.Unlock()
+
+	s.wake()
+}
+
+// GetQueueSize returns the current queue size
+func (s *Scheduler) GetQueueSize() int {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	size := 0
+	for _, q := range s.queues {
+		size += len(q.pq)
+	}
+	return size
+}
+
+// ClassStats returns queue and capacity usage per priority class
+func (s *Scheduler) ClassStats() map[string]ClassStatus {
+	classes := s.priorityClasses()
+	workers := s.WorkerCount()
+
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	stats := make(map[string]ClassStatus, len(s.queues))
+	for name, q := range s.queues {
+		stats[name] = ClassStatus{Queued: len(q.pq), InFlight: q.inFlight}
+	}
+	for _, class := range classes {
+		l := limitsFor(class, workers)
+		status := stats[class.Name]
+		status.Reserved = l.reserved
+		status.Cap = l.cap
+		stats[class.Name] = status
+	}
+	return stats
+}
+
+// BotStatus reports a bot's worker usage
+type BotStatus struct {
+	InFlight int `json:"in_flight"`
+	Cap      int `json:"cap,omitempty"`
+}
+
+// BotStats returns the workers held by each bot with requests in flight
+func (s *Scheduler) BotStats() map[string]BotStatus {
+	workers := s.WorkerCount()
+	s.mu.RLock()
+	resolver := s.botResolver
+	s.mu.RUnlock()
+
+	s.queueMu.Lock()
+	stats := make(map[string]BotStatus, len(s.botInFlight))
+	for botID, inFlight := range s.botInFlight {
+		stats[botID] = BotStatus{InFlight: inFlight}
+	}
+	s.queueMu.Unlock()
+
+	if resolver != nil {
+		for botID, status := range stats {
+			if bot, ok := resolver(botID); ok {
+				status.Cap = botWorkerCap(bot, workers)
+				stats[botID] = status
+			}
+		}
+	}
+	return stats
+}
+
+// takeAll removes and returns every queued or deferred request in priority order
+func (s *Scheduler) takeAll() []*Request {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	var requests []*Request
+	for _, d := range s.deferred {
+		requests = append(requests, d.request)
+	}
+	s.deferred = nil
+	for _, q := range s.queues {
+		for len(q.pq) > 0 {
+			requests = append(requests, heap.Pop(&q.pq).(*Request))
+		}
+	}
+	sort.SliceStable(requests, func(i, j int) bool {
+		return requests[i].priority > requests[j].priority
+	})
+	return requests
+}
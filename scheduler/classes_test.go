@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"testing"
+	"time"
+
+	"qqbotrouter/config"
+	"qqbotrouter/stats"
+)
+
+func TestDequeueReservations(t *testing.T) {
+	// usage is one class's queued and in-flight requests
+	type usage struct {
+		queued   int
+		inFlight int
+	}
+	priorities := map[string]int{"admin": 10, "interactive": 7, "bulk": 3}
+
+	tests := []struct {
+		name      string
+		usage     map[string]usage
+		wantClass string // Empty if nothing may be dequeued
+	}{
+		{
+			name:      "idle class lends out its reserve",
+			usage:     map[string]usage{"interactive": {queued: 1, inFlight: 8}},
+			wantClass: "interactive",
+		},
+		{
+			name:  "reserve held while the class has work in flight",
+			usage: map[string]usage{"admin": {inFlight: 1}, "interactive": {queued: 1, inFlight: 8}},
+		},
+		{
+			name:      "reserve held for the class's queued work",
+			usage:     map[string]usage{"admin": {queued: 1}, "interactive": {queued: 1, inFlight: 8}},
+			wantClass: "admin",
+		},
+		{
+			name:      "class beyond its reserve shares the free workers",
+			usage:     map[string]usage{"admin": {inFlight: 2}, "interactive": {queued: 1, inFlight: 7}},
+			wantClass: "interactive",
+		},
+		{
+			name:  "cap applies even with idle reserves",
+			usage: map[string]usage{"bulk": {queued: 1, inFlight: 5}},
+		},
+		{
+			name:  "no free workers",
+			usage: map[string]usage{"admin": {queued: 1, inFlight: 2}, "interactive": {inFlight: 8}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultSchedulerConfig()
+			qosConfig := config.GetDefaultQoSConfig()
+			s := NewScheduler(stats.NewStatsAnalyzer(100), &cfg, &qosConfig, nil)
+			s.pool.ctx = context.Background()
+			s.pool.quits = make([]chan struct{}, 10)
+
+			now := time.Now()
+			for class, u := range tt.usage {
+				q := s.classQueueLocked(class)
+				q.inFlight = u.inFlight
+				s.pool.busy += int64(u.inFlight)
+				for i := 0; i < u.queued; i++ {
+					heap.Push(&q.pq, &Request{BotID: "bot", priority: priorities[class], class: class, timestamp: now})
+				}
+			}
+
+			got := ""
+			if request := s.dequeue(); request != nil {
+				got = request.class
+			}
+			if got != tt.wantClass {
+				t.Errorf("dequeued from %q, want %q", got, tt.wantClass)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/utils"
+)
+
+// Expiry actions
+const (
+	ExpiryActionDrop = "drop"
+	ExpiryActionLate = "late"
+)
+
+// ExpiryStats summarises requests that missed their passive-reply window for a bot
+type ExpiryStats struct {
+	Dropped int64 `json:"dropped"`
+	Late    int64 `json:"late"`
+}
+
+// expiryTracker counts expired requests per bot
+type expiryTracker struct {
+	mu    sync.Mutex
+	byBot map[string]*ExpiryStats
+}
+
+// eventDeadline derives the passive-reply deadline for an event. QQ only accepts
+// passive replies to a msg_id for a limited window after the event was created,
+// so the deadline is the event timestamp plus the window for its event type,
+// minus a safety margin for the downstream service to actually reply.
+// A zero time means the event never expires.
+func eventDeadline(info utils.MessageInfo, received time.Time, expiry config.MessageExpiryConfig) time.Time {
+	if !expiry.Enabled {
+		return time.Time{}
+	}
+
+	window := config.ParseDurationOrDefault(expiry.DefaultWindow, 0)
+	if eventWindow, ok := expiry.EventWindows[info.EventType]; ok {
+		window = config.ParseDurationOrDefault(eventWindow, 0)
+	}
+	if window <= 0 {
+		return time.Time{}
+	}
+
+	// Prefer the platform timestamp, but never trust one from the future
+	eventTime := info.Timestamp
+	if eventTime.IsZero() || eventTime.After(received) {
+		eventTime = received
+	}
+
+	margin := config.ParseDurationOrDefault(expiry.SafetyMargin, 0)
+	return eventTime.Add(window - margin)
+}
+
+// isExpired reports whether the request's passive-reply window has passed
+func (r *Request) isExpired(now time.Time) bool {
+	return !r.deadline.IsZero() && now.After(r.deadline)
+}
+
+// handleExpired records an expired request and reports whether it should
+// still be delivered to the bot's late endpoints.
+func (s *Scheduler) handleExpired(request *Request) bool {
+	s.mu.RLock()
+	action := s.schedulerConfig.MessageExpiry.Action
+	s.mu.RUnlock()
+
+	late := action == ExpiryActionLate && len(request.BotConfig.LateForwardTo) > 0
+
+	s.expiry.mu.Lock()
+	stats, ok := s.expiry.byBot[request.BotID]
+	if !ok {
+		stats = &ExpiryStats{}
+		s.expiry.byBot[request.BotID] = stats
+	}
+	if late {
+		stats.Late++
+	} else {
+		stats.Dropped++
+	}
+	s.expiry.mu.Unlock()
+
+	request.late = late
+	request.Logger.Warn("Request expired before delivery",
+		zap.String("bot", request.BotID),
+		zap.String("event_type", request.eventType),
+		zap.String("user_id", request.userID),
+		zap.Duration("queued_for", time.Since(request.timestamp)),
+		zap.Bool("routed_late", late))
+	if !late {
+		request.finish(false)
+	}
+	return late
+}
+
+// ExpiryStats returns expired request counts per bot
+func (s *Scheduler) ExpiryStats() map[string]ExpiryStats {
+	s.expiry.mu.Lock()
+	defer s.expiry.mu.Unlock()
+
+	result := make(map[string]ExpiryStats, len(s.expiry.byBot))
+	for botID, stats := range s.expiry.byBot {
+		result[botID] = *stats
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"strconv"
+
+	"qqbotrouter/forwarder"
+	"qqbotrouter/metrics"
+)
+
+// forwardMetrics records per-destination delivery latency and response codes
+type forwardMetrics struct {
+	latency   *metrics.HistogramVec
+	responses *metrics.CounterVec
+}
+
+// newForwardMetrics creates the per-destination forward metric families
+func newForwardMetrics() forwardMetrics {
+	return forwardMetrics{
+		latency: metrics.NewHistogramVec("qqbotrouter_forward_duration_seconds",
+			"Time taken by a destination to answer a forwarded event.",
+			metrics.DefaultBuckets, "bot", "destination"),
+		responses: metrics.NewCounterVec("qqbotrouter_forward_responses_total",
+			"Forwarded events by destination and response status code; code is \"error\" when no response arrived.",
+			"bot", "destination", "code"),
+	}
+}
+
+// observe records the result of each destination a bot's event was forwarded to
+func (m forwardMetrics) observe(botID string, results []forwarder.ForwardResult) {
+	for _, result := range results {
+		code := "error"
+		if result.StatusCode != 0 {
+			code = strconv.Itoa(result.StatusCode)
+		}
+		m.latency.With(botID, result.Destination).Observe(result.Latency.Seconds())
+		m.responses.With(botID, result.Destination, code).Inc()
+	}
+}
+
+// RegisterMetrics exposes forward results, queue depth, worker utilisation,
+// load shedding, expiry counters and learned route endpoint rewards on the registry
+func (s *Scheduler) RegisterMetrics(registry *metrics.Registry) error {
+	return registry.Register(
+		s.forwardMetrics.latency,
+		s.forwardMetrics.responses,
+		metrics.NewGaugeFunc("qqbotrouter_queue_depth",
+			"Requests waiting for a worker, by priority class.",
+			[]string{"class"},
+			func(emit metrics.EmitFunc) {
+				for class, status := range s.ClassStats() {
+					emit(float64(status.Queued), class)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_class_in_flight",
+			"Requests being processed by workers, by priority class.",
+			[]string{"class"},
+			func(emit metrics.EmitFunc) {
+				for class, status := range s.ClassStats() {
+					emit(float64(status.InFlight), class)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_bot_in_flight",
+			"Requests being processed by workers, by bot.",
+			[]string{"bot"},
+			func(emit metrics.EmitFunc) {
+				for botID, status := range s.BotStats() {
+					emit(float64(status.InFlight), botID)
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_workers",
+			"Running scheduler workers.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(float64(s.WorkerCount()))
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_workers_busy",
+			"Scheduler workers currently processing a request.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(float64(s.BusyWorkers()))
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_worker_utilisation",
+			"Fraction of scheduler workers that are busy (0 to 1).",
+			nil,
+			func(emit metrics.EmitFunc) {
+				utilisation := 0.0
+				if workers := s.WorkerCount(); workers > 0 {
+					utilisation = min(float64(s.BusyWorkers())/float64(workers), 1)
+				}
+				emit(utilisation)
+			}),
+		metrics.NewCounterFunc("qqbotrouter_shed_total",
+			"Requests removed from the queue by load shedding, by action.",
+			[]string{"action"},
+			func(emit metrics.EmitFunc) {
+				stats := s.ShedStats()
+				emit(float64(stats.Shed), "dropped")
+				emit(float64(stats.Deferred), "deferred")
+			}),
+		metrics.NewCounterFunc("qqbotrouter_defer_rejected_total",
+			"Requests refused because the delay queue was full.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(float64(s.ShedStats().DeferRejected))
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_shed_dropping",
+			"1 while the load shedder is in its dropping state.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				dropping := 0.0
+				if s.ShedStats().Dropping {
+					dropping = 1
+				}
+				emit(dropping)
+			}),
+		metrics.NewCounterFunc("qqbotrouter_expired_total",
+			"Requests that expired before delivery, by bot and outcome.",
+			[]string{"bot", "outcome"},
+			func(emit metrics.EmitFunc) {
+				for botID, stats := range s.ExpiryStats() {
+					emit(float64(stats.Dropped), botID, "dropped")
+					emit(float64(stats.Late), botID, "late")
+				}
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_route_endpoint_reward",
+			"Delivery reward learned for an endpoint of a bandit route (0 to 1).",
+			[]string{"bot", "route", "endpoint"},
+			func(emit metrics.EmitFunc) {
+				for _, stats := range s.RouteEndpointStats() {
+					emit(stats.Reward, stats.BotID, stats.Route, stats.Endpoint)
+				}
+			}),
+	)
+}
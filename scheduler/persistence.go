@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/utils"
+)
+
+// queueSnapshotVersion is bumped whenever the snapshot format changes incompatibly
+const queueSnapshotVersion = 1
+
+// BotResolver looks up the current configuration of a bot by its ID
+type BotResolver func(botID string) (config.BotConfig, bool)
+
+// queueSnapshot is the on-disk form of requests left in the queue at shutdown
+type queueSnapshot struct {
+	Version  int                `json:"version"`
+	SavedAt  time.Time          `json:"saved_at"`
+	Requests []persistedRequest `json:"requests"`
+}
+
+// persistedRequest is a queued request without its runtime-only fields
+type persistedRequest struct {
+	BotID     string      `json:"bot_id"`
+	Body      []byte      `json:"body"`
+	Header    http.Header `json:"header"`
+	Priority  int         `json:"priority"`
+	Timestamp time.Time   `json:"timestamp"`
+	Deadline  time.Time   `json:"deadline,omitempty"`
+}
+
+// SetSnapshotPath sets the file used to persist the queue across restarts
+func (s *Scheduler) SetSnapshotPath(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshotPath = path
+}
+
+// SetBotResolver sets the lookup used to re-attach bot configuration to restored requests
+func (s *Scheduler) SetBotResolver(resolver BotResolver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.botResolver = resolver
+}
+
+// saveSnapshot writes the given requests to the snapshot file atomically
+func (s *Scheduler) saveSnapshot(requests []*Request) error {
+	s.mu.RLock()
+	path := s.snapshotPath
+	s.mu.RUnlock()
+	if path == "" || len(requests) == 0 {
+		return nil
+	}
+
+	snapshot := queueSnapshot{
+		Version:  queueSnapshotVersion,
+		SavedAt:  time.Now(),
+		Requests: make([]persistedRequest, 0, len(requests)),
+	}
+	for _, request := range requests {
+		snapshot.Requests = append(snapshot.Requests, persistedRequest{
+			BotID:     request.BotID,
+			Body:      request.Body,
+			Header:    request.Header,
+			Priority:  request.priority,
+			Timestamp: request.timestamp,
+			Deadline:  request.deadline,
+		})
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue snapshot: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write queue snapshot: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace queue snapshot: %w", err)
+	}
+	return nil
+}
+
+// restoreSnapshot re-queues requests persisted by a previous run and removes the snapshot
+func (s *Scheduler) restoreSnapshot() {
+	s.mu.RLock()
+	path := s.snapshotPath
+	resolver := s.botResolver
+	s.mu.RUnlock()
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			zap.L().Error("Failed to read queue snapshot", zap.String("path", path), zap.Error(err))
+		}
+		return
+	}
+
+	var snapshot queueSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil || snapshot.Version != queueSnapshotVersion {
+		zap.L().Error("Discarding unreadable queue snapshot",
+			zap.String("path", path),
+			zap.Int("version", snapshot.Version),
+			zap.Error(err))
+		os.Remove(path)
+		return
+	}
+
+	restored, skipped := 0, 0
+	for _, persisted := range snapshot.Requests {
+		var botConfig config.BotConfig
+		ok := false
+		if resolver != nil {
+			botConfig, ok = resolver(persisted.BotID)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+
+		msgInfo := utils.ExtractMessageInfo(persisted.Body)
+		request := &Request{
+			Context:   context.Background(),
+			Body:      persisted.Body,
+			Header:    persisted.Header,
+			BotID:     persisted.BotID,
+			BotConfig: botConfig,
+			Logger:    zap.L(),
+			priority:  persisted.Priority,
+			userID:    msgInfo.UserID,
+			message:   msgInfo.Message,
+			eventType: msgInfo.EventType,
+			info:      msgInfo,
+			timestamp: persisted.Timestamp,
+			deadline:  persisted.Deadline,
+		}
+		s.enqueue(request)
+		restored++
+	}
+
+	if err := os.Remove(path); err != nil {
+		zap.L().Error("Failed to remove queue snapshot", zap.String("path", path), zap.Error(err))
+	}
+	zap.L().Info("Restored queue snapshot",
+		zap.String("path", path),
+		zap.Time("saved_at", snapshot.SavedAt),
+		zap.Int("restored", restored),
+		zap.Int("skipped_unknown_bot", skipped))
+}
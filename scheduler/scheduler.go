@@ -1,11 +1,12 @@
 package scheduler
 
 import (
-	"container/heap"
 	"context"
 	"net/http"
+	"reflect"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -13,6 +14,9 @@ import (
 	"qqbotrouter/config"
 	"qqbotrouter/forwarder"
 	"qqbotrouter/interfaces"
+	"qqbotrouter/priority"
+	"qqbotrouter/rules"
+	"qqbotrouter/tracing"
 	"qqbotrouter/utils"
 )
 
@@ -21,13 +25,72 @@ type Request struct {
 	Context   context.Context
 	Body      []byte
 	Header    http.Header
+	BotID     string
 	BotConfig config.BotConfig
 	Logger    *zap.Logger
 	priority  int
+	class     string             // Priority class, see config.PriorityClassConfig
+	decision  *priority.Decision // Priority breakdown, nil for restored requests
 	index     int
 	userID    string
 	message   string
+	eventType string
+	info      utils.MessageInfo
 	timestamp time.Time
+	deadline  time.Time // Passive-reply deadline, zero if the event never expires
+	enqueued  time.Time // When the request last entered the queue, for sojourn time
+	late      bool      // Expired and routed to the bot's late endpoints
+	banditKey string    // Route whose bandit chose the destination, empty otherwise
+
+	completion Completion // Notified once when the request leaves the scheduler, empty for restored requests
+}
+
+// Completion is notified once when a request leaves the scheduler
+type Completion struct {
+	// Done is called with whether any destination accepted the request
+	Done func(success bool)
+
+	// Persisted is called instead of Done when the request is saved to the
+	// queue snapshot at shutdown. Requests without it are failed rather than
+	// saved, as their sender reports the failure itself, e.g. in a failure
+	// ACK that makes the platform redeliver the event.
+	Persisted func()
+
+	// Release, if set, is called when a deferred request's delay has passed
+	// and reports whether it may be queued now. A request it refuses leaves
+	// the scheduler without Done or Persisted being called.
+	Release func() bool
+}
+
+// finish reports the request's final outcome to its completion callback
+func (r *Request) finish(success bool) {
+	if r.completion.Done != nil {
+		r.completion.Done(success)
+	}
+	r.completion = Completion{}
+}
+
+// release asks whether a deferred request may be queued now that its delay has passed
+func (r *Request) release() bool {
+	if r.completion.Release == nil || r.completion.Release() {
+		return true
+	}
+	r.completion = Completion{}
+	return false
+}
+
+// persisted reports that the request was saved to the queue snapshot
+func (r *Request) persisted() {
+	if r.completion.Persisted != nil {
+		r.completion.Persisted()
+	}
+	r.completion = Completion{}
+}
+
+// persistable reports whether the request may be saved to the queue snapshot
+// at shutdown; requests nobody waits on, such as restored ones, always may
+func (r *Request) persistable() bool {
+	return r.completion.Persisted != nil || r.completion.Done == nil
 }
 
 // PriorityQueue implements heap.Interface and holds Requests.
@@ -64,152 +127,337 @@ func (pq *PriorityQueue) Pop() interface{} {
 
 // Scheduler handles asynchronous request processing and priority scheduling.
 type Scheduler struct {
-	pq               PriorityQueue
 	statsProvider    interfaces.StatProvider
 	schedulerConfig  *config.SchedulerConfig
 	qosConfig        *config.QoSConfig
 	loadProvider     interfaces.LoadProvider
 	workerPool       chan *Request
-	userLastRequest  map[string]time.Time // Track last request time per user
-	mu               sync.RWMutex         // Protect userLastRequest map
-	priorityStrategy PriorityStrategy     // Strategy for priority calculation
+	mu               sync.RWMutex                   // Protect configuration and strategy
+	priorityStrategy PriorityStrategy               // Strategy for priority calculation
+	userGroups       map[string]map[string]bool     // Named user lists for user.in("group") in route conditions
+	pipeline         *priority.Pipeline             // Unified priority pipeline
+	intervalStage    *priority.RequestIntervalStage // Anti-spam interval tracking
+	queueMu          sync.Mutex                     // Protect queues
+	queues           map[string]*classQueue         // Queued requests per priority class
+	botInFlight      map[string]int                 // Requests handed to a worker per bot, protected by queueMu
+	notify           chan struct{}                  // Wakes the dispatcher when a request is queued
+	pool             workerPoolState                // Running workers, resizable at runtime
+	expiry           expiryTracker                  // Expired request counts per bot
+	batcher          *batcher                       // Groups events for batch-delivery destinations
+	shedder          codelShedder                   // Sheds low-priority work when queue delay stays high
+	deferred         []deferredRequest              // Shed and deferred requests waiting to be re-queued, protected by queueMu
+	draining         int32                          // Set once shutdown begins; new submissions are refused
+	snapshotPath     string                         // Where the queue is persisted on shutdown
+	botResolver      BotResolver                    // Re-attaches bot configuration to restored requests
+	latencyObserver  LatencyObserver                // Receives per-bot forward latency samples
+	forwardMetrics   forwardMetrics                 // Per-destination latency and status codes
+	observer         interfaces.Observer            // Receives per-destination forward latency, nil if unset
+	spamScorer       interfaces.SpamScorer          // Scores messages for the priority pipeline and routes, nil if unset
+	conditionsMu     sync.Mutex                     // Protect conditions
+	conditions       map[string]*rules.Expr         // Compiled route conditions by source
+	bandit           *destinationBandit             // Learned endpoint selection for routes with selection: bandit
 }
 
 // NewScheduler creates a new Scheduler.
 func NewScheduler(statsProvider interfaces.StatProvider, schedulerConfig *config.SchedulerConfig, qosConfig *config.QoSConfig, loadProvider interfaces.LoadProvider) *Scheduler {
 	s := &Scheduler{
-		pq:               make(PriorityQueue, 0),
 		statsProvider:    statsProvider,
 		schedulerConfig:  schedulerConfig,
 		qosConfig:        qosConfig,
 		loadProvider:     loadProvider,
-		workerPool:       make(chan *Request, schedulerConfig.WorkerPoolSize),
-		userLastRequest:  make(map[string]time.Time),
+		workerPool:       make(chan *Request),
 		priorityStrategy: NewHybridStrategy(0.6, 0.4), // Default to hybrid strategy
+		intervalStage:    priority.NewRequestIntervalStage(),
+		notify:           make(chan struct{}, 1),
+		queues:           make(map[string]*classQueue),
+		botInFlight:      make(map[string]int),
+		expiry:           expiryTracker{byBot: make(map[string]*ExpiryStats)},
+		conditions:       make(map[string]*rules.Expr),
+		userGroups:       userGroupSets(schedulerConfig.PriorityStrategy.UserGroups),
+		forwardMetrics:   newForwardMetrics(),
+		bandit:           newDestinationBandit(),
+	}
+	if strategy, err := NewPriorityStrategy(schedulerConfig.PriorityStrategy); err != nil {
+		zap.L().Error("Invalid priority strategy, falling back to hybrid",
+			zap.String("strategy", schedulerConfig.PriorityStrategy.Name),
+			zap.Error(err))
+	} else {
+		s.priorityStrategy = strategy
+	}
+	s.pipeline = priority.NewPipeline(
+		&priority.KeywordStage{},
+		&priority.UserTierStage{},
+		&strategyStage{scheduler: s},
+		s.intervalStage,
+	)
+	s.batcher = newBatcher(s.sendBatch)
+	s.pool.desired = clampPoolSize(schedulerConfig.WorkerPoolSize, schedulerConfig.WorkerAutoscaling)
+	if s.pool.desired < 1 {
+		s.pool.desired = 1
 	}
-	heap.Init(&s.pq)
 	return s
 }
 
-// Submit submits a new request to the scheduler and returns success status.
-func (s *Scheduler) Submit(ctx context.Context, body []byte, header http.Header, botConfig config.BotConfig, logger *zap.Logger) bool {
-	// Parse message content to extract user info
-	userID, message := s.parseMessage(body)
+// SetSpamScorer sets the classifier whose spam score feeds the priority pipeline and route conditions
+func (s *Scheduler) SetSpamScorer(scorer interfaces.SpamScorer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spamScorer = scorer
+}
+
+// Prioritize runs the priority pipeline once for an event. The resulting
+// decision is used for throttling and then passed to Submit for ordering.
+func (s *Scheduler) Prioritize(botID string, msgInfo utils.MessageInfo) *priority.Decision {
+	s.mu.RLock()
+	env := &priority.Env{Config: s.schedulerConfig, Stats: s.statsProvider}
+	scorer := s.spamScorer
+	classification := s.schedulerConfig.MessageClassification
+	s.mu.RUnlock()
+
+	input := &priority.Input{
+		BotID:       botID,
+		UserID:      msgInfo.UserID,
+		Message:     msgInfo.Message,
+		EventType:   msgInfo.EventType,
+		ContentType: msgInfo.ContentType,
+		Info:        msgInfo,
+		Received:    time.Now(),
+	}
+	// Score once per event; the decision carries the score on to route conditions
+	if scorer != nil && classification.Enabled && classification.SpamDetection && msgInfo.Message != "" {
+		input.SpamScore, input.SpamScored = scorer.SpamScore(msgInfo.Message)
+	}
+	return s.pipeline.Evaluate(input, env)
+}
+
+// RecentDecisions returns recent priority decisions with their per-stage breakdown, newest first
+func (s *Scheduler) RecentDecisions() []priority.Decision {
+	return s.pipeline.Recent()
+}
+
+// Submit submits a new request to the scheduler and returns whether it was queued.
+// decision is the event's priority from Prioritize; if nil it is computed here.
+// If the request is queued, completion is notified once it has been
+// delivered, dropped or saved to the queue snapshot at shutdown.
+func (s *Scheduler) Submit(ctx context.Context, body []byte, header http.Header, botID string, botConfig config.BotConfig, decision *priority.Decision, logger *zap.Logger, completion Completion) bool {
+	// Refuse new work once shutdown has started
+	if atomic.LoadInt32(&s.draining) == 1 {
+		logger.Warn("Scheduler is draining, request rejected", zap.String("bot", botID))
+		return false
+	}
+
+	s.enqueue(s.newRequest(ctx, body, header, botID, botConfig, decision, logger, completion))
+	return true // Successfully queued
+}
+
+// Defer holds a request in the delay queue and queues it once delay has
+// passed and completion.Release allows it. It takes the same arguments as
+// Submit; deferred requests are persisted with the queue if shutdown begins
+// first. It returns false if the scheduler is draining or the delay queue is full.
+func (s *Scheduler) Defer(ctx context.Context, body []byte, header http.Header, botID string, botConfig config.BotConfig, decision *priority.Decision, logger *zap.Logger, delay time.Duration, completion Completion) bool {
+	if atomic.LoadInt32(&s.draining) == 1 {
+		logger.Warn("Scheduler is draining, deferred request rejected", zap.String("bot", botID))
+		return false
+	}
+
+	request := s.newRequest(ctx, body, header, botID, botConfig, decision, logger, completion)
+	if !s.holdDeferred(request, time.Now().Add(delay)) {
+		logger.Warn("Delay queue is full, deferred request rejected",
+			zap.String("bot", botID),
+			zap.String("user_id", request.userID))
+		return false
+	}
+	return true
+}
+
+// newRequest builds a request for an incoming event, computing its priority if decision is nil
+func (s *Scheduler) newRequest(ctx context.Context, body []byte, header http.Header, botID string, botConfig config.BotConfig, decision *priority.Decision, logger *zap.Logger, completion Completion) *Request {
+	// Parse message content to extract user and event info
+	msgInfo := utils.ExtractMessageInfo(body)
 
-	// Calculate dynamic priority based on stats and config
-	priority := s.calculatePriority(userID, message)
+	// Priority is computed once per event; only evaluate if the caller did not
+	if decision == nil {
+		decision = s.Prioritize(botID, msgInfo)
+	}
+
+	now := time.Now()
+	s.mu.RLock()
+	deadline := eventDeadline(msgInfo, now, s.schedulerConfig.MessageExpiry)
+	s.mu.RUnlock()
 
-	request := &Request{
+	return &Request{
 		Context:   ctx,
 		Body:      body,
 		Header:    header,
+		BotID:     botID,
 		BotConfig: botConfig,
 		Logger:    logger,
-		priority:  priority,
-		userID:    userID,
-		message:   message,
-		timestamp: time.Now(),
+		priority:  decision.Priority,
+		class:     decision.Class,
+		decision:  decision,
+		userID:    msgInfo.UserID,
+		message:   msgInfo.Message,
+		eventType: msgInfo.EventType,
+		info:      msgInfo,
+		timestamp: now,
+		deadline:  deadline,
+
+		completion: completion,
 	}
-	heap.Push(&s.pq, request)
-	return true // Successfully queued
 }
 
 // Run starts the scheduler with context support
 func (s *Scheduler) Run(ctx context.Context) error {
-	// Start worker goroutines
-	for i := 0; i < s.schedulerConfig.WorkerPoolSize; i++ {
-		go s.workerWithContext(ctx)
-	}
+	// Workers outlive ctx so the queue can still be drained once shutdown begins
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Re-queue anything persisted by the previous run, then start workers and the autoscaler
+	s.restoreSnapshot()
+	s.startWorkers(workerCtx)
+	go s.autoscaleLoop(ctx)
 
 	for {
-		select {
-		case <-ctx.Done():
-			close(s.workerPool)
-			return ctx.Err()
-		default:
-			if len(s.pq) > 0 {
-				request := heap.Pop(&s.pq).(*Request)
-				select {
-				case s.workerPool <- request:
-				case <-ctx.Done():
-					close(s.workerPool)
-					return ctx.Err()
-				}
-			} else {
-				// Prevent busy-waiting when the queue is empty
-				idleInterval := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.IdleCheckInterval)
-				select {
-				case <-time.After(idleInterval):
-				case <-ctx.Done():
-					close(s.workerPool)
-					return ctx.Err()
-				}
+		s.releaseDeferred(time.Now())
+
+		request := s.dequeue()
+		if request == nil {
+			if s.GetQueueSize() == 0 {
+				s.shedder.idle()
+			}
+
+			// Prevent busy-waiting when the queue is empty
+			idleInterval := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.IdleCheckInterval)
+			select {
+			case <-s.notify:
+			case <-time.After(idleInterval):
+			case <-ctx.Done():
+				s.drain()
+				return ctx.Err()
 			}
+			continue
+		}
+
+		// Drop expired requests before they occupy a worker
+		now := time.Now()
+		if request.isExpired(now) && !s.handleExpired(request) {
+			continue
+		}
+
+		// Shed low-priority work while queue delay stays above target
+		if s.shedIfOverloaded(request, now) {
+			continue
+		}
+
+		if !s.dispatch(request, ctx.Done()) {
+			s.enqueue(request)
+			s.drain()
+			return ctx.Err()
 		}
 	}
 }
 
-// parseMessage extracts user ID and message content from request body
-func (s *Scheduler) parseMessage(body []byte) (userID, message string) {
-	return utils.ParseMessage(body)
+// dispatch hands a request to a worker. The request counts as busy from this
+// point so draining never mistakes a hand-off in progress for an idle pool.
+// It returns false if stop fires before a worker picks the request up.
+func (s *Scheduler) dispatch(request *Request, stop <-chan struct{}) bool {
+	atomic.AddInt64(&s.pool.busy, 1)
+	s.acquireSlot(request)
+	select {
+	case s.workerPool <- request:
+		return true
+	case <-stop:
+		atomic.AddInt64(&s.pool.busy, -1)
+		s.releaseSlot(request)
+		return false
+	}
 }
 
-// calculatePriority calculates request priority using the configured strategy
-func (s *Scheduler) calculatePriority(userID, message string) int {
-	// Determine content type from message
-	contentType := s.determineContentType(message)
+// drain stops accepting new requests and keeps dispatching the queue until it
+// is empty and all workers are idle, or the drain timeout passes. Partial
+// batches are flushed and whatever is still queued is persisted to disk,
+// except requests whose sender reports their failure itself.
+func (s *Scheduler) drain() {
+	atomic.StoreInt32(&s.draining, 1)
 
-	// Use strategy pattern for priority calculation
-	priority := s.priorityStrategy.CalculatePriority(userID, contentType, s.statsProvider, s.schedulerConfig)
+	s.mu.RLock()
+	shutdown := s.schedulerConfig.Shutdown
+	persistQueue := shutdown.PersistQueue && s.snapshotPath != ""
+	s.mu.RUnlock()
 
-	// Apply anti-spam detection using P50 baseline
-	now := time.Now()
-	s.mu.Lock()
-	lastRequestTime, exists := s.userLastRequest[userID]
-	s.userLastRequest[userID] = now
-	s.mu.Unlock()
-
-	if exists {
-		requestInterval := now.Sub(lastRequestTime)
-		p50Baseline := s.statsProvider.P50()
-
-		// If user's request interval is much shorter than P50 baseline, consider it spam
-		if p50Baseline > 0 && requestInterval < p50Baseline/3 {
-			priority -= s.schedulerConfig.PrioritySettings.HighLoadAdjustment * 2 // Significant penalty for potential spam
-		} else if p50Baseline > 0 && requestInterval < p50Baseline/2 {
-			priority -= s.schedulerConfig.PrioritySettings.HighLoadAdjustment // Moderate penalty for fast requests
+	timeout := config.ParseDurationOrDefault(shutdown.DrainTimeout, 20*time.Second)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	zap.L().Info("Draining scheduler queue",
+		zap.Int("queued", s.GetQueueSize()),
+		zap.Duration("timeout", timeout))
+
+drainLoop:
+	for {
+		request := s.dequeue()
+		if request == nil {
+			if s.BusyWorkers() == 0 {
+				break
+			}
+			select {
+			case <-drainCtx.Done():
+				break drainLoop
+			case <-time.After(10 * time.Millisecond):
+			}
+			continue
 		}
-	}
 
-	// Ensure priority is within valid range
-	if priority < s.schedulerConfig.PrioritySettings.MinPriority {
-		priority = s.schedulerConfig.PrioritySettings.MinPriority
-	} else if priority > s.schedulerConfig.PrioritySettings.MaxPriority {
-		priority = s.schedulerConfig.PrioritySettings.MaxPriority
+		if request.isExpired(time.Now()) && !s.handleExpired(request) {
+			continue
+		}
+
+		if !s.dispatch(request, drainCtx.Done()) {
+			s.enqueue(request)
+			break
+		}
 	}
 
-	return priority
-}
+	// Deliver partial batches rather than leaving them behind
+	s.batcher.flushAll()
 
-// determineContentType analyzes message content to determine its type
-func (s *Scheduler) determineContentType(message string) string {
-	// Simple content type detection based on message patterns
-	if len(message) == 0 {
-		return "empty"
+	remaining := s.takeAll()
+	if len(remaining) == 0 {
+		zap.L().Info("Scheduler queue drained")
+		return
 	}
 
-	// Check for common patterns
-	if len(message) > 1000 {
-		return "long_text"
+	var persist []*Request
+	for _, request := range remaining {
+		if persistQueue && request.persistable() {
+			persist = append(persist, request)
+		} else {
+			request.finish(false)
+		}
 	}
-
-	// Check for URLs or file references
-	if utils.ContainsURL(message) {
-		return "url"
+	if discarded := len(remaining) - len(persist); discarded > 0 {
+		zap.L().Warn("Drain timeout reached, failing queued requests",
+			zap.Int("discarded", discarded))
+	}
+	if len(persist) == 0 {
+		return
 	}
 
-	// Default to text
-	return "text"
+	if err := s.saveSnapshot(persist); err != nil {
+		zap.L().Error("Failed to persist queued requests",
+			zap.Int("lost", len(persist)),
+			zap.Error(err))
+		for _, request := range persist {
+			request.finish(false)
+		}
+		return
+	}
+	for _, request := range persist {
+		request.persisted()
+	}
+	zap.L().Info("Persisted undelivered requests for next start",
+		zap.Int("persisted", len(persist)),
+		zap.String("path", s.snapshotPath))
 }
 
 // SetPriorityStrategy allows changing the priority calculation strategy
@@ -219,104 +467,149 @@ func (s *Scheduler) SetPriorityStrategy(strategy PriorityStrategy) {
 	s.priorityStrategy = strategy
 }
 
-// worker processes requests from the worker pool.
-func (s *Scheduler) worker() {
-	for request := range s.workerPool {
-		// Implement intelligent routing logic
-		destinations := s.selectDestinations(request)
-
-		// Forward request and get results
-		processingTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ProcessingTimeout)
-		forwardTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ForwardTimeout)
-		results := forwarder.ForwardToMultipleDestinations(
-			request.Context,
-			request.Logger,
-			destinations,
-			request.Body,
-			request.Header,
-			processingTimeout,
-			s.loadProvider,
-			forwardTimeout,
-		)
-
-		// Check if any destination succeeded
-		success := false
-		for _, result := range results {
-			if result.Success {
-				success = true
-				break
-			}
-		}
+// processRequest routes and forwards a single request.
+func (s *Scheduler) processRequest(request *Request) {
+	now := time.Now()
+	expired := !request.late && request.isExpired(now)
+	s.traceQueueWait(request, now, expired)
+
+	// The request may have expired while waiting for a worker
+	if expired && !s.handleExpired(request) {
+		return
+	}
+
+	// Implement intelligent routing logic
+	destinations := s.selectDestinations(request)
 
-		// Log processing result
-		if success {
-			request.Logger.Debug("Request processed successfully",
-				zap.String("user_id", request.userID),
-				zap.Int("priority", request.priority),
-				zap.Int("successful_destinations", len(results)))
+	// Split off destinations that opted into batch delivery
+	var direct []string
+	type batchedDestination struct {
+		destination string
+		settings    batchSettings
+	}
+	var batched []batchedDestination
+	for _, destination := range destinations {
+		if settings, ok := s.batchSettingsFor(destination); ok {
+			batched = append(batched, batchedDestination{destination, settings})
 		} else {
-			request.Logger.Warn("Request processing failed",
-				zap.String("user_id", request.userID),
-				zap.Int("priority", request.priority),
-				zap.Int("failed_destinations", len(results)))
+			direct = append(direct, destination)
 		}
 	}
+
+	// Forward request and get results
+	processingTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ProcessingTimeout)
+	forwardTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ForwardTimeout)
+	forwardStart := time.Now()
+	results := forwarder.ForwardToMultipleDestinations(
+		request.Context,
+		request.Logger,
+		direct,
+		request.Body,
+		request.Header,
+		processingTimeout,
+		s.loadProvider,
+		forwardTimeout,
+	)
+	s.observeForwards(request.BotID, results)
+	if len(direct) > 0 {
+		s.recordForwardLatency(request.BotID, time.Since(forwardStart), anySucceeded(results))
+	}
+
+	if len(batched) == 0 {
+		s.completeRequest(request, results)
+		return
+	}
+
+	// Batched destinations report back asynchronously once their batch is sent
+	collector := &resultCollector{
+		expected: len(results) + len(batched),
+		onDone: func(all []forwarder.ForwardResult) {
+			s.completeRequest(request, all)
+		},
+	}
+	for _, result := range results {
+		collector.add(result)
+	}
+	for _, b := range batched {
+		s.batcher.add(b.destination, b.settings, batchItem{
+			ctx:    request.Context,
+			botID:  request.BotID,
+			body:   request.Body,
+			logger: request.Logger,
+			done:   collector.add,
+		})
+	}
 }
 
-// workerWithContext processes requests from the worker pool with context support for graceful shutdown.
-func (s *Scheduler) workerWithContext(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case request, ok := <-s.workerPool:
-			if !ok {
-				return // Channel closed
-			}
-			// Implement intelligent routing logic
-			destinations := s.selectDestinations(request)
-
-			// Forward request and get results
-			processingTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ProcessingTimeout)
-			forwardTimeout := s.qosConfig.ParseDuration(s.qosConfig.RequestTimeouts.ForwardTimeout)
-			results := forwarder.ForwardToMultipleDestinations(
-				request.Context,
-				request.Logger,
-				destinations,
-				request.Body,
-				request.Header,
-				processingTimeout,
-				s.loadProvider,
-				forwardTimeout,
-			)
-
-			// Check if any destination succeeded
-			success := false
-			for _, result := range results {
-				if result.Success {
-					success = true
-					break
-				}
-			}
+// traceQueueWait records the time a request spent queued as a span of its trace
+func (s *Scheduler) traceQueueWait(request *Request, now time.Time, expired bool) {
+	start := request.enqueued
+	if start.IsZero() {
+		start = request.timestamp
+	}
+	_, span := tracing.Start(request.Context, "queue_wait",
+		tracing.WithStartTime(start),
+		tracing.WithAttributes(
+			tracing.String("priority.class", request.class),
+			tracing.Int("priority", request.priority),
+			tracing.Bool("expired", expired),
+			tracing.Bool("late", request.late),
+		))
+	span.EndAt(now)
+}
 
-			// Log processing result
-			if success {
-				request.Logger.Debug("Request processed successfully",
-					zap.String("user_id", request.userID),
-					zap.Int("priority", request.priority),
-					zap.Int("successful_destinations", len(results)))
-			} else {
-				request.Logger.Warn("Request processing failed",
-					zap.String("user_id", request.userID),
-					zap.Int("priority", request.priority),
-					zap.Int("failed_destinations", len(results)))
-			}
+// anySucceeded reports whether at least one destination accepted the request
+func anySucceeded(results []forwarder.ForwardResult) bool {
+	for _, result := range results {
+		if result.Success {
+			return true
 		}
 	}
+	return false
+}
+
+// completeRequest logs the outcome of a request once every destination has reported
+func (s *Scheduler) completeRequest(request *Request, results []forwarder.ForwardResult) {
+	if request.banditKey != "" {
+		s.mu.RLock()
+		settings := newBanditSettings(s.schedulerConfig)
+		s.mu.RUnlock()
+		s.bandit.record(request.banditKey, results, settings)
+	}
+
+	// Check if any destination succeeded
+	success := false
+	succeeded := 0
+	for _, result := range results {
+		if result.Success {
+			success = true
+			succeeded++
+		}
+	}
+
+	// Log processing result
+	if success {
+		request.Logger.Debug("Request processed successfully",
+			zap.String("user_id", request.userID),
+			zap.Int("priority", request.priority),
+			zap.Int("successful_destinations", succeeded))
+	} else {
+		request.Logger.Warn("Request processing failed",
+			zap.String("user_id", request.userID),
+			zap.Int("priority", request.priority),
+			zap.Int("failed_destinations", len(results)))
+	}
+
+	request.finish(success)
 }
 
 // selectDestinations implements intelligent routing based on message content and config
 func (s *Scheduler) selectDestinations(request *Request) []string {
+	// Expired requests only go to the bot's late endpoints
+	if request.late {
+		return request.BotConfig.LateForwardTo
+	}
+
 	// First, check regex routes
 	if destinations := s.checkRegexRoutes(request); len(destinations) > 0 {
 		return destinations
@@ -335,13 +628,13 @@ func (s *Scheduler) checkRegexRoutes(request *Request) []string {
 			continue
 		}
 
-		if matched {
+		if matched && s.routeConditionsMatch(request, pattern, routeConfig) {
 			// Return URLs or Endpoints based on configuration
 			if len(routeConfig.URLs) > 0 {
-				return routeConfig.URLs
+				return s.selectEndpoints(request, pattern, routeConfig, routeConfig.URLs)
 			}
 			if len(routeConfig.Endpoints) > 0 {
-				return routeConfig.Endpoints
+				return s.selectEndpoints(request, pattern, routeConfig, routeConfig.Endpoints)
 			}
 		}
 	}
@@ -349,6 +642,91 @@ func (s *Scheduler) checkRegexRoutes(request *Request) []string {
 	return nil
 }
 
+// selectEndpoints applies a matched route's selection mode to its endpoints.
+// Bandit routes select by hash while cognitive scheduling is disabled.
+func (s *Scheduler) selectEndpoints(request *Request, pattern string, routeConfig config.RegexRouteConfig, endpoints []string) []string {
+	mode := routeConfig.SelectionMode()
+	if mode == config.RouteSelectAll || len(endpoints) == 1 {
+		return endpoints
+	}
+
+	s.mu.RLock()
+	enabled := s.schedulerConfig.CognitiveScheduling.Enabled
+	settings := newBanditSettings(s.schedulerConfig)
+	s.mu.RUnlock()
+
+	if mode == config.RouteSelectBandit && enabled {
+		request.banditKey = routeKey(request.BotID, pattern)
+		return []string{s.bandit.choose(request.BotID, pattern, endpoints, settings, time.Now())}
+	}
+	return []string{hashEndpoint(request.userID, endpoints)}
+}
+
+// routeConditionsMatch applies a route's content type filter and condition expression
+func (s *Scheduler) routeConditionsMatch(request *Request, pattern string, routeConfig config.RegexRouteConfig) bool {
+	if len(routeConfig.ContentTypes) > 0 {
+		allowed := false
+		for _, contentType := range routeConfig.ContentTypes {
+			if contentType == request.info.ContentType {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	if routeConfig.Condition == "" {
+		return true
+	}
+	condition, err := s.compiledCondition(routeConfig.Condition)
+	if err != nil {
+		request.Logger.Warn("Invalid route condition",
+			zap.String("pattern", pattern),
+			zap.String("condition", routeConfig.Condition),
+			zap.Error(err))
+		return false
+	}
+	s.mu.RLock()
+	userGroups := s.userGroups
+	s.mu.RUnlock()
+	return condition.Eval(&priority.RuleEnv{Input: request.ruleInput(), Stats: s.statsProvider, Lists: userGroups})
+}
+
+// compiledCondition returns a cached compiled route condition
+func (s *Scheduler) compiledCondition(source string) (*rules.Expr, error) {
+	s.conditionsMu.Lock()
+	defer s.conditionsMu.Unlock()
+
+	if expr, ok := s.conditions[source]; ok {
+		return expr, nil
+	}
+	expr, err := rules.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+	s.conditions[source] = expr
+	return expr, nil
+}
+
+// ruleInput describes the request to rule expressions
+func (r *Request) ruleInput() *priority.Input {
+	input := &priority.Input{
+		BotID:       r.BotID,
+		UserID:      r.userID,
+		Message:     r.message,
+		EventType:   r.eventType,
+		ContentType: r.info.ContentType,
+		Info:        r.info,
+		Received:    r.timestamp,
+	}
+	if r.decision != nil && r.decision.SpamScore != nil {
+		input.SpamScore, input.SpamScored = *r.decision.SpamScore, true
+	}
+	return input
+}
+
 // UpdateConfig updates the scheduler configuration during hot reload
 func (s *Scheduler) UpdateConfig(newSchedulerConfig *config.SchedulerConfig) {
 	s.mu.Lock()
@@ -357,19 +735,41 @@ func (s *Scheduler) UpdateConfig(newSchedulerConfig *config.SchedulerConfig) {
 	oldConfig := s.schedulerConfig
 	s.schedulerConfig = newSchedulerConfig
 
-	// Check if worker pool size changed
-	if oldConfig.WorkerPoolSize != newSchedulerConfig.WorkerPoolSize {
-		// Note: In a production system, you might want to gracefully resize the worker pool
-		// For now, we'll just log the change and note that it requires a restart
-		zap.L().Warn("Worker pool size changed - restart required for full effect",
-			zap.Int("old_size", oldConfig.WorkerPoolSize),
-			zap.Int("new_size", newSchedulerConfig.WorkerPoolSize))
+	// Resize the worker pool in place if its size or autoscaling bounds changed
+	if oldConfig.WorkerPoolSize != newSchedulerConfig.WorkerPoolSize ||
+		oldConfig.WorkerAutoscaling != newSchedulerConfig.WorkerAutoscaling {
+		size := newSchedulerConfig.WorkerPoolSize
+		if oldConfig.WorkerPoolSize == newSchedulerConfig.WorkerPoolSize && s.WorkerCount() > 0 {
+			// Only the bounds changed, keep the autoscaled size if it still fits
+			size = s.WorkerCount()
+		}
+		size = clampPoolSize(size, newSchedulerConfig.WorkerAutoscaling)
+		if err := s.resize(size); err != nil {
+			zap.L().Error("Failed to resize worker pool",
+				zap.Int("old_size", oldConfig.WorkerPoolSize),
+				zap.Int("new_size", newSchedulerConfig.WorkerPoolSize),
+				zap.Error(err))
+		}
+	}
+
+	// Rebuild the priority strategy if its selection, weights or rules changed
+	if !reflect.DeepEqual(oldConfig.PriorityStrategy, newSchedulerConfig.PriorityStrategy) {
+		s.userGroups = userGroupSets(newSchedulerConfig.PriorityStrategy.UserGroups)
+		if strategy, err := NewPriorityStrategy(newSchedulerConfig.PriorityStrategy); err != nil {
+			zap.L().Error("Invalid priority strategy in reloaded config, keeping previous strategy",
+				zap.String("strategy", newSchedulerConfig.PriorityStrategy.Name),
+				zap.Error(err))
+		} else {
+			s.priorityStrategy = strategy
+			zap.L().Info("Priority strategy updated",
+				zap.String("strategy", newSchedulerConfig.PriorityStrategy.Name))
+		}
 	}
 
 	// Clear user request history if user behavior analysis settings changed significantly
 	if oldConfig.UserBehaviorAnalysis.Enabled != newSchedulerConfig.UserBehaviorAnalysis.Enabled ||
 		oldConfig.UserBehaviorAnalysis.MinDataPointsForBaseline != newSchedulerConfig.UserBehaviorAnalysis.MinDataPointsForBaseline {
-		s.userLastRequest = make(map[string]time.Time)
+		s.intervalStage.Reset()
 		zap.L().Info("User behavior analysis settings changed, clearing request history")
 	}
 
@@ -0,0 +1,274 @@
+package scheduler
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/tracing"
+)
+
+// Load shedding actions
+const (
+	ShedActionDrop  = "drop"
+	ShedActionDefer = "defer"
+)
+
+// defaultDeferredLimit bounds the delay queue when priority_queue.max_size is unset
+const defaultDeferredLimit = 10000
+
+// ShedStats reports load shedding activity
+type ShedStats struct {
+	Dropping      bool  `json:"dropping"`
+	Shed          int64 `json:"shed"`
+	Deferred      int64 `json:"deferred"`
+	DeferRejected int64 `json:"defer_rejected"` // Requests refused because the delay queue was full
+	Pending       int   `json:"pending"`        // Deferred requests waiting to be re-queued
+	LastSojournMS int64 `json:"last_sojourn_ms"`
+}
+
+// deferredRequest is a shed request held back until it may be re-queued
+type deferredRequest struct {
+	request *Request
+	until   time.Time
+}
+
+// codelShedder implements the CoDel control law over queue sojourn times.
+// Once delay has stayed above the target for a full interval it enters the
+// dropping state and sheds at a rate that grows with the square root of the
+// number of sheds, until delay falls back below the target.
+type codelShedder struct {
+	mu            sync.Mutex
+	firstAbove    time.Time // When delay will have been above target for a full interval
+	dropping      bool
+	dropNext      time.Time
+	count         int
+	shed          int64
+	deferred      int64
+	deferRejected int64
+	lastSojourn   time.Duration
+}
+
+// shouldShed feeds one dequeued request's sojourn time into the control law
+// and reports whether a request should be shed now
+func (c *codelShedder) shouldShed(sojourn time.Duration, now time.Time, target, interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastSojourn = sojourn
+	if sojourn < target {
+		c.firstAbove = time.Time{}
+		c.dropping = false
+		return false
+	}
+
+	if c.firstAbove.IsZero() {
+		c.firstAbove = now.Add(interval)
+		return false
+	}
+
+	if !c.dropping {
+		if now.Before(c.firstAbove) {
+			return false
+		}
+		c.dropping = true
+		// Resume close to the previous shed rate if overload returned quickly
+		if c.count > 2 && now.Sub(c.dropNext) < 16*interval {
+			c.count -= 2
+		} else {
+			c.count = 1
+		}
+		c.dropNext = codelControlLaw(now, interval, c.count)
+		return true
+	}
+
+	if now.Before(c.dropNext) {
+		return false
+	}
+	c.count++
+	c.dropNext = codelControlLaw(c.dropNext, interval, c.count)
+	return true
+}
+
+// idle resets the delay tracking once the queue has emptied
+func (c *codelShedder) idle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.firstAbove = time.Time{}
+	c.dropping = false
+	c.lastSojourn = 0
+}
+
+// codelControlLaw returns when the next shed is due
+func codelControlLaw(t time.Time, interval time.Duration, count int) time.Time {
+	return t.Add(time.Duration(float64(interval) / math.Sqrt(float64(count))))
+}
+
+// shedIfOverloaded applies the shedder to a dequeued request. When a shed is
+// due, the lowest priority eligible request is shed: a queued one if it is no
+// more important than the dequeued request, otherwise the dequeued request
+// itself. It returns true if the dequeued request was shed.
+func (s *Scheduler) shedIfOverloaded(request *Request, now time.Time) bool {
+	s.mu.RLock()
+	cfg := s.schedulerConfig.LoadShedding
+	s.mu.RUnlock()
+	if !cfg.Enabled {
+		return false
+	}
+
+	target := config.ParseDurationOrDefault(cfg.Target, 500*time.Millisecond)
+	interval := config.ParseDurationOrDefault(cfg.Interval, 2*time.Second)
+	if !s.shedder.shouldShed(now.Sub(request.enqueued), now, target, interval) {
+		return false
+	}
+
+	limit := cfg.MaxPriority
+	if request.priority < limit {
+		limit = request.priority
+	}
+	if victim := s.takeLowest(limit); victim != nil {
+		s.shedRequest(victim, cfg, now)
+		return false
+	}
+	if request.priority <= cfg.MaxPriority {
+		s.shedRequest(request, cfg, now)
+		return true
+	}
+	return false
+}
+
+// takeLowest removes and returns the lowest priority queued request at or below maxPriority
+func (s *Scheduler) takeLowest(maxPriority int) *Request {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	var lowest *Request
+	var from *classQueue
+	for _, q := range s.queues {
+		for _, request := range q.pq {
+			if request.priority > maxPriority {
+				continue
+			}
+			if lowest == nil || request.priority < lowest.priority ||
+				(request.priority == lowest.priority && request.enqueued.After(lowest.enqueued)) {
+				lowest, from = request, q
+			}
+		}
+	}
+	if lowest == nil {
+		return nil
+	}
+	heap.Remove(&from.pq, lowest.index)
+	return lowest
+}
+
+// shedRequest drops a request or holds it back for the defer delay
+func (s *Scheduler) shedRequest(request *Request, cfg config.LoadSheddingConfig, now time.Time) {
+	sojourn := now.Sub(request.enqueued)
+	_, span := tracing.Start(request.Context, "load_shed",
+		tracing.WithStartTime(request.enqueued),
+		tracing.WithAttributes(
+			tracing.String("shed.action", cfg.Action),
+			tracing.Int("priority", request.priority),
+		))
+	span.EndAt(now)
+
+	if cfg.Action == ShedActionDefer {
+		delay := config.ParseDurationOrDefault(cfg.DeferDelay, 5*time.Second)
+		if s.holdDeferred(request, now.Add(delay)) {
+			s.shedder.mu.Lock()
+			s.shedder.deferred++
+			s.shedder.mu.Unlock()
+
+			request.Logger.Info("Request deferred by load shedding",
+				zap.String("bot", request.BotID),
+				zap.String("user_id", request.userID),
+				zap.Int("priority", request.priority),
+				zap.Duration("sojourn", sojourn),
+				zap.Duration("delay", delay))
+			return
+		}
+		request.Logger.Warn("Delay queue is full, dropping shed request instead",
+			zap.String("bot", request.BotID),
+			zap.String("user_id", request.userID))
+	}
+
+	s.shedder.mu.Lock()
+	s.shedder.shed++
+	s.shedder.mu.Unlock()
+
+	request.Logger.Warn("Request shed under overload",
+		zap.String("bot", request.BotID),
+		zap.String("user_id", request.userID),
+		zap.Int("priority", request.priority),
+		zap.Duration("sojourn", sojourn))
+	request.finish(false)
+}
+
+// holdDeferred adds a request to the delay queue until the given time. It
+// returns false, counting the rejection, if the queue is already full.
+func (s *Scheduler) holdDeferred(request *Request, until time.Time) bool {
+	s.mu.RLock()
+	limit := s.schedulerConfig.PriorityQueue.MaxSize
+	s.mu.RUnlock()
+	if limit <= 0 {
+		limit = defaultDeferredLimit
+	}
+
+	s.queueMu.Lock()
+	if len(s.deferred) >= limit {
+		s.queueMu.Unlock()
+		s.shedder.mu.Lock()
+		s.shedder.deferRejected++
+		s.shedder.mu.Unlock()
+		return false
+	}
+	s.deferred = append(s.deferred, deferredRequest{request: request, until: until})
+	s.queueMu.Unlock()
+	return true
+}
+
+// releaseDeferred re-queues deferred requests whose delay has passed and
+// whose release callback, if any, still allows them
+func (s *Scheduler) releaseDeferred(now time.Time) {
+	s.queueMu.Lock()
+	var due []*Request
+	pending := s.deferred[:0]
+	for _, d := range s.deferred {
+		if now.Before(d.until) {
+			pending = append(pending, d)
+		} else {
+			due = append(due, d.request)
+		}
+	}
+	s.deferred = pending
+	s.queueMu.Unlock()
+
+	for _, request := range due {
+		if request.release() {
+			s.enqueue(request)
+		}
+	}
+}
+
+// ShedStats returns load shedding counters and state
+func (s *Scheduler) ShedStats() ShedStats {
+	s.queueMu.Lock()
+	pending := len(s.deferred)
+	s.queueMu.Unlock()
+
+	s.shedder.mu.Lock()
+	defer s.shedder.mu.Unlock()
+	return ShedStats{
+		Dropping:      s.shedder.dropping,
+		Shed:          s.shedder.shed,
+		Deferred:      s.shedder.deferred,
+		DeferRejected: s.shedder.deferRejected,
+		Pending:       pending,
+		LastSojournMS: s.shedder.lastSojourn.Milliseconds(),
+	}
+}
@@ -0,0 +1,224 @@
+package scheduler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/stats"
+)
+
+func TestCodelShedder(t *testing.T) {
+	const (
+		target   = 100 * time.Millisecond
+		interval = time.Second
+		above    = 200 * time.Millisecond
+		below    = 50 * time.Millisecond
+	)
+
+	// step is one dequeued request, or the queue emptying when idle is set
+	type step struct {
+		at      time.Duration // Since the start of the test
+		sojourn time.Duration
+		idle    bool
+		want    bool
+	}
+	tests := []struct {
+		name      string
+		steps     []step
+		wantCount int // Shed count driving the control law after the last step, 0 to skip
+	}{
+		{
+			name: "below target never sheds",
+			steps: []step{
+				{at: 0, sojourn: below},
+				{at: time.Second, sojourn: below},
+				{at: 5 * time.Second, sojourn: target - 1},
+			},
+		},
+		{
+			name: "sheds once delay stayed above target for an interval",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: 500 * time.Millisecond, sojourn: above},
+				{at: 999 * time.Millisecond, sojourn: above},
+				{at: time.Second, sojourn: above, want: true},
+			},
+			wantCount: 1,
+		},
+		{
+			name: "target itself counts as above",
+			steps: []step{
+				{at: 0, sojourn: target},
+				{at: time.Second, sojourn: target, want: true},
+			},
+		},
+		{
+			name: "dip below target restarts the interval",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: 500 * time.Millisecond, sojourn: above},
+				{at: 600 * time.Millisecond, sojourn: below},
+				{at: 1100 * time.Millisecond, sojourn: above},
+				{at: 2 * time.Second, sojourn: above},
+				{at: 2100 * time.Millisecond, sojourn: above, want: true},
+			},
+		},
+		{
+			name: "idle queue restarts the interval",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: 500 * time.Millisecond, idle: true},
+				{at: 600 * time.Millisecond, sojourn: above},
+				{at: time.Second, sojourn: above},
+				{at: 1600 * time.Millisecond, sojourn: above, want: true},
+			},
+		},
+		{
+			// Sheds follow interval/sqrt(count): 1s, then 707ms, then 577ms, then 500ms
+			name: "shed rate grows with the square root of the count",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: time.Second, sojourn: above, want: true},
+				{at: 1500 * time.Millisecond, sojourn: above},
+				{at: 2 * time.Second, sojourn: above, want: true},
+				{at: 2700 * time.Millisecond, sojourn: above},
+				{at: 2710 * time.Millisecond, sojourn: above, want: true},
+				{at: 3280 * time.Millisecond, sojourn: above},
+				{at: 3290 * time.Millisecond, sojourn: above, want: true},
+				{at: 3780 * time.Millisecond, sojourn: above},
+				{at: 3790 * time.Millisecond, sojourn: above, want: true},
+			},
+			wantCount: 5,
+		},
+		{
+			name: "delay below target leaves the dropping state",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: time.Second, sojourn: above, want: true},
+				{at: 1200 * time.Millisecond, sojourn: below},
+				{at: 2 * time.Second, sojourn: above},
+				{at: 2900 * time.Millisecond, sojourn: above},
+				{at: 3 * time.Second, sojourn: above, want: true},
+			},
+		},
+		{
+			name: "overload returning soon resumes near the previous rate",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: time.Second, sojourn: above, want: true},
+				{at: 2 * time.Second, sojourn: above, want: true},
+				{at: 2710 * time.Millisecond, sojourn: above, want: true},
+				{at: 3290 * time.Millisecond, sojourn: above, want: true},
+				{at: 3300 * time.Millisecond, sojourn: below},
+				{at: 3400 * time.Millisecond, sojourn: above},
+				{at: 4400 * time.Millisecond, sojourn: above, want: true},
+			},
+			wantCount: 2,
+		},
+		{
+			name: "overload returning late starts over",
+			steps: []step{
+				{at: 0, sojourn: above},
+				{at: time.Second, sojourn: above, want: true},
+				{at: 2 * time.Second, sojourn: above, want: true},
+				{at: 2710 * time.Millisecond, sojourn: above, want: true},
+				{at: 3290 * time.Millisecond, sojourn: above, want: true},
+				{at: 3300 * time.Millisecond, sojourn: below},
+				{at: 25 * time.Second, sojourn: above},
+				{at: 26 * time.Second, sojourn: above, want: true},
+			},
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c codelShedder
+			start := time.Unix(1700000000, 0)
+			for i, s := range tt.steps {
+				if s.idle {
+					c.idle()
+					continue
+				}
+				if got := c.shouldShed(s.sojourn, start.Add(s.at), target, interval); got != s.want {
+					t.Fatalf("step %d at %v: shouldShed = %v, want %v", i, s.at, got, s.want)
+				}
+			}
+			if tt.wantCount != 0 && c.count != tt.wantCount {
+				t.Errorf("count = %d, want %d", c.count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestCodelControlLaw(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		count int
+		want  time.Duration
+	}{
+		{count: 1, want: time.Second},
+		{count: 4, want: 500 * time.Millisecond},
+		{count: 16, want: 250 * time.Millisecond},
+		{count: 100, want: 100 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := codelControlLaw(start, time.Second, tt.count).Sub(start); got != tt.want {
+			t.Errorf("codelControlLaw(count %d) = +%v, want +%v", tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestDelayQueue(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxSize      int
+		release      []bool // Release verdict of each deferred request
+		wantRejected int64
+		wantQueued   int
+	}{
+		{name: "all released", maxSize: 10, release: []bool{true, true}, wantQueued: 2},
+		{name: "refused requests are not queued", maxSize: 10, release: []bool{true, false, false}, wantQueued: 1},
+		{name: "full queue rejects", maxSize: 2, release: []bool{true, true, true}, wantRejected: 1, wantQueued: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultSchedulerConfig()
+			cfg.PriorityQueue.MaxSize = tt.maxSize
+			qosConfig := config.GetDefaultQoSConfig()
+			s := NewScheduler(stats.NewStatsAnalyzer(100), &cfg, &qosConfig, nil)
+
+			var done int
+			for i, release := range tt.release {
+				queued := s.Defer(context.Background(), []byte(`{}`), http.Header{}, "bot", config.BotConfig{}, nil, zap.NewNop(), time.Second, Completion{
+					Release: func() bool { return release },
+					Done:    func(bool) { done++ },
+				})
+				if want := i < tt.maxSize; queued != want {
+					t.Fatalf("Defer %d = %v, want %v", i, queued, want)
+				}
+			}
+
+			s.releaseDeferred(time.Now())
+			if got := s.ShedStats().Pending; got != len(tt.release)-int(tt.wantRejected) {
+				t.Errorf("pending before the delay = %d", got)
+			}
+			s.releaseDeferred(time.Now().Add(2 * time.Second))
+			if got := s.GetQueueSize(); got != tt.wantQueued {
+				t.Errorf("queued %d, want %d", got, tt.wantQueued)
+			}
+			if got := s.ShedStats(); got.DeferRejected != tt.wantRejected || got.Pending != 0 {
+				t.Errorf("defer rejected %d pending %d, want %d 0", got.DeferRejected, got.Pending, tt.wantRejected)
+			}
+			if done != 0 {
+				t.Errorf("Done called %d times for requests that were never delivered", done)
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package scheduler
 
 import (
+	"fmt"
+	"strings"
+
 	"qqbotrouter/config"
 	"qqbotrouter/interfaces"
+	"qqbotrouter/priority"
+	"qqbotrouter/rules"
 )
 
 // PriorityStrategy defines the interface for priority calculation strategies
@@ -10,6 +15,34 @@ type PriorityStrategy interface {
 	CalculatePriority(userID string, contentType string, statsProvider interfaces.StatProvider, config *config.SchedulerConfig) int
 }
 
+// InputAwareStrategy is implemented by strategies that need the whole event
+// rather than only the user and content type. It also explains its result and
+// reports whether an operator rule pinned the priority outright.
+type InputAwareStrategy interface {
+	PriorityStrategy
+	CalculateInputPriority(input *priority.Input, statsProvider interfaces.StatProvider, config *config.SchedulerConfig) (score int, reason string, pinned bool)
+}
+
+// NewPriorityStrategy builds the strategy selected in configuration
+func NewPriorityStrategy(strategyConfig config.PriorityStrategyConfig) (PriorityStrategy, error) {
+	switch strategyConfig.Name {
+	case "", "hybrid":
+		loadWeight, contentWeight := strategyConfig.LoadWeight, strategyConfig.ContentWeight
+		if loadWeight == 0 && contentWeight == 0 {
+			loadWeight, contentWeight = 0.6, 0.4
+		}
+		return NewHybridStrategy(loadWeight, contentWeight), nil
+	case "load":
+		return &LoadBasedStrategy{}, nil
+	case "content":
+		return &ContentBasedStrategy{}, nil
+	case "expression":
+		return NewExpressionStrategy(strategyConfig.Rules, strategyConfig.UserGroups)
+	default:
+		return nil, fmt.Errorf("unknown priority strategy %q", strategyConfig.Name)
+	}
+}
+
 // LoadBasedStrategy calculates priority based on load metrics
 type LoadBasedStrategy struct{}
 
@@ -39,7 +72,7 @@ func (s *ContentBasedStrategy) CalculatePriority(userID string, contentType stri
 		priority += 10
 	case "image":
 		priority += 5
-	case "video":
+	case "video", "audio":
 		priority -= 5
 	case "file":
 		priority -= 10
@@ -73,3 +106,75 @@ func (s *HybridStrategy) CalculatePriority(userID string, contentType string, st
 	finalPriority := int(float64(loadPriority)*s.loadWeight + float64(contentPriority)*s.contentWeight)
 	return finalPriority
 }
+
+// ExpressionStrategy scores events with operator-written rules such as
+// event.type == "GROUP_AT_MESSAGE_CREATE" && user.in("vip") => +3
+type ExpressionStrategy struct {
+	rules      []*rules.Rule
+	userGroups map[string]map[string]bool
+}
+
+// NewExpressionStrategy compiles the given rules; user groups back user.in("group")
+func NewExpressionStrategy(ruleSources []string, userGroups map[string][]string) (*ExpressionStrategy, error) {
+	compiled, err := rules.ParseRules(ruleSources)
+	if err != nil {
+		return nil, err
+	}
+	return &ExpressionStrategy{rules: compiled, userGroups: userGroupSets(userGroups)}, nil
+}
+
+// userGroupSets indexes the configured user groups for user.in("group")
+func userGroupSets(userGroups map[string][]string) map[string]map[string]bool {
+	groups := make(map[string]map[string]bool, len(userGroups))
+	for name, members := range userGroups {
+		groups[name] = make(map[string]bool, len(members))
+		for _, member := range members {
+			groups[name][member] = true
+		}
+	}
+	return groups
+}
+
+func (s *ExpressionStrategy) CalculatePriority(userID string, contentType string, statsProvider interfaces.StatProvider, config *config.SchedulerConfig) int {
+	score, _, _ := s.CalculateInputPriority(&priority.Input{UserID: userID, ContentType: contentType}, statsProvider, config)
+	return score
+}
+
+func (s *ExpressionStrategy) CalculateInputPriority(input *priority.Input, statsProvider interfaces.StatProvider, config *config.SchedulerConfig) (int, string, bool) {
+	env := &priority.RuleEnv{Input: input, Stats: statsProvider, Lists: s.userGroups}
+	score, matched, pinned := rules.Apply(s.rules, env, config.PrioritySettings.BasePriority)
+	return score, strings.Join(matched, "; "), pinned
+}
+
+// strategyStage adapts the scheduler's PriorityStrategy into a pipeline stage,
+// contributing the strategy's offset from the base priority. A "=N" rule of
+// the expression strategy pins the priority instead.
+type strategyStage struct {
+	scheduler *Scheduler
+}
+
+func (s *strategyStage) Name() string { return "strategy" }
+
+func (s *strategyStage) Score(input *priority.Input, env *priority.Env) (int, string) {
+	delta, reason, _ := s.ScoreOrPin(input, env)
+	return delta, reason
+}
+
+// ScoreOrPin implements priority.PinningStage
+func (s *strategyStage) ScoreOrPin(input *priority.Input, env *priority.Env) (int, string, bool) {
+	s.scheduler.mu.RLock()
+	strategy := s.scheduler.priorityStrategy
+	s.scheduler.mu.RUnlock()
+
+	if inputAware, ok := strategy.(InputAwareStrategy); ok {
+		strategyPriority, reason, pinned := inputAware.CalculateInputPriority(input, env.Stats, env.Config)
+		return strategyPriority - env.Config.PrioritySettings.BasePriority, reason, pinned
+	}
+
+	strategyPriority := strategy.CalculatePriority(input.UserID, input.ContentType, env.Stats, env.Config)
+	delta := strategyPriority - env.Config.PrioritySettings.BasePriority
+	if delta == 0 {
+		return 0, "", false
+	}
+	return delta, fmt.Sprintf("%T content=%s", strategy, input.ContentType), false
+}
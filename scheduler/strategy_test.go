@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"testing"
+
+	"qqbotrouter/config"
+	"qqbotrouter/stats"
+	"qqbotrouter/utils"
+)
+
+func TestPrioritizeThrottleExemption(t *testing.T) {
+	expression := func(rules ...string) config.PriorityStrategyConfig {
+		return config.PriorityStrategyConfig{Name: "expression", Rules: rules}
+	}
+
+	tests := []struct {
+		name         string
+		strategy     config.PriorityStrategyConfig // Unnamed keeps the default strategy
+		message      string
+		wantPriority int
+		wantClass    string
+		wantExempt   bool
+	}{
+		{
+			name:    "plain text under the defaults",
+			message: "hello", wantPriority: 9, wantClass: "interactive",
+		},
+		{
+			// The keyword bonus clamps to the top of the range, which the
+			// computed score alone must not turn into an exemption
+			name:    "priority keyword under the defaults",
+			message: "help", wantPriority: 10, wantClass: "admin",
+		},
+		{
+			name:     "rule adding into the admin class",
+			strategy: expression(`message.content == "/status" => +5`),
+			message:  "/status", wantPriority: 10, wantClass: "admin",
+		},
+		{
+			name:     "rule pinning into the admin class",
+			strategy: expression(`message.content == "/reboot" => =10`),
+			message:  "/reboot", wantPriority: 10, wantClass: "admin", wantExempt: true,
+		},
+		{
+			// The pinned score replaces the keyword bonus scored before it
+			name:     "rule pinning below the admin class",
+			strategy: expression(`message.contains("help") => =7`),
+			message:  "help", wantPriority: 7, wantClass: "interactive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.GetDefaultSchedulerConfig()
+			if tt.strategy.Name != "" {
+				cfg.PriorityStrategy = tt.strategy
+			}
+			qosConfig := config.GetDefaultQoSConfig()
+			s := NewScheduler(stats.NewStatsAnalyzer(cfg.UserBehaviorAnalysis.MinDataPointsForBaseline), &cfg, &qosConfig, nil)
+
+			decision := s.Prioritize("bot", utils.MessageInfo{
+				UserID:      "user",
+				Message:     tt.message,
+				EventType:   "GROUP_AT_MESSAGE_CREATE",
+				ContentType: "text",
+			})
+			if decision.Priority != tt.wantPriority || decision.Class != tt.wantClass || decision.ThrottleExempt != tt.wantExempt {
+				t.Errorf("priority %d class %q exempt %v, want %d %q %v (stages %+v)",
+					decision.Priority, decision.Class, decision.ThrottleExempt,
+					tt.wantPriority, tt.wantClass, tt.wantExempt, decision.Stages)
+			}
+		})
+	}
+}
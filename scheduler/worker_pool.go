@@ -0,0 +1,295 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+	"qqbotrouter/forwarder"
+	"qqbotrouter/interfaces"
+)
+
+const (
+	// latencySmoothing is the weight given to the newest sample in the forward latency EWMA
+	latencySmoothing = 0.2
+
+	// maxPoolSize is the most workers the pool runs, whatever is requested
+	maxPoolSize = 1000
+)
+
+// workerPoolState tracks running workers so the pool can be resized at runtime.
+type workerPoolState struct {
+	mu          sync.Mutex
+	ctx         context.Context
+	quits       []chan struct{}
+	desired     int
+	busy        int64
+	latencyEWMA time.Duration
+}
+
+// WorkerCount returns the number of running workers
+func (s *Scheduler) WorkerCount() int {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+	if s.pool.ctx == nil {
+		return 0
+	}
+	return len(s.pool.quits)
+}
+
+// BusyWorkers returns the number of workers currently processing a request
+func (s *Scheduler) BusyWorkers() int {
+	return int(atomic.LoadInt64(&s.pool.busy))
+}
+
+// Resize grows or shrinks the worker pool, keeping the size within the
+// autoscaling bounds while autoscaling is enabled. Workers being removed
+// finish their current request before exiting, so no in-flight request is dropped.
+func (s *Scheduler) Resize(size int) error {
+	if size < 1 || size > maxPoolSize {
+		return fmt.Errorf("worker pool size must be between 1 and %d, got %d", maxPoolSize, size)
+	}
+	s.mu.RLock()
+	size = clampPoolSize(size, s.schedulerConfig.WorkerAutoscaling)
+	s.mu.RUnlock()
+	return s.resize(size)
+}
+
+// resize sets the number of running workers to a size already clamped by the caller
+func (s *Scheduler) resize(size int) error {
+	if size < 1 || size > maxPoolSize {
+		return fmt.Errorf("worker pool size must be between 1 and %d, got %d", maxPoolSize, size)
+	}
+
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	oldSize := len(s.pool.quits)
+	s.pool.desired = size
+
+	// Not running yet: the desired size is applied when Run starts the workers
+	if s.pool.ctx == nil {
+		return nil
+	}
+
+	for len(s.pool.quits) < size {
+		quit := make(chan struct{})
+		s.pool.quits = append(s.pool.quits, quit)
+		go s.runWorker(s.pool.ctx, quit)
+	}
+	for len(s.pool.quits) > size {
+		last := len(s.pool.quits) - 1
+		close(s.pool.quits[last])
+		s.pool.quits = s.pool.quits[:last]
+	}
+
+	if oldSize != size {
+		zap.L().Info("Worker pool resized",
+			zap.Int("old_size", oldSize),
+			zap.Int("new_size", size))
+	}
+	return nil
+}
+
+// startWorkers launches the initial set of workers bound to the given context
+func (s *Scheduler) startWorkers(ctx context.Context) {
+	s.pool.mu.Lock()
+	s.pool.ctx = ctx
+	size := s.pool.desired
+	s.pool.mu.Unlock()
+
+	if err := s.resize(size); err != nil {
+		zap.L().Error("Failed to start worker pool", zap.Error(err))
+	}
+}
+
+// runWorker processes requests until the context is cancelled, the worker is
+// asked to quit, or the worker channel is closed.
+func (s *Scheduler) runWorker(ctx context.Context, quit <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-quit:
+			return
+		case request, ok := <-s.workerPool:
+			if !ok {
+				return // Channel closed
+			}
+			// busy was incremented by dispatch when the request was handed off
+			s.processRequest(request)
+			atomic.AddInt64(&s.pool.busy, -1)
+			s.releaseSlot(request)
+		}
+	}
+}
+
+// LatencyObserver receives the forward latency of each delivery and whether any destination accepted it
+type LatencyObserver func(botID string, latency time.Duration, success bool)
+
+// SetLatencyObserver sets the function notified of per-bot forward latency samples
+func (s *Scheduler) SetLatencyObserver(observer LatencyObserver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latencyObserver = observer
+}
+
+// recordForwardLatency folds a forward latency sample into the moving average
+// and passes it on to the stats provider and the latency observer
+func (s *Scheduler) recordForwardLatency(botID string, latency time.Duration, success bool) {
+	s.pool.mu.Lock()
+	if s.pool.latencyEWMA == 0 {
+		s.pool.latencyEWMA = latency
+	} else {
+		s.pool.latencyEWMA = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(s.pool.latencyEWMA))
+	}
+	s.pool.mu.Unlock()
+
+	s.statsProvider.RecordForward(latency, success)
+
+	s.mu.RLock()
+	observer := s.latencyObserver
+	s.mu.RUnlock()
+	if observer != nil {
+		observer(botID, latency, success)
+	}
+}
+
+// SetObserver sets the observer fed with each destination's forward latency
+func (s *Scheduler) SetObserver(observer interfaces.Observer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = observer
+}
+
+// observeForwards records each destination's result in the forward metrics and the observer
+func (s *Scheduler) observeForwards(botID string, results []forwarder.ForwardResult) {
+	s.forwardMetrics.observe(botID, results)
+
+	s.mu.RLock()
+	observer := s.observer
+	s.mu.RUnlock()
+	if observer == nil {
+		return
+	}
+	for _, result := range results {
+		observer.RecordDestinationLatency(result.Destination, result.Latency)
+	}
+}
+
+// ForwardLatency returns the smoothed forward latency observed by workers
+func (s *Scheduler) ForwardLatency() time.Duration {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+	return s.pool.latencyEWMA
+}
+
+// autoscaleLoop periodically resizes the pool within the configured bounds
+func (s *Scheduler) autoscaleLoop(ctx context.Context) {
+	for {
+		s.mu.RLock()
+		autoscaling := s.schedulerConfig.WorkerAutoscaling
+		s.mu.RUnlock()
+
+		interval := config.ParseDurationOrDefault(autoscaling.CheckInterval, 5*time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		if autoscaling.Enabled {
+			s.autoscale(autoscaling)
+		}
+	}
+}
+
+// autoscale grows the pool when the queue backs up while every worker is busy
+// and downstream latency is still healthy, and shrinks it when workers idle.
+// Adding workers while downstream latency exceeds the target would only pile
+// more concurrent load onto an already slow destination, so growth is held.
+func (s *Scheduler) autoscale(autoscaling config.WorkerAutoscalingConfig) {
+	minWorkers, maxWorkers := autoscalingBounds(autoscaling)
+	step := autoscaling.ScaleStep
+	if step < 1 {
+		step = 1
+	}
+
+	workers := s.WorkerCount()
+	if workers == 0 {
+		return
+	}
+	busy := s.BusyWorkers()
+	depth := s.GetQueueSize()
+	latency := s.ForwardLatency()
+	latencyTarget := config.ParseDurationOrDefault(autoscaling.LatencyTarget, 0)
+
+	desired := workers
+	switch {
+	case depth >= autoscaling.ScaleUpQueueDepth && busy >= workers:
+		if latencyTarget > 0 && latency > latencyTarget {
+			zap.L().Debug("Holding worker pool size, downstream latency above target",
+				zap.Int("queue_depth", depth),
+				zap.Duration("forward_latency", latency),
+				zap.Duration("latency_target", latencyTarget))
+			return
+		}
+		desired = workers + step
+	case depth == 0 && busy*2 < workers:
+		desired = workers - step
+	}
+
+	if desired < minWorkers {
+		desired = minWorkers
+	} else if desired > maxWorkers {
+		desired = maxWorkers
+	}
+
+	if desired != workers {
+		zap.L().Info("Autoscaling worker pool",
+			zap.Int("workers", workers),
+			zap.Int("busy", busy),
+			zap.Int("queue_depth", depth),
+			zap.Duration("forward_latency", latency),
+			zap.Int("target", desired))
+		if err := s.resize(desired); err != nil {
+			zap.L().Error("Failed to autoscale worker pool", zap.Error(err))
+		}
+	}
+}
+
+// autoscalingBounds returns sanitised min/max worker counts
+func autoscalingBounds(autoscaling config.WorkerAutoscalingConfig) (int, int) {
+	minWorkers := autoscaling.MinWorkers
+	if minWorkers < 1 {
+		minWorkers = 1
+	}
+	maxWorkers := min(autoscaling.MaxWorkers, maxPoolSize)
+	minWorkers = min(minWorkers, maxPoolSize)
+	if maxWorkers < minWorkers {
+		maxWorkers = minWorkers
+	}
+	return minWorkers, maxWorkers
+}
+
+// clampPoolSize keeps a requested pool size within autoscaling bounds when
+// autoscaling is enabled, and at most maxPoolSize
+func clampPoolSize(size int, autoscaling config.WorkerAutoscalingConfig) int {
+	size = min(size, maxPoolSize)
+	if !autoscaling.Enabled {
+		return size
+	}
+	minWorkers, maxWorkers := autoscalingBounds(autoscaling)
+	if size < minWorkers {
+		return minWorkers
+	}
+	if size > maxWorkers {
+		return maxWorkers
+	}
+	return size
+}
@@ -0,0 +1,184 @@
+package sketch
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// RelativeAccuracy bounds the relative error of every quantile estimate
+	RelativeAccuracy = 0.01
+
+	// Values are tracked between minValue and maxValue; smaller values count
+	// as zero and larger ones land in the top bucket
+	minValue = 1e-3
+	maxValue = 1e8
+
+	// rescaleAfter is how many half-lives pass before weights are rescaled to keep them finite
+	rescaleAfter = 32
+)
+
+// Quantiles is a streaming quantile sketch with fixed memory and constant-time
+// updates. Values fall into logarithmically sized buckets, so every estimate is
+// within RelativeAccuracy of a value that was recorded. With a half-life set,
+// older values are exponentially down-weighted (forward decay), so quantiles
+// follow recent behaviour without a hard window edge.
+type Quantiles struct {
+	mu       sync.Mutex
+	halfLife time.Duration
+	landmark time.Time // Reference point for the forward-decay weights
+
+	gamma    float64
+	logGamma float64
+	offset   int // Bucket index of minValue
+	counts   []float64
+	zero     float64 // Weight of values below minValue
+	total    float64
+	sum      float64 // Weighted sum of values, for the mean
+}
+
+// New creates a new empty sketch. Values lose half their weight every
+// halfLife; zero disables decay.
+func New(halfLife time.Duration) *Quantiles {
+	gamma := (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma := math.Log(gamma)
+	offset := int(math.Ceil(math.Log(minValue) / logGamma))
+	top := int(math.Ceil(math.Log(maxValue) / logGamma))
+	return &Quantiles{
+		halfLife: halfLife,
+		gamma:    gamma,
+		logGamma: logGamma,
+		offset:   offset,
+		counts:   make([]float64, top-offset+1),
+	}
+}
+
+// Add records a value observed at the given time
+func (q *Quantiles) Add(value float64, at time.Time) {
+	if math.IsNaN(value) || value < 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	weight := q.weightLocked(at)
+	q.total += weight
+	q.sum += weight * value
+	if value < minValue {
+		q.zero += weight
+		return
+	}
+	q.counts[q.bucket(value)] += weight
+}
+
+// weightLocked returns the forward-decay weight of a value observed at t,
+// rescaling the stored weights when they grow too large; q.mu must be held
+func (q *Quantiles) weightLocked(t time.Time) float64 {
+	if q.halfLife <= 0 {
+		return 1
+	}
+	if q.landmark.IsZero() {
+		q.landmark = t
+	}
+	age := float64(t.Sub(q.landmark)) / float64(q.halfLife)
+	if age > rescaleAfter {
+		factor := math.Exp2(-age)
+		for i := range q.counts {
+			q.counts[i] *= factor
+		}
+		q.zero *= factor
+		q.total *= factor
+		q.sum *= factor
+		q.landmark = t
+		age = 0
+	}
+	return math.Exp2(age)
+}
+
+// bucket returns the index of the bucket holding value
+func (q *Quantiles) bucket(value float64) int {
+	index := int(math.Ceil(math.Log(value)/q.logGamma)) - q.offset
+	if index < 0 {
+		return 0
+	}
+	if index >= len(q.counts) {
+		return len(q.counts) - 1
+	}
+	return index
+}
+
+// Quantile returns the estimated value at quantile p (0.0 to 1.0), or 0 if the sketch is empty
+func (q *Quantiles) Quantile(p float64) float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.total <= 0 {
+		return 0
+	}
+	p = math.Max(0, math.Min(1, p))
+	rank := p * q.total
+
+	seen := q.zero
+	if seen > rank {
+		return 0
+	}
+	highest := -1
+	for i, count := range q.counts {
+		seen += count
+		if seen > rank {
+			return q.bucketValue(i)
+		}
+		if count > 0 {
+			highest = i
+		}
+	}
+
+	// The rank of the top quantile is the whole weight, which no bucket exceeds
+	if highest < 0 {
+		return 0
+	}
+	return q.bucketValue(highest)
+}
+
+// bucketValue returns the midpoint of a bucket in relative terms, so the error
+// is at most RelativeAccuracy for any value in it
+func (q *Quantiles) bucketValue(i int) float64 {
+	upper := math.Pow(q.gamma, float64(i+q.offset))
+	return upper * 2 / (1 + q.gamma)
+}
+
+// Mean returns the decay-weighted mean of the recorded values
+func (q *Quantiles) Mean() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.total <= 0 {
+		return 0
+	}
+	return q.sum / q.total
+}
+
+// Count returns the decayed number of values as of now; without decay it is the exact count
+func (q *Quantiles) Count(now time.Time) float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.halfLife <= 0 || q.landmark.IsZero() {
+		return q.total
+	}
+	return q.total * math.Exp2(-float64(now.Sub(q.landmark))/float64(q.halfLife))
+}
+
+// Reset discards every recorded value
+func (q *Quantiles) Reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.counts {
+		q.counts[i] = 0
+	}
+	q.zero, q.total, q.sum = 0, 0, 0
+	q.landmark = time.Time{}
+}
@@ -0,0 +1,204 @@
+package sketch
+
+import (
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+// withinAccuracy reports whether got is within the sketch's relative accuracy of want
+func withinAccuracy(got, want float64) bool {
+	if want == 0 {
+		return got == 0
+	}
+	return math.Abs(got-want) <= RelativeAccuracy*want*1.0001
+}
+
+func TestQuantileAccuracy(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+	}{
+		{name: "single value", values: []float64{42}},
+		{name: "uniform", values: series(10000, func(i int) float64 { return float64(i + 1) })},
+		{name: "exponential", values: series(10000, func(i int) float64 { return math.Exp(float64(i) / 1000) })},
+		{name: "millisecond latencies", values: series(5000, func(i int) float64 { return 0.5 + float64(i%997)*3.7 })},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(0)
+			now := time.Now()
+			for _, v := range tt.values {
+				q.Add(v, now)
+			}
+			sorted := append([]float64(nil), tt.values...)
+			sort.Float64s(sorted)
+
+			// Either neighbour of the exact rank is an acceptable target
+			for _, p := range []float64{0, 0.01, 0.25, 0.5, 0.9, 0.95, 0.99, 1} {
+				rank := int(p * float64(len(sorted)-1))
+				low, high := sorted[rank], sorted[min(rank+1, len(sorted)-1)]
+				if got := q.Quantile(p); !withinAccuracy(got, low) && !withinAccuracy(got, high) {
+					t.Errorf("Quantile(%g) = %g, want %g or %g within %g", p, got, low, high, RelativeAccuracy)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantileEdges(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{name: "empty", p: 0.5, want: 0},
+		{name: "below minimum counts as zero", values: []float64{1e-6, 1e-6, 5}, p: 0.5, want: 0},
+		{name: "negative and NaN ignored", values: []float64{-1, math.NaN(), 5}, p: 0, want: 5},
+		{name: "p above 1 clamps", values: []float64{1, 2, 3}, p: 2, want: 3},
+		{name: "p below 0 clamps", values: []float64{1, 2, 3}, p: -1, want: 1},
+		{name: "above maximum lands in top bucket", values: []float64{1e12}, p: 0.5, want: maxValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(0)
+			now := time.Now()
+			for _, v := range tt.values {
+				q.Add(v, now)
+			}
+			if got := q.Quantile(tt.p); !withinAccuracy(got, tt.want) {
+				t.Errorf("Quantile(%g) = %g, want %g", tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecay(t *testing.T) {
+	const halfLife = time.Minute
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name       string
+		oldValue   float64
+		newValue   float64
+		elapsed    time.Duration // Between the old and the new values
+		wantMedian float64
+		wantMean   float64
+	}{
+		{
+			// Equal weights: the old values are the lower half
+			name: "no time passed", oldValue: 10, newValue: 100,
+			wantMedian: 100, wantMean: 55,
+		},
+		{
+			// Old values weigh 1/2 against 1: a third of the total
+			name: "one half-life", oldValue: 10, newValue: 100, elapsed: halfLife,
+			wantMedian: 100, wantMean: 70,
+		},
+		{
+			// Old values weigh 1/1024 and barely move the mean
+			name: "ten half-lives", oldValue: 10, newValue: 100, elapsed: 10 * halfLife,
+			wantMedian: 100, wantMean: (10.0/1024 + 100) / (1.0/1024 + 1),
+		},
+		{
+			// Past the rescale point the old weights underflow harmlessly
+			name: "beyond rescale", oldValue: 10, newValue: 100, elapsed: 3 * rescaleAfter * halfLife,
+			wantMedian: 100, wantMean: 100,
+		},
+		{
+			// The recent values decide even when they are the smaller ones
+			name: "recent values lower", oldValue: 1000, newValue: 1, elapsed: 5 * halfLife,
+			wantMedian: 1, wantMean: (1000.0/32 + 1) / (1.0/32 + 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(halfLife)
+			for i := 0; i < 100; i++ {
+				q.Add(tt.oldValue, start)
+			}
+			now := start.Add(tt.elapsed)
+			for i := 0; i < 100; i++ {
+				q.Add(tt.newValue, now)
+			}
+
+			if got := q.Quantile(0.5); !withinAccuracy(got, tt.wantMedian) {
+				t.Errorf("median = %g, want %g", got, tt.wantMedian)
+			}
+			if got := q.Mean(); math.Abs(got-tt.wantMean) > 1e-9*tt.wantMean {
+				t.Errorf("mean = %g, want %g", got, tt.wantMean)
+			}
+			wantCount := 100 + 100*math.Exp2(-float64(tt.elapsed)/float64(halfLife))
+			if got := q.Count(now); math.Abs(got-wantCount) > 1e-9*wantCount {
+				t.Errorf("count = %g, want %g", got, wantCount)
+			}
+			if math.IsInf(q.total, 0) || math.IsNaN(q.total) {
+				t.Errorf("total weight is not finite: %g", q.total)
+			}
+		})
+	}
+}
+
+func TestCountDecaysWithoutNewValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		halfLife time.Duration
+		elapsed  time.Duration
+		want     float64
+	}{
+		{name: "no decay", elapsed: time.Hour, want: 8},
+		{name: "just added", halfLife: time.Minute, want: 8},
+		{name: "one half-life", halfLife: time.Minute, elapsed: time.Minute, want: 4},
+		{name: "three half-lives", halfLife: time.Minute, elapsed: 3 * time.Minute, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(tt.halfLife)
+			start := time.Unix(1700000000, 0)
+			for i := 0; i < 8; i++ {
+				q.Add(5, start)
+			}
+			if got := q.Count(start.Add(tt.elapsed)); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Count = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReset(t *testing.T) {
+	q := New(time.Minute)
+	start := time.Unix(1700000000, 0)
+	q.Add(5, start)
+	q.Add(1e-6, start)
+	q.Reset()
+
+	if got := q.Count(start); got != 0 {
+		t.Errorf("Count after Reset = %g", got)
+	}
+	if got := q.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile after Reset = %g", got)
+	}
+
+	// A reset sketch starts a new landmark, so values long after the first
+	// ones get a weight of one again
+	later := start.Add(100 * time.Minute)
+	q.Add(7, later)
+	if got := q.Count(later); got != 1 {
+		t.Errorf("Count after re-adding = %g, want 1", got)
+	}
+}
+
+// series returns n values produced by f
+func series(n int, f func(i int) float64) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = f(i)
+	}
+	return values
+}
@@ -0,0 +1,275 @@
+package spam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/interfaces"
+)
+
+// Ensure Classifier implements SpamScorer interface
+var _ interfaces.SpamScorer = (*Classifier)(nil)
+
+// Default file names in the data directory
+const (
+	ModelFile    = "spam_model.json"
+	FeedbackFile = "spam_feedback.jsonl"
+)
+
+const (
+	// modelFileVersion is the on-disk format version of a saved model
+	modelFileVersion = 1
+
+	// syncInterval is how often feedback is saved and the model file checked for replacement
+	syncInterval = time.Minute
+)
+
+// modelFile is the on-disk format of a saved model
+type modelFile struct {
+	Version int    `json:"version"`
+	Model   *Model `json:"model"`
+}
+
+// Info describes the loaded model
+type Info struct {
+	Revision  int       `json:"revision"`
+	TrainedAt time.Time `json:"trained_at"`
+	HamDocs   int       `json:"ham_docs"`
+	SpamDocs  int       `json:"spam_docs"`
+	Grams     int       `json:"grams"`
+	Ready     bool      `json:"ready"`   // Enough examples of both classes to score
+	Pending   int       `json:"pending"` // Feedback examples not yet saved
+}
+
+// Classifier scores messages with a naive Bayes model loaded from the data
+// directory. Operator feedback updates the model online and is appended to a
+// feedback file in the same labelled JSONL the offline trainer reads; a model
+// file replaced by the offline trainer is picked up without a restart.
+type Classifier struct {
+	mu           sync.RWMutex
+	model        *Model
+	path         string
+	feedbackPath string
+	modTime      time.Time // Modification time of the model file when last loaded or saved
+	pending      int       // Feedback examples trained since the last save
+}
+
+// NewClassifier creates a classifier with an empty model saved at path
+func NewClassifier(path string) *Classifier {
+	return &Classifier{model: NewModel(), path: path}
+}
+
+// SetFeedbackPath sets the file feedback examples are appended to; empty disables it
+func (c *Classifier) SetFeedbackPath(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.feedbackPath = path
+}
+
+// SpamScore returns the probability that text is spam, or false while the
+// model has too few examples to score
+func (c *Classifier) SpamScore(text string) (float64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.model.Ready() {
+		return 0, false
+	}
+	return c.model.Score(text), true
+}
+
+// Feedback trains the model on an operator-labelled message and records it
+// for offline retraining
+func (c *Classifier) Feedback(example Example) error {
+	if err := example.validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.model.Train(example.Text, example.IsSpam())
+	c.pending++
+	feedbackPath := c.feedbackPath
+	c.mu.Unlock()
+
+	if feedbackPath == "" {
+		return nil
+	}
+	return appendExample(feedbackPath, example)
+}
+
+// appendExample appends one example to a labelled JSONL file
+func appendExample(path string, example Example) error {
+	line, err := json.Marshal(example)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spam feedback: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create spam feedback directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open spam feedback: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write spam feedback: %w", err)
+	}
+	return nil
+}
+
+// Info describes the loaded model
+func (c *Classifier) Info() Info {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return Info{
+		Revision:  c.model.Revision,
+		TrainedAt: c.model.TrainedAt,
+		HamDocs:   c.model.Docs[ham],
+		SpamDocs:  c.model.Docs[spam],
+		Grams:     len(c.model.Grams),
+		Ready:     c.model.Ready(),
+		Pending:   c.pending,
+	}
+}
+
+// Load reads the model file, keeping the empty model if there is none
+func (c *Classifier) Load() error {
+	model, modTime, err := ReadModel(c.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+	c.modTime = modTime
+	c.pending = 0
+	return nil
+}
+
+// Save writes the model with any pending feedback as a new revision
+func (c *Classifier) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == 0 {
+		return nil
+	}
+
+	c.model.Revision++
+	modTime, err := WriteModel(c.path, c.model)
+	if err != nil {
+		return err
+	}
+	c.modTime = modTime
+	c.pending = 0
+	return nil
+}
+
+// ReadModel reads a saved model and returns it with the file's modification time
+func ReadModel(path string) (*Model, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, time.Time{}, err
+		}
+		return nil, time.Time{}, fmt.Errorf("failed to read spam model: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to read spam model: %w", err)
+	}
+
+	var file modelFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to parse spam model: %w", err)
+	}
+	if file.Version != modelFileVersion {
+		return nil, time.Time{}, fmt.Errorf("unsupported spam model version %d", file.Version)
+	}
+	if file.Model == nil {
+		return nil, time.Time{}, errors.New("spam model file has no model")
+	}
+	if file.Model.Grams == nil {
+		file.Model.Grams = make(map[string][2]int)
+	}
+	return file.Model, info.ModTime(), nil
+}
+
+// WriteModel writes a model atomically and returns the file's modification time
+func WriteModel(path string, model *Model) (time.Time, error) {
+	data, err := json.Marshal(modelFile{Version: modelFileVersion, Model: model})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to marshal spam model: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return time.Time{}, fmt.Errorf("failed to create spam model directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return time.Time{}, fmt.Errorf("failed to write spam model: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return time.Time{}, fmt.Errorf("failed to replace spam model: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to stat spam model: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
+// sync reloads the model if the file was replaced since it was last loaded
+// or saved, otherwise saves pending feedback
+func (c *Classifier) sync() {
+	c.mu.RLock()
+	loaded := c.modTime
+	c.mu.RUnlock()
+
+	if info, err := os.Stat(c.path); err == nil && !info.ModTime().Equal(loaded) {
+		pending := c.Info().Pending
+		if err := c.Load(); err != nil {
+			zap.L().Error("Failed to reload spam model", zap.Error(err))
+			return
+		}
+		info := c.Info()
+		zap.L().Info("Spam model reloaded",
+			zap.Int("revision", info.Revision),
+			zap.Int("ham_docs", info.HamDocs),
+			zap.Int("spam_docs", info.SpamDocs),
+			zap.Int("discarded_feedback", pending))
+		return
+	}
+
+	if err := c.Save(); err != nil {
+		zap.L().Error("Failed to save spam model", zap.Error(err))
+	}
+}
+
+// Run saves feedback and picks up retrained models until the context is
+// cancelled, then saves any remaining feedback
+func (c *Classifier) Run(ctx context.Context) error {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := c.Save(); err != nil {
+				zap.L().Error("Failed to save spam model", zap.Error(err))
+			}
+			return ctx.Err()
+		case <-ticker.C:
+			c.sync()
+		}
+	}
+}
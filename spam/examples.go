@@ -0,0 +1,63 @@
+package spam
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Labels used in labelled JSONL
+const (
+	LabelSpam = "spam"
+	LabelHam  = "ham"
+)
+
+// Example is one labelled message, stored one JSON object per line:
+//
+//	{"text": "加群领红包 http://...", "label": "spam"}
+type Example struct {
+	Text  string `json:"text"`
+	Label string `json:"label"` // "spam" or "ham"
+}
+
+// IsSpam reports whether the example is labelled spam
+func (e Example) IsSpam() bool {
+	return e.Label == LabelSpam
+}
+
+// validate checks the example's label
+func (e Example) validate() error {
+	if e.Label != LabelSpam && e.Label != LabelHam {
+		return fmt.Errorf("label must be %q or %q, got %q", LabelSpam, LabelHam, e.Label)
+	}
+	return nil
+}
+
+// ReadExamples reads labelled JSONL, skipping blank lines
+func ReadExamples(r io.Reader) ([]Example, error) {
+	var examples []Example
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var example Example
+		if err := json.Unmarshal([]byte(text), &example); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := example.validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		examples = append(examples, example)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return examples, nil
+}
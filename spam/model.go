@@ -0,0 +1,117 @@
+package spam
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// minGram and maxGram bound the character n-gram lengths used as features
+	minGram = 1
+	maxGram = 3
+
+	// maxRunes caps how much of a message is looked at
+	maxRunes = 1000
+
+	// minClassDocs is how many examples of each class a model needs before it scores
+	minClassDocs = 5
+)
+
+// Class indices into a model's per-class counts
+const (
+	ham  = 0
+	spam = 1
+)
+
+// Model is a multinomial naive Bayes classifier over character n-grams
+type Model struct {
+	Revision  int               `json:"revision"` // Incremented by each training run or saved batch of feedback
+	TrainedAt time.Time         `json:"trained_at"`
+	Docs      [2]int            `json:"docs"`   // Training examples per class, ham then spam
+	Totals    [2]int            `json:"totals"` // N-gram occurrences per class
+	Grams     map[string][2]int `json:"grams"`  // Occurrences of each n-gram per class
+}
+
+// NewModel creates an untrained model
+func NewModel() *Model {
+	return &Model{Grams: make(map[string][2]int)}
+}
+
+// Train adds one labelled example
+func (m *Model) Train(text string, isSpam bool) {
+	class := ham
+	if isSpam {
+		class = spam
+	}
+	m.Docs[class]++
+	for _, gram := range grams(text) {
+		counts := m.Grams[gram]
+		counts[class]++
+		m.Grams[gram] = counts
+		m.Totals[class]++
+	}
+	m.TrainedAt = time.Now()
+}
+
+// Ready reports whether the model has seen enough of both classes to score
+func (m *Model) Ready() bool {
+	return m.Docs[ham] >= minClassDocs && m.Docs[spam] >= minClassDocs
+}
+
+// Score returns the probability that text is spam, using Laplace smoothing
+func (m *Model) Score(text string) float64 {
+	docs := float64(m.Docs[ham] + m.Docs[spam])
+	logOdds := math.Log(float64(m.Docs[spam])/docs) - math.Log(float64(m.Docs[ham])/docs)
+
+	vocabulary := float64(len(m.Grams))
+	hamDenominator := math.Log(float64(m.Totals[ham]) + vocabulary)
+	spamDenominator := math.Log(float64(m.Totals[spam]) + vocabulary)
+	for _, gram := range grams(text) {
+		counts, ok := m.Grams[gram]
+		if !ok {
+			continue // Unseen in training, carries no evidence either way
+		}
+		logOdds += math.Log(float64(counts[spam])+1) - spamDenominator
+		logOdds -= math.Log(float64(counts[ham])+1) - hamDenominator
+	}
+	return 1 / (1 + math.Exp(-logOdds))
+}
+
+// grams returns the character n-grams of normalised text. Letters are
+// lowercased, digits folded to 0 and whitespace runs collapsed, so phone
+// numbers and spacing tricks look alike.
+func grams(text string) []string {
+	runes := make([]rune, 0, min(len(text), maxRunes))
+	space := true // Drops leading whitespace
+	for _, r := range text {
+		if len(runes) == maxRunes {
+			break
+		}
+		switch {
+		case unicode.IsSpace(r):
+			if space {
+				continue
+			}
+			r, space = ' ', true
+		case unicode.IsDigit(r):
+			r, space = '0', false
+		default:
+			r, space = unicode.ToLower(r), false
+		}
+		runes = append(runes, r)
+	}
+
+	var out []string
+	for n := minGram; n <= maxGram; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			gram := string(runes[i : i+n])
+			if strings.TrimSpace(gram) == "" {
+				continue
+			}
+			out = append(out, gram)
+		}
+	}
+	return out
+}
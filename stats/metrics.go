@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"qqbotrouter/interfaces"
+	"qqbotrouter/metrics"
+)
+
+// RegisterMetrics exposes request totals, error rate, load and user tiers on the registry
+func (s *StatsAnalyzer) RegisterMetrics(registry *metrics.Registry) error {
+	return registry.Register(
+		metrics.NewCounterFunc("qqbotrouter_requests_total",
+			"Finished requests by outcome.",
+			[]string{"outcome"},
+			func(emit metrics.EmitFunc) {
+				succeeded, failed := s.GetOutcomeTotals()
+				emit(float64(succeeded), "success")
+				emit(float64(failed), "failure")
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_requests_in_flight",
+			"Accepted requests not yet finished.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(float64(s.GetActiveConnections()))
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_error_rate",
+			"Share of requests that failed over the last minute.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(s.GetErrorRate())
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_system_load",
+			"In-flight requests as a fraction of capacity.",
+			nil,
+			func(emit metrics.EmitFunc) {
+				emit(s.GetSystemLoad())
+			}),
+		metrics.NewGaugeFunc("qqbotrouter_user_profiles",
+			"Profiled users by behaviour tier.",
+			[]string{"tier"},
+			func(emit metrics.EmitFunc) {
+				counts := s.GetTierCounts()
+				for _, tier := range []string{interfaces.UserTierNew, interfaces.UserTierCasual, interfaces.UserTierActive, interfaces.UserTierFlooding} {
+					emit(float64(counts[tier]), tier)
+				}
+			}),
+	)
+}
@@ -0,0 +1,360 @@
+package stats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/interfaces"
+)
+
+const (
+	// profileFileVersion is the on-disk format version of saved user profiles
+	profileFileVersion = 1
+
+	profileHalfLife     = 7 * 24 * time.Hour  // How quickly old activity loses weight in a profile
+	profileRetention    = 30 * 24 * time.Hour // Profiles idle for longer are forgotten
+	maxProfiles         = 100000              // Least recently seen profiles are evicted beyond this
+	profileSaveInterval = 5 * time.Minute     // How often changed profiles are saved
+
+	maxProfileGap  = 6 * time.Hour // Longer gaps between messages count as this long in the burstiness
+	gapWeight      = 0.05          // EWMA weight of each new gap once the first gaps are averaged
+	minProfileGaps = 10            // Gaps needed before burstiness is reported
+
+	minProfileMessages  = 20   // Messages needed before a user leaves the new tier
+	minProfileOutcomes  = 5    // Finished requests needed before the error rate is reported
+	activeDailyMessages = 10   // Average messages per day of an active user
+	minActiveHours      = 3    // Hours of the day an active user is regularly seen in
+	activeHourShare     = 0.05 // Share of activity that makes an hour of the day a regular one
+	maxActiveErrorRate  = 0.5  // Users whose requests fail more often are not rewarded
+	floodBurstiness     = 3.0  // Burstiness at which half the behaviour threshold already counts as flooding
+
+	defaultAnalysisWindow    = 15 * time.Minute
+	defaultBehaviorThreshold = 50
+)
+
+// userProfile is one user's long-term behaviour. Message volume, the hour of
+// day histogram and request outcomes decay with profileHalfLife, so the
+// profile follows changes in habit over a week or two.
+type userProfile struct {
+	Messages  int64       `json:"messages"`
+	FirstSeen time.Time   `json:"first_seen"`
+	LastSeen  time.Time   `json:"last_seen"`
+	Volume    float64     `json:"volume"`     // Decayed message count as of LastSeen
+	Hours     [24]float64 `json:"hours"`      // Volume by local hour of day
+	GapMean   float64     `json:"gap_mean"`   // Average gap between messages in seconds
+	GapSquare float64     `json:"gap_square"` // Average squared gap
+	Gaps      int         `json:"gaps"`
+	Requests  float64     `json:"requests"` // Decayed finished requests as of OutcomeAt
+	Failures  float64     `json:"failures"` // Decayed failed requests as of OutcomeAt
+	OutcomeAt time.Time   `json:"outcome_at"`
+}
+
+// profilesFile is the on-disk format of saved user profiles
+type profilesFile struct {
+	Version  int                     `json:"version"`
+	Profiles map[string]*userProfile `json:"profiles"`
+}
+
+// decay returns the weight left after elapsed time with the given half-life
+func decay(elapsed, halfLife time.Duration) float64 {
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp2(-float64(elapsed) / float64(halfLife))
+}
+
+// observe records a message at the given time
+func (p *userProfile) observe(at time.Time) {
+	switch {
+	case p.Messages == 0:
+		p.FirstSeen, p.LastSeen = at, at
+	case at.After(p.LastSeen):
+		p.addGap(at.Sub(p.LastSeen))
+		factor := decay(at.Sub(p.LastSeen), profileHalfLife)
+		p.Volume *= factor
+		for hour := range p.Hours {
+			p.Hours[hour] *= factor
+		}
+		p.LastSeen = at
+	}
+	p.Messages++
+	p.Volume++
+	p.Hours[at.Hour()]++
+}
+
+// addGap folds a gap between two messages into the burstiness averages
+func (p *userProfile) addGap(gap time.Duration) {
+	seconds := min(gap, maxProfileGap).Seconds()
+	p.Gaps++
+	weight := max(1/float64(p.Gaps), gapWeight)
+	p.GapMean += weight * (seconds - p.GapMean)
+	p.GapSquare += weight * (seconds*seconds - p.GapSquare)
+}
+
+// recordOutcome records a finished request at the given time
+func (p *userProfile) recordOutcome(at time.Time, success bool) {
+	factor := decay(at.Sub(p.OutcomeAt), profileHalfLife)
+	p.Requests = p.Requests*factor + 1
+	p.Failures *= factor
+	if !success {
+		p.Failures++
+	}
+	if at.After(p.OutcomeAt) {
+		p.OutcomeAt = at
+	}
+}
+
+// burstiness returns the coefficient of variation of the gaps between messages
+func (p *userProfile) burstiness() float64 {
+	if p.Gaps < minProfileGaps || p.GapMean <= 0 {
+		return 0
+	}
+	variance := max(p.GapSquare-p.GapMean*p.GapMean, 0)
+	return math.Sqrt(variance) / p.GapMean
+}
+
+// dailyMessages returns the average messages per day, weighting recent days
+// as the volume does and counting profiles younger than a day as a day old
+func (p *userProfile) dailyMessages(now time.Time) float64 {
+	volume := p.Volume * decay(now.Sub(p.LastSeen), profileHalfLife)
+	age := max(now.Sub(p.FirstSeen), 24*time.Hour)
+	// Days of steady traffic that would add up to the volume after this age
+	days := (1 - decay(age, profileHalfLife)) * profileHalfLife.Hours() / 24 / math.Ln2
+	return volume / days
+}
+
+// errorRate returns the decayed share of the user's requests that failed
+func (p *userProfile) errorRate() float64 {
+	if p.Requests < minProfileOutcomes {
+		return 0
+	}
+	return p.Failures / p.Requests
+}
+
+// activeHours returns the number of hours of the day holding at least activeHourShare of the activity
+func (p *userProfile) activeHours() int {
+	if p.Volume <= 0 {
+		return 0
+	}
+	hours := 0
+	for _, volume := range p.Hours {
+		if volume/p.Volume >= activeHourShare {
+			hours++
+		}
+	}
+	return hours
+}
+
+// hourShare returns the share of the activity that falls in the given hour of day
+func (p *userProfile) hourShare(hour int) float64 {
+	if p.Volume <= 0 {
+		return 0
+	}
+	return p.Hours[hour] / p.Volume
+}
+
+// summary classifies the profile given the user's messages in the analysis window
+func (p *userProfile) summary(now time.Time, recent, threshold int) interfaces.UserProfile {
+	summary := interfaces.UserProfile{
+		Messages:      p.Messages,
+		RecentCount:   recent,
+		DailyMessages: p.dailyMessages(now),
+		Burstiness:    p.burstiness(),
+		ErrorRate:     p.errorRate(),
+		ActiveHours:   p.activeHours(),
+		HourShare:     p.hourShare(now.Hour()),
+	}
+
+	switch {
+	case threshold > 0 && (recent >= threshold || (recent*2 >= threshold && summary.Burstiness >= floodBurstiness)):
+		summary.Tier = interfaces.UserTierFlooding
+	case p.Messages < minProfileMessages:
+		summary.Tier = interfaces.UserTierNew
+	case summary.DailyMessages >= activeDailyMessages &&
+		summary.ActiveHours >= minActiveHours &&
+		summary.ErrorRate < maxActiveErrorRate:
+		summary.Tier = interfaces.UserTierActive
+	default:
+		summary.Tier = interfaces.UserTierCasual
+	}
+	return summary
+}
+
+// SetBehaviorSettings sets the analysis window and the number of messages in
+// it at which a user is classified as flooding; 0 disables the flooding tier
+func (s *StatsAnalyzer) SetBehaviorSettings(window time.Duration, threshold int) {
+	if window <= 0 {
+		window = defaultAnalysisWindow
+	}
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	s.requests.analysisWindow = min(window, userRetention)
+	s.requests.behaviorThreshold = threshold
+}
+
+// GetUserProfile returns a user's behaviour profile, or false if the user has not been seen
+func (s *StatsAnalyzer) GetUserProfile(userID string) (interfaces.UserProfile, bool) {
+	now := time.Now()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	profile, ok := s.requests.profiles[userID]
+	if !ok {
+		return interfaces.UserProfile{}, false
+	}
+	return profile.summary(now, s.recentCountLocked(userID, now), s.requests.behaviorThreshold), true
+}
+
+// GetTierCounts returns the number of profiled users in each tier
+func (s *StatsAnalyzer) GetTierCounts() map[string]int {
+	now := time.Now()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	counts := make(map[string]int, 4)
+	for userID, profile := range s.requests.profiles {
+		counts[profile.summary(now, s.recentCountLocked(userID, now), s.requests.behaviorThreshold).Tier]++
+	}
+	return counts
+}
+
+// recentCountLocked returns the user's messages in the analysis window; s.requests.mu must be held
+func (s *StatsAnalyzer) recentCountLocked(userID string, now time.Time) int {
+	activity, ok := s.requests.users[userID]
+	if !ok {
+		return 0
+	}
+	return activity.count(now, s.requests.analysisWindow)
+}
+
+// pruneProfilesLocked forgets idle profiles and evicts the least recently
+// seen ones beyond maxProfiles; s.requests.mu must be held
+func (s *StatsAnalyzer) pruneProfilesLocked(now time.Time) {
+	for userID, profile := range s.requests.profiles {
+		if now.Sub(profile.LastSeen) > profileRetention {
+			delete(s.requests.profiles, userID)
+			s.requests.profilesDirty = true
+		}
+	}
+	excess := len(s.requests.profiles) - maxProfiles
+	if excess <= 0 {
+		return
+	}
+
+	userIDs := make([]string, 0, len(s.requests.profiles))
+	for userID := range s.requests.profiles {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Slice(userIDs, func(i, j int) bool {
+		return s.requests.profiles[userIDs[i]].LastSeen.Before(s.requests.profiles[userIDs[j]].LastSeen)
+	})
+	for _, userID := range userIDs[:excess] {
+		delete(s.requests.profiles, userID)
+	}
+	s.requests.profilesDirty = true
+}
+
+// SetProfilePath sets the file user profiles are saved to; empty keeps them in memory only
+func (s *StatsAnalyzer) SetProfilePath(path string) {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	s.requests.profilePath = path
+}
+
+// LoadProfiles replaces the user profiles with the contents of the profile file, if it exists
+func (s *StatsAnalyzer) LoadProfiles() error {
+	s.requests.mu.Lock()
+	path := s.requests.profilePath
+	s.requests.mu.Unlock()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read user profiles: %w", err)
+	}
+	var file profilesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse user profiles: %w", err)
+	}
+	if file.Version != profileFileVersion {
+		return fmt.Errorf("unsupported user profiles version %d", file.Version)
+	}
+
+	profiles := make(map[string]*userProfile, len(file.Profiles))
+	for userID, profile := range file.Profiles {
+		if profile != nil && userID != "" {
+			profiles[userID] = profile
+		}
+	}
+
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	s.requests.profiles = profiles
+	s.requests.profilesDirty = false
+	s.pruneProfilesLocked(time.Now())
+	return nil
+}
+
+// SaveProfiles writes the user profiles to the profile file atomically if they changed since the last save
+func (s *StatsAnalyzer) SaveProfiles() error {
+	s.requests.mu.Lock()
+	path := s.requests.profilePath
+	if path == "" || !s.requests.profilesDirty {
+		s.requests.mu.Unlock()
+		return nil
+	}
+	file := profilesFile{Version: profileFileVersion, Profiles: make(map[string]*userProfile, len(s.requests.profiles))}
+	for userID, profile := range s.requests.profiles {
+		saved := *profile
+		file.Profiles[userID] = &saved
+	}
+	s.requests.profilesDirty = false
+	s.requests.mu.Unlock()
+
+	if err := writeProfiles(path, file); err != nil {
+		s.requests.mu.Lock()
+		s.requests.profilesDirty = true
+		s.requests.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// writeProfiles writes saved user profiles atomically
+func writeProfiles(path string, file profilesFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user profiles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create user profiles directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write user profiles: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace user profiles: %w", err)
+	}
+	return nil
+}
+
+// saveProfiles saves the user profiles, logging failures
+func (s *StatsAnalyzer) saveProfiles() {
+	if err := s.SaveProfiles(); err != nil {
+		zap.L().Error("Failed to save user profiles", zap.Error(err))
+	}
+}
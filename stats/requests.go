@@ -0,0 +1,295 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	userBucketWidth   = 10 * time.Second // Resolution of per-user request counts
+	userRetention     = time.Hour        // Longest window GetUserRequestCount can answer
+	outcomeBuckets    = 60               // One-second buckets in the error-rate window
+	responseSmoothing = 0.2              // EWMA weight of each new forward latency sample
+	defaultCapacity   = 100              // In-flight requests treated as full load
+)
+
+// countBucket counts a user's requests that arrived in one bucket of time
+type countBucket struct {
+	start int64 // Bucket start in units of userBucketWidth since the epoch
+	count int
+}
+
+// userActivity is one user's recent arrivals
+type userActivity struct {
+	buckets []countBucket // Oldest first
+	last    time.Time     // Most recent arrival
+}
+
+// add counts an arrival at the given time
+func (u *userActivity) add(at time.Time) {
+	start := at.UnixNano() / int64(userBucketWidth)
+	if n := len(u.buckets); n > 0 && u.buckets[n-1].start >= start {
+		// Arrivals that are out of order by less than a bucket land in the newest one
+		u.buckets[n-1].count++
+	} else {
+		u.buckets = append(u.buckets, countBucket{start: start, count: 1})
+	}
+	if at.After(u.last) {
+		u.last = at
+	}
+}
+
+// trim drops buckets that fell out of the retention period
+func (u *userActivity) trim(now time.Time) {
+	oldest := now.Add(-userRetention).UnixNano() / int64(userBucketWidth)
+	i := 0
+	for i < len(u.buckets) && u.buckets[i].start < oldest {
+		i++
+	}
+	if i > 0 {
+		u.buckets = append(u.buckets[:0], u.buckets[i:]...)
+	}
+}
+
+// count sums the arrivals in buckets starting after now-window
+func (u *userActivity) count(now time.Time, window time.Duration) int {
+	oldest := now.Add(-window).UnixNano() / int64(userBucketWidth)
+	total := 0
+	for i := len(u.buckets) - 1; i >= 0 && u.buckets[i].start >= oldest; i-- {
+		total += u.buckets[i].count
+	}
+	return total
+}
+
+// outcomeCounts counts finished requests in one second of the error-rate window
+type outcomeCounts struct {
+	second    int64
+	successes int
+	failures  int
+}
+
+// requestStats tracks arrivals, outcomes, in-flight requests, forward latency
+// and long-term user profiles
+type requestStats struct {
+	mu       sync.Mutex
+	users    map[string]*userActivity
+	outcomes [outcomeBuckets]outcomeCounts
+
+	profiles          map[string]*userProfile
+	profilePath       string
+	profilesDirty     bool          // Profiles changed since the last save
+	analysisWindow    time.Duration // Window the behaviour threshold applies to
+	behaviorThreshold int           // Messages in the analysis window that classify a user as flooding
+
+	arrivals  int64 // Events recorded with RecordArrival since startup
+	total     int64
+	succeeded int64
+	failed    int64
+
+	responseTime time.Duration // EWMA of forward latency
+
+	inFlight int64 // Accessed atomically
+	capacity int64 // Accessed atomically
+}
+
+// newRequestStats creates empty request statistics
+func newRequestStats() requestStats {
+	return requestStats{
+		users:             make(map[string]*userActivity),
+		profiles:          make(map[string]*userProfile),
+		analysisWindow:    defaultAnalysisWindow,
+		behaviorThreshold: defaultBehaviorThreshold,
+		capacity:          defaultCapacity,
+	}
+}
+
+// RecordArrival records an incoming event from a user. The interval since
+// the user's previous event feeds the P50/P90 interval baselines, and the
+// event updates the user's long-term profile.
+func (s *StatsAnalyzer) RecordArrival(userID string, at time.Time) {
+	if userID == "" || userID == "unknown" {
+		return
+	}
+
+	s.requests.mu.Lock()
+	activity, ok := s.requests.users[userID]
+	if !ok {
+		activity = &userActivity{}
+		s.requests.users[userID] = activity
+	}
+	previous := activity.last
+	activity.add(at)
+	profile, ok := s.requests.profiles[userID]
+	if !ok {
+		profile = &userProfile{}
+		s.requests.profiles[userID] = profile
+	}
+	profile.observe(at)
+	s.requests.profilesDirty = true
+	s.requests.arrivals++
+	s.requests.mu.Unlock()
+
+	if !previous.IsZero() && at.After(previous) {
+		s.RecordMessageInterval(at.Sub(previous))
+	}
+}
+
+// GetUserRequestCount returns the number of events from a user in the given
+// window, at the resolution of userBucketWidth and at most userRetention back
+func (s *StatsAnalyzer) GetUserRequestCount(userID string, window time.Duration) int {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	activity, ok := s.requests.users[userID]
+	if !ok {
+		return 0
+	}
+	return activity.count(time.Now(), window)
+}
+
+// GetArrivalTotal returns the number of events recorded with RecordArrival since startup
+func (s *StatsAnalyzer) GetArrivalTotal() int64 {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return s.requests.arrivals
+}
+
+// GetActiveUsers returns the number of users whose latest event arrived within the window
+func (s *StatsAnalyzer) GetActiveUsers(window time.Duration) int {
+	since := time.Now().Add(-window)
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	active := 0
+	for _, activity := range s.requests.users {
+		if activity.last.After(since) {
+			active++
+		}
+	}
+	return active
+}
+
+// RequestStarted marks an accepted request as in flight until RecordRequest is called for it
+func (s *StatsAnalyzer) RequestStarted() {
+	atomic.AddInt64(&s.requests.inFlight, 1)
+}
+
+// RecordRequest records the outcome of a request started with RequestStarted
+// and ends its in-flight period
+func (s *StatsAnalyzer) RecordRequest(userID string, processingTime time.Duration, success bool) {
+	if atomic.AddInt64(&s.requests.inFlight, -1) < 0 {
+		atomic.StoreInt64(&s.requests.inFlight, 0)
+	}
+
+	now := time.Now()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	s.requests.total++
+	bucket := &s.requests.outcomes[now.Unix()%outcomeBuckets]
+	if bucket.second != now.Unix() {
+		*bucket = outcomeCounts{second: now.Unix()}
+	}
+	if success {
+		s.requests.succeeded++
+		bucket.successes++
+	} else {
+		s.requests.failed++
+		bucket.failures++
+	}
+	if profile, ok := s.requests.profiles[userID]; ok {
+		profile.recordOutcome(now, success)
+		s.requests.profilesDirty = true
+	}
+}
+
+// RecordForward records the latency of a delivery to the bot's destinations
+func (s *StatsAnalyzer) RecordForward(latency time.Duration, success bool) {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	if s.requests.responseTime == 0 {
+		s.requests.responseTime = latency
+		return
+	}
+	s.requests.responseTime = time.Duration(responseSmoothing*float64(latency) + (1-responseSmoothing)*float64(s.requests.responseTime))
+}
+
+// GetAverageResponseTime returns the smoothed forward latency
+func (s *StatsAnalyzer) GetAverageResponseTime() time.Duration {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return s.requests.responseTime
+}
+
+// GetErrorRate returns the share of requests that failed over the last minute
+func (s *StatsAnalyzer) GetErrorRate() float64 {
+	now := time.Now().Unix()
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	successes, failures := 0, 0
+	for _, bucket := range s.requests.outcomes {
+		if now-bucket.second < outcomeBuckets {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	if successes+failures == 0 {
+		return 0
+	}
+	return float64(failures) / float64(successes+failures)
+}
+
+// GetTotalRequests returns the total number of requests processed
+func (s *StatsAnalyzer) GetTotalRequests() int64 {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return s.requests.total
+}
+
+// GetOutcomeTotals returns the number of requests that succeeded and failed since startup
+func (s *StatsAnalyzer) GetOutcomeTotals() (succeeded, failed int64) {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+	return s.requests.succeeded, s.requests.failed
+}
+
+// GetActiveConnections returns the number of requests in flight
+func (s *StatsAnalyzer) GetActiveConnections() int {
+	return int(atomic.LoadInt64(&s.requests.inFlight))
+}
+
+// SetCapacity sets how many in-flight requests count as full load
+func (s *StatsAnalyzer) SetCapacity(capacity int) {
+	if capacity < 1 {
+		capacity = defaultCapacity
+	}
+	atomic.StoreInt64(&s.requests.capacity, int64(capacity))
+}
+
+// GetSystemLoad returns the in-flight requests as a fraction of capacity (0.0 to 1.0)
+func (s *StatsAnalyzer) GetSystemLoad() float64 {
+	inFlight := float64(atomic.LoadInt64(&s.requests.inFlight))
+	capacity := float64(atomic.LoadInt64(&s.requests.capacity))
+	if capacity <= 0 {
+		return 0
+	}
+	return min(inFlight/capacity, 1.0)
+}
+
+// pruneUsers drops activity older than userRetention, forgets idle users and
+// forgets profiles idle for longer than profileRetention
+func (s *StatsAnalyzer) pruneUsers(now time.Time) {
+	s.requests.mu.Lock()
+	defer s.requests.mu.Unlock()
+
+	for userID, activity := range s.requests.users {
+		activity.trim(now)
+		if len(activity.buckets) == 0 {
+			delete(s.requests.users, userID)
+		}
+	}
+	s.pruneProfilesLocked(now)
+}
@@ -5,38 +5,43 @@ import (
 	"sync"
 	"time"
 
-	"github.com/montanaflynn/stats"
 	"qqbotrouter/interfaces"
+	"qqbotrouter/sketch"
 )
 
 // Ensure StatsAnalyzer implements StatProvider interface
 var _ interfaces.StatProvider = (*StatsAnalyzer)(nil)
 
-// StatsAnalyzer analyzes user message intervals to determine dynamic baselines.
+// intervalHalfLife is how quickly old message intervals lose weight in the baselines
+const intervalHalfLife = 10 * time.Minute
+
+// StatsAnalyzer analyzes user message intervals to determine dynamic baselines
+// and tracks per-user request counts, request outcomes and load.
 type StatsAnalyzer struct {
 	mutex            sync.RWMutex
-	messageIntervals []float64
+	messageIntervals *sketch.Quantiles // Intervals in milliseconds, time-decayed
 	p50              time.Duration
 	p90              time.Duration
+	p95              time.Duration
 	minDataPoints    int
 	modeSwitched     chan bool
+
+	requests requestStats
 }
 
 // NewStatsAnalyzer creates a new StatsAnalyzer.
 func NewStatsAnalyzer(minDataPoints int) *StatsAnalyzer {
 	return &StatsAnalyzer{
-		messageIntervals: make([]float64, 0, 10000),
+		messageIntervals: sketch.New(intervalHalfLife),
 		minDataPoints:    minDataPoints,
 		modeSwitched:     make(chan bool, 1),
+		requests:         newRequestStats(),
 	}
 }
 
 // RecordMessageInterval records a new message interval.
 func (s *StatsAnalyzer) RecordMessageInterval(interval time.Duration) {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s.messageIntervals = append(s.messageIntervals, float64(interval.Milliseconds()))
+	s.messageIntervals.Add(float64(interval)/float64(time.Millisecond), time.Now())
 }
 
 // P50 returns the 50th percentile of message intervals.
@@ -55,22 +60,41 @@ func (s *StatsAnalyzer) P90() time.Duration {
 	return s.p90
 }
 
+// P95 returns the 95th percentile of message intervals.
+func (s *StatsAnalyzer) P95() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.p95
+}
+
 // ModeSwitched notifies the StatsAnalyzer that the behavior mode has switched.
+// A switch already waiting to be handled absorbs further ones.
 func (s *StatsAnalyzer) ModeSwitched() {
-	s.modeSwitched <- true
+	select {
+	case s.modeSwitched <- true:
+	default:
+	}
 }
 
-// Run starts the stats analyzer with context support
+// Run starts the stats analyzer with context support, saving user profiles
+// periodically and on shutdown
 func (s *StatsAnalyzer) Run(ctx context.Context) error {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
+	saveTicker := time.NewTicker(profileSaveInterval)
+	defer saveTicker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
+			s.saveProfiles()
 			return ctx.Err()
-		case <-ticker.C:
+		case now := <-ticker.C:
 			s.updateBaselines()
+			s.pruneUsers(now)
+		case <-saveTicker.C:
+			s.saveProfiles()
 		case <-s.modeSwitched:
 			s.reset()
 			s.updateBaselines()
@@ -99,28 +123,24 @@ func (s *StatsAnalyzer) RunWithContext(ctx context.Context, ticker *time.Ticker)
 	}
 }
 
-// updateBaselines calculates the P50 and P90 message intervals.
+// updateBaselines calculates the P50, P90 and P95 message intervals.
 func (s *StatsAnalyzer) updateBaselines() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	if len(s.messageIntervals) < s.minDataPoints {
+	if s.messageIntervals.Count(time.Now()) < float64(s.minDataPoints) {
 		return
 	}
 
-	p50, err := stats.Percentile(s.messageIntervals, 50)
-	if err != nil {
-		// Handle error
-		return
-	}
-	s.p50 = time.Duration(p50) * time.Millisecond
+	p50 := intervalDuration(s.messageIntervals.Quantile(0.50))
+	p90 := intervalDuration(s.messageIntervals.Quantile(0.90))
+	p95 := intervalDuration(s.messageIntervals.Quantile(0.95))
 
-	p90, err := stats.Percentile(s.messageIntervals, 90)
-	if err != nil {
-		// Handle error
-		return
-	}
-	s.p90 = time.Duration(p90) * time.Millisecond
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.p50, s.p90, s.p95 = p50, p90, p95
+}
+
+// intervalDuration converts an interval in milliseconds back into a duration
+func intervalDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
 }
 
 // GetCurrentBaseline returns the current P50 and P90 baselines in milliseconds.
@@ -133,51 +153,5 @@ func (s *StatsAnalyzer) GetCurrentBaseline() (p50Ms, p90Ms int64) {
 
 // reset clears the collected message intervals.
 func (s *StatsAnalyzer) reset() {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s.messageIntervals = make([]float64, 0, 10000)
-}
-
-// GetUserRequestCount returns the number of requests for a user in a time window
-func (s *StatsAnalyzer) GetUserRequestCount(userID string, window time.Duration) int {
-	// Simplified implementation for interface compliance
-	return 0
-}
-
-// GetAverageResponseTime returns the average response time
-func (s *StatsAnalyzer) GetAverageResponseTime() time.Duration {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
-	return s.p50 // Use P50 as average response time approximation
-}
-
-// GetErrorRate returns the current error rate
-func (s *StatsAnalyzer) GetErrorRate() float64 {
-	// Simplified implementation for interface compliance
-	return 0.0
-}
-
-// GetTotalRequests returns the total number of requests processed
-func (s *StatsAnalyzer) GetTotalRequests() int64 {
-	// Simplified implementation for interface compliance
-	return 0
-}
-
-// GetActiveConnections returns the number of active connections
-func (s *StatsAnalyzer) GetActiveConnections() int {
-	// Simplified implementation for interface compliance
-	return 0
-}
-
-// RecordRequest records a request with processing time and success status
-func (s *StatsAnalyzer) RecordRequest(userID string, processingTime time.Duration, success bool) {
-	// For now, just record the processing time as a message interval
-	s.RecordMessageInterval(processingTime)
-}
-
-// GetSystemLoad returns the current system load
-func (s *StatsAnalyzer) GetSystemLoad() float64 {
-	// Simplified implementation for interface compliance
-	return 0.0
+	s.messageIntervals.Reset()
 }
@@ -0,0 +1,248 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"qqbotrouter/config"
+)
+
+// scopeName identifies the router as the instrumentation scope in exported spans
+const scopeName = "qqbotrouter"
+
+// Exporter sends finished spans somewhere they can be inspected
+type Exporter interface {
+	// Export sends a batch of spans; the slice is not retained
+	Export(ctx context.Context, spans []SpanData) error
+
+	// Shutdown flushes and releases the exporter
+	Shutdown(ctx context.Context) error
+}
+
+// NewExporter creates the exporter selected by the tracing configuration.
+// The file exporter writes to traces.jsonl in dataDir unless a file is set.
+func NewExporter(cfg config.TracingConfig, dataDir string) (Exporter, error) {
+	switch cfg.Exporter {
+	case config.TraceExporterOTLP:
+		return NewOTLPExporter(cfg.Endpoint, cfg.Headers, cfg.ServiceName), nil
+	case config.TraceExporterFile:
+		path := cfg.File
+		if path == "" {
+			path = filepath.Join(dataDir, "traces.jsonl")
+		}
+		return NewFileExporter(path, cfg.ServiceName)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP collector using the JSON encoding
+type OTLPExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+}
+
+// NewOTLPExporter creates an exporter for the given traces endpoint, e.g.
+// http://localhost:4318/v1/traces
+func NewOTLPExporter(endpoint string, headers map[string]string, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+	}
+}
+
+// Export posts the spans as one ExportTraceServiceRequest
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	payload, err := json.Marshal(encodeRequest(e.serviceName, spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Shutdown has nothing to release; every export is sent synchronously
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// FileExporter appends each batch to a file as one ExportTraceServiceRequest
+// per line, the layout read by the OpenTelemetry Collector's otlpjsonfile receiver
+type FileExporter struct {
+	mu          sync.Mutex
+	file        *os.File
+	serviceName string
+}
+
+// NewFileExporter opens path for appending, creating it and its directory if needed
+func NewFileExporter(path string, serviceName string) (*FileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &FileExporter{file: file, serviceName: serviceName}, nil
+}
+
+// Export writes the spans as one JSON line
+func (e *FileExporter) Export(ctx context.Context, spans []SpanData) error {
+	line, err := json.Marshal(encodeRequest(e.serviceName, spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	line = append(line, '\n')
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write spans: %w", err)
+	}
+	return nil
+}
+
+// Shutdown syncs and closes the file
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.file.Sync(); err != nil {
+		e.file.Close()
+		return err
+	}
+	return e.file.Close()
+}
+
+// The types below follow the OTLP JSON encoding: IDs are hex strings and
+// 64-bit integers are decimal strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// encodeRequest builds an ExportTraceServiceRequest for the spans
+func encodeRequest(serviceName string, spans []SpanData) otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           span.SpanContext.TraceID.String(),
+			SpanID:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.Status, Message: span.StatusMessage},
+		}
+		if span.Parent.IsValid() {
+			encoded[i].ParentSpanID = span.Parent.String()
+		}
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]Attribute{String("service.name", serviceName)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: encoded}},
+	}}}
+}
+
+// encodeAttributes converts attributes to OTLP key-values
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	encoded := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		var value otlpAnyValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpKeyValue{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
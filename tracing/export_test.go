@@ -0,0 +1,153 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileExporter(t *testing.T) {
+	start := time.Unix(1700000000, 123)
+	root := SpanData{
+		Name:        "webhook",
+		Kind:        KindServer,
+		SpanContext: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Sampled: true},
+		Start:       start,
+		End:         start.Add(time.Second),
+		Attributes: []Attribute{
+			String("bot", "a"),
+			Int("priority", 7),
+			Float64("score", 0.5),
+			Bool("allowlisted", true),
+		},
+		Status:        StatusError,
+		StatusMessage: "no destination accepted the event",
+	}
+	child := SpanData{
+		Name:        "forward",
+		Kind:        KindClient,
+		SpanContext: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{3}, Sampled: true},
+		Parent:      SpanID{2},
+		Start:       start,
+		End:         start,
+	}
+
+	tests := []struct {
+		name    string
+		batches [][]SpanData
+		want    []string // Expected JSON of each line
+	}{
+		{
+			name:    "root span with attributes and status",
+			batches: [][]SpanData{{root}},
+			want: []string{`{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"router-test"}}]},` +
+				`"scopeSpans":[{"scope":{"name":"qqbotrouter"},"spans":[{"traceId":"01000000000000000000000000000000","spanId":"0200000000000000",` +
+				`"name":"webhook","kind":2,"startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000001000000123",` +
+				`"attributes":[{"key":"bot","value":{"stringValue":"a"}},{"key":"priority","value":{"intValue":"7"}},` +
+				`{"key":"score","value":{"doubleValue":0.5}},{"key":"allowlisted","value":{"boolValue":true}}],` +
+				`"status":{"code":2,"message":"no destination accepted the event"}}]}]}]}`},
+		},
+		{
+			name:    "one line per batch",
+			batches: [][]SpanData{{child}, {child, child}},
+			want: []string{
+				`{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"router-test"}}]},` +
+					`"scopeSpans":[{"scope":{"name":"qqbotrouter"},"spans":[` + childJSON + `]}]}]}`,
+				`{"resourceSpans":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"router-test"}}]},` +
+					`"scopeSpans":[{"scope":{"name":"qqbotrouter"},"spans":[` + childJSON + `,` + childJSON + `]}]}]}`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nested", "traces.jsonl")
+			exporter, err := NewFileExporter(path, "router-test")
+			if err != nil {
+				t.Fatalf("NewFileExporter: %v", err)
+			}
+			for _, batch := range tt.batches {
+				if err := exporter.Export(context.Background(), batch); err != nil {
+					t.Fatalf("Export: %v", err)
+				}
+			}
+			if err := exporter.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+
+			lines := readLines(t, path)
+			if len(lines) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(lines), len(tt.want))
+			}
+			for i := range lines {
+				assertSameJSON(t, lines[i], tt.want[i])
+			}
+		})
+	}
+}
+
+// childJSON is the encoding of the child span in TestFileExporter
+const childJSON = `{"traceId":"01000000000000000000000000000000","spanId":"0300000000000000","parentSpanId":"0200000000000000",` +
+	`"name":"forward","kind":3,"startTimeUnixNano":"1700000000000000123","endTimeUnixNano":"1700000000000000123","status":{}}`
+
+func TestFileExporterAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	span := SpanData{Name: "deliver", Kind: KindInternal, SpanContext: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{1}}}
+
+	for i := 0; i < 2; i++ {
+		exporter, err := NewFileExporter(path, "router-test")
+		if err != nil {
+			t.Fatalf("NewFileExporter: %v", err)
+		}
+		if err := exporter.Export(context.Background(), []SpanData{span}); err != nil {
+			t.Fatalf("Export: %v", err)
+		}
+		if err := exporter.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	}
+
+	if lines := readLines(t, path); len(lines) != 2 {
+		t.Errorf("reopening the file kept %d lines, want 2", len(lines))
+	}
+}
+
+// readLines returns the lines of a file
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return lines
+}
+
+// assertSameJSON compares two JSON documents regardless of formatting
+func assertSameJSON(t *testing.T, got, want string) {
+	t.Helper()
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		t.Fatalf("line is not JSON: %v\n%s", err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("expected value is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("line mismatch\ngot:  %s\nwant: %s", got, want)
+	}
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind describes a span's role, with the values used by OTLP
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1 // An operation inside the router
+	KindServer   SpanKind = 2 // Handling an incoming webhook
+	KindClient   SpanKind = 3 // A request to a downstream service
+)
+
+// StatusCode is the outcome of a span, with the values used by OTLP
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a key-value pair describing a span
+type Attribute struct {
+	Key   string
+	Value interface{} // string, int64, float64 or bool
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Float64 returns a floating-point attribute
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is a finished span as handed to an exporter
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanID // Zero for a root span
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	Status        StatusCode
+	StatusMessage string
+}
+
+// Span is one timed operation in a trace. All methods are safe on a nil
+// span, which is what Start returns while tracing is disabled.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext returns the span's propagation context
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// SetStatus sets the span's outcome
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Status = code
+	s.data.StatusMessage = message
+}
+
+// RecordError marks the span as failed with the error's message; a nil error is ignored
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span now
+func (s *Span) End() {
+	s.EndAt(time.Now())
+}
+
+// EndAt finishes the span at the given time and queues it for export if it
+// is sampled; later calls have no effect
+func (s *Span) EndAt(end time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = end
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.Sampled {
+		s.tracer.enqueue(data)
+	}
+}
+
+// StartOption customises a new span
+type StartOption func(*SpanData)
+
+// WithKind sets the span kind; the default is KindInternal
+func WithKind(kind SpanKind) StartOption {
+	return func(d *SpanData) { d.Kind = kind }
+}
+
+// WithStartTime backdates the span, e.g. for time spent waiting in a queue
+func WithStartTime(start time.Time) StartOption {
+	return func(d *SpanData) { d.Start = start }
+}
+
+// WithAttributes sets the span's initial attributes
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(d *SpanData) { d.Attributes = append(d.Attributes, attrs...) }
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan returns a context carrying the span as the parent of spans started from it
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by the context, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteParent returns a context whose next span continues a trace
+// started by another service, e.g. one read with Extract
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// parentFromContext returns the span context new spans in ctx descend from
+func parentFromContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext(), true
+	}
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok
+}
@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// TraceparentHeader is the W3C Trace Context header carrying the trace and parent span
+const TraceparentHeader = "traceparent"
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// IsValid reports whether the ID is non-zero
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String returns the ID as lowercase hex
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether the ID is non-zero
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// String returns the ID as lowercase hex
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// SpanContext is the part of a span that propagates across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// newTraceID returns a random trace ID
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID returns a random span ID
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// ParseTraceparent parses a version-00 traceparent header value
+// ("00-<trace-id>-<parent-id>-<flags>"). Unknown future versions are read
+// by their first four fields, as the specification asks.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	var versionBytes, flagBytes [1]byte
+	if !decodeLowerHex(versionBytes[:], version) || !decodeLowerHex(sc.TraceID[:], traceID) ||
+		!decodeLowerHex(sc.SpanID[:], spanID) || !decodeLowerHex(flagBytes[:], flags) {
+		return SpanContext{}, false
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flagBytes[0]&0x01 == 0x01
+	return sc, true
+}
+
+// decodeLowerHex decodes src into dst, rejecting uppercase digits as the specification requires
+func decodeLowerHex(dst []byte, src string) bool {
+	if strings.ToLower(src) != src {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(src))
+	return err == nil
+}
+
+// FormatTraceparent encodes a span context as a traceparent header value
+func FormatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract reads the caller's span context from a traceparent header
+func Extract(header http.Header) (SpanContext, bool) {
+	value := header.Get(TraceparentHeader)
+	if value == "" {
+		return SpanContext{}, false
+	}
+	return ParseTraceparent(value)
+}
+
+// Inject writes the span context as a traceparent header, replacing any
+// existing one. An invalid context (tracing disabled) leaves the header
+// untouched; tracestate is always passed through unchanged.
+func Inject(sc SpanContext, header http.Header) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceparentHeader, FormatTraceparent(sc))
+}
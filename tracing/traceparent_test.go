@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-" + traceID + "-" + spanID + "-01", wantOK: true, wantSampled: true},
+		{name: "not sampled", value: "00-" + traceID + "-" + spanID + "-00", wantOK: true},
+		{name: "other flags ignored", value: "00-" + traceID + "-" + spanID + "-03", wantOK: true, wantSampled: true},
+		{name: "surrounding whitespace", value: "  00-" + traceID + "-" + spanID + "-01 ", wantOK: true, wantSampled: true},
+
+		{name: "version ff", value: "ff-" + traceID + "-" + spanID + "-01"},
+		{name: "version not hex", value: "0g-" + traceID + "-" + spanID + "-01"},
+		{name: "version too long", value: "000-" + traceID + "-" + spanID + "-01"},
+		{name: "version uppercase", value: "0A-" + traceID + "-" + spanID + "-01"},
+
+		{name: "all-zero trace ID", value: "00-00000000000000000000000000000000-" + spanID + "-01"},
+		{name: "all-zero span ID", value: "00-" + traceID + "-0000000000000000-01"},
+		{name: "uppercase trace ID", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + spanID + "-01"},
+		{name: "uppercase span ID", value: "00-" + traceID + "-00F067AA0BA902B7-01"},
+		{name: "uppercase flags", value: "00-" + traceID + "-" + spanID + "-0A"},
+		{name: "short trace ID", value: "00-" + traceID[1:] + "-" + spanID + "-01"},
+		{name: "short span ID", value: "00-" + traceID + "-" + spanID[1:] + "-01"},
+		{name: "non-hex flags", value: "00-" + traceID + "-" + spanID + "-zz"},
+		{name: "missing flags", value: "00-" + traceID + "-" + spanID},
+		{name: "empty", value: ""},
+
+		{name: "version 00 with extra fields", value: "00-" + traceID + "-" + spanID + "-01-extra"},
+		{name: "future version", value: "01-" + traceID + "-" + spanID + "-01", wantOK: true, wantSampled: true},
+		{name: "future version with extra fields", value: "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", wantOK: true, wantSampled: true},
+		{name: "future version with longer flags", value: "cc-" + traceID + "-" + spanID + "-01what"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			if ok != tt.wantOK {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.value, ok, tt.wantOK)
+			}
+			if !ok {
+				if sc != (SpanContext{}) {
+					t.Errorf("rejected header returned non-zero context %+v", sc)
+				}
+				return
+			}
+			if sc.TraceID.String() != traceID || sc.SpanID.String() != spanID {
+				t.Errorf("got IDs %s/%s, want %s/%s", sc.TraceID, sc.SpanID, traceID, spanID)
+			}
+			if sc.Sampled != tt.wantSampled {
+				t.Errorf("Sampled = %v, want %v", sc.Sampled, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		sc := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: sampled}
+
+		header := http.Header{}
+		Inject(sc, header)
+		got, ok := Extract(header)
+		if !ok || got != sc {
+			t.Errorf("Extract(Inject(%+v)) = %+v, %v", sc, got, ok)
+		}
+	}
+}
+
+func TestInjectInvalidContext(t *testing.T) {
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Inject(SpanContext{}, header)
+	if got := header.Get(TraceparentHeader); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("invalid context replaced the header with %q", got)
+	}
+}
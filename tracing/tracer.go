@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"qqbotrouter/config"
+)
+
+// exportTimeout bounds a single export call
+const exportTimeout = 10 * time.Second
+
+// Tracer creates spans and exports the sampled ones in batches
+type Tracer struct {
+	exporter      Exporter
+	logger        *zap.Logger
+	sampleRatio   float64
+	batchSize     int
+	flushInterval time.Duration
+	queue         chan SpanData
+	dropped       int64 // Spans lost because the queue was full, accessed atomically
+}
+
+// NewTracer creates a tracer that samples and batches spans as configured
+func NewTracer(cfg config.TracingConfig, exporter Exporter, logger *zap.Logger) *Tracer {
+	batchSize := cfg.BatchSize
+	if batchSize < 1 {
+		batchSize = config.GetDefaultTracingConfig().BatchSize
+	}
+	return &Tracer{
+		exporter:      exporter,
+		logger:        logger,
+		sampleRatio:   cfg.SampleRatio,
+		batchSize:     batchSize,
+		flushInterval: config.ParseDurationOrDefault(cfg.FlushInterval, 5*time.Second),
+		queue:         make(chan SpanData, batchSize*4),
+	}
+}
+
+// Start begins a span as a child of the span or remote parent in ctx, or as
+// the root of a new trace, and returns a context carrying it
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	span := &Span{tracer: t}
+	span.data = SpanData{Name: name, Kind: KindInternal, Start: time.Now()}
+	for _, opt := range opts {
+		opt(&span.data)
+	}
+
+	if parent, ok := parentFromContext(ctx); ok {
+		// Parent-based sampling keeps a trace whole across services
+		span.data.SpanContext = SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+		span.data.Parent = parent.SpanID
+	} else {
+		traceID := newTraceID()
+		span.data.SpanContext = SpanContext{TraceID: traceID, SpanID: newSpanID(), Sampled: t.sampled(traceID)}
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// sampled decides from the trace ID whether a new trace is recorded, so the
+// decision is the same wherever the ID is seen
+func (t *Tracer) sampled(traceID TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	return binary.BigEndian.Uint64(traceID[8:]) < uint64(t.sampleRatio*math.MaxUint64)
+}
+
+// enqueue hands a finished span to the export loop, dropping it if the queue is full
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case t.queue <- data:
+	default:
+		atomic.AddInt64(&t.dropped, 1)
+	}
+}
+
+// Dropped returns the number of spans lost because the export queue was full
+func (t *Tracer) Dropped() int64 {
+	return atomic.LoadInt64(&t.dropped)
+}
+
+// Run exports finished spans in batches until the context is cancelled, then
+// flushes what is left and shuts the exporter down
+func (t *Tracer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		exportCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		if err := t.exporter.Export(exportCtx, batch); err != nil {
+			t.logger.Warn("Failed to export spans",
+				zap.Int("spans", len(batch)),
+				zap.Error(err))
+		}
+		batch = make([]SpanData, 0, t.batchSize)
+	}
+	add := func(data SpanData) {
+		batch = append(batch, data)
+		if len(batch) >= t.batchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for drained := false; !drained; {
+				select {
+				case data := <-t.queue:
+					add(data)
+				default:
+					drained = true
+				}
+			}
+			flush()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			defer cancel()
+			if err := t.exporter.Shutdown(shutdownCtx); err != nil {
+				t.logger.Warn("Failed to shut down trace exporter", zap.Error(err))
+			}
+			return ctx.Err()
+		case data := <-t.queue:
+			add(data)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// global is the tracer used by Start; nil while tracing is disabled
+var global atomic.Pointer[Tracer]
+
+// SetTracer makes the tracer the one used by Start; nil disables tracing
+func SetTracer(t *Tracer) {
+	global.Store(t)
+}
+
+// Start begins a span with the global tracer. While tracing is disabled it
+// returns ctx unchanged and a nil span, whose methods do nothing.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	t := global.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.Start(ctx, name, opts...)
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// traceIDWithSample returns a trace ID whose sampling value, its low eight bytes, is v
+func traceIDWithSample(v uint64) TraceID {
+	var id TraceID
+	id[0] = 1
+	binary.BigEndian.PutUint64(id[8:], v)
+	return id
+}
+
+func TestSampled(t *testing.T) {
+	tests := []struct {
+		name  string
+		ratio float64
+		id    TraceID
+		want  bool
+	}{
+		{name: "ratio 1 keeps the highest ID", ratio: 1, id: traceIDWithSample(math.MaxUint64), want: true},
+		{name: "ratio 0 drops the lowest ID", ratio: 0, id: traceIDWithSample(0)},
+		{name: "ratio above 1 keeps everything", ratio: 2, id: traceIDWithSample(math.MaxUint64), want: true},
+		{name: "negative ratio drops everything", ratio: -1, id: traceIDWithSample(0)},
+		{name: "half keeps the lower half", ratio: 0.5, id: traceIDWithSample(math.MaxUint64/2 - 1<<20), want: true},
+		{name: "half drops the upper half", ratio: 0.5, id: traceIDWithSample(math.MaxUint64/2 + 1<<20)},
+		{name: "high bytes do not matter", ratio: 0.5, id: TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &Tracer{sampleRatio: tt.ratio}
+			if got := tracer.sampled(tt.id); got != tt.want {
+				t.Errorf("sampled(%s) with ratio %g = %v, want %v", tt.id, tt.ratio, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSampledRatio(t *testing.T) {
+	const traces = 20000
+	for _, ratio := range []float64{0.1, 0.25, 0.9} {
+		tracer := &Tracer{sampleRatio: ratio}
+		kept := 0
+		for i := 0; i < traces; i++ {
+			if tracer.sampled(newTraceID()) {
+				kept++
+			}
+		}
+		if got := float64(kept) / traces; math.Abs(got-ratio) > 0.02 {
+			t.Errorf("ratio %g kept %.3f of traces", ratio, got)
+		}
+	}
+}
+
+func TestStartFollowsParentSampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		ratio   float64
+		parent  bool // Whether there is a remote parent
+		sampled bool // The remote parent's decision
+		want    bool
+	}{
+		{name: "root uses ratio 1", ratio: 1, want: true},
+		{name: "root uses ratio 0", ratio: 0},
+		{name: "sampled parent overrides ratio 0", ratio: 0, parent: true, sampled: true, want: true},
+		{name: "unsampled parent overrides ratio 1", ratio: 1, parent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &Tracer{sampleRatio: tt.ratio, queue: make(chan SpanData, 1)}
+			ctx := context.Background()
+			remote := SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: tt.sampled}
+			if tt.parent {
+				ctx = ContextWithRemoteParent(ctx, remote)
+			}
+
+			ctx, span := tracer.Start(ctx, "parent")
+			_, child := tracer.Start(ctx, "child")
+			for _, s := range []*Span{span, child} {
+				if got := s.SpanContext().Sampled; got != tt.want {
+					t.Errorf("%s Sampled = %v, want %v", s.data.Name, got, tt.want)
+				}
+			}
+			if tt.parent && (span.SpanContext().TraceID != remote.TraceID || span.data.Parent != remote.SpanID) {
+				t.Errorf("span did not continue the remote trace")
+			}
+			if child.SpanContext().TraceID != span.SpanContext().TraceID || child.data.Parent != span.SpanContext().SpanID {
+				t.Errorf("child is not a child of its parent span")
+			}
+		})
+	}
+}
@@ -1,18 +1,62 @@
 package utils
 
 import (
-	"crypto/md5"
 	"encoding/json"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // MessageInfo contains extracted message information
 type MessageInfo struct {
-	UserID  string
-	Message string
+	UserID    string
+	Message   string
+	EventType string    // Dispatch event type, e.g. GROUP_AT_MESSAGE_CREATE
+	EventID   string    // Event ID of the dispatch packet
+	MessageID string    // Message ID used for passive replies
+	Timestamp time.Time // Time the event was created, zero if unknown
+
+	GroupID   string // Group openid for group messages
+	GuildID   string // Guild ID for channel (guild) messages
+	ChannelID string // Channel ID for channel (guild) messages
+
+	ContentType string            // Dominant content type, see DetectContentType
+	Attachments AttachmentSummary // Summary of attachments and rich content
+}
+
+// AttachmentSummary describes the non-text parts of a message
+type AttachmentSummary struct {
+	Count        int      `json:"count"`
+	Images       int      `json:"images"`
+	Videos       int      `json:"videos"`
+	Audio        int      `json:"audio"`
+	Files        int      `json:"files"`
+	TotalSize    int64    `json:"total_size"`
+	ContentTypes []string `json:"content_types,omitempty"`
+	HasMarkdown  bool     `json:"has_markdown"`
+	HasArk       bool     `json:"has_ark"`
+	HasEmbed     bool     `json:"has_embed"`
 }
 
+// Content types reported by DetectContentType
+const (
+	ContentTypeEmpty    = "empty"
+	ContentTypeText     = "text"
+	ContentTypeLongText = "long_text"
+	ContentTypeURL      = "url"
+	ContentTypeImage    = "image"
+	ContentTypeVideo    = "video"
+	ContentTypeAudio    = "audio"
+	ContentTypeFile     = "file"
+	ContentTypeMarkdown = "markdown"
+	ContentTypeArk      = "ark"
+	ContentTypeEmbed    = "embed"
+)
+
+// longTextThreshold is the message length above which text counts as long_text
+const longTextThreshold = 1000
+
 // ParseMessage extracts user ID and message content from request body (returns separate values)
 func ParseMessage(body []byte) (string, string) {
 	msgInfo := ExtractMessageInfo(body)
@@ -24,32 +68,180 @@ func ExtractMessageInfo(body []byte) MessageInfo {
 	// Try to parse as JSON (QQ Bot webhook format)
 	var payload map[string]interface{}
 	if err := json.Unmarshal(body, &payload); err != nil {
-		return MessageInfo{UserID: "unknown", Message: string(body)}
+		return MessageInfo{UserID: "unknown", Message: string(body), ContentType: DetectContentType(string(body), AttachmentSummary{})}
 	}
 
-	userID := "unknown"
-	message := string(body)
+	info := MessageInfo{UserID: "unknown", Message: string(body)}
+	info.EventType, _ = payload["t"].(string)
+	info.EventID, _ = payload["id"].(string)
+
+	// Dispatch packets carry the event in "d"; fall back to the top level for flat payloads
+	event := payload
+	if d, ok := payload["d"].(map[string]interface{}); ok {
+		event = d
+		info.MessageID, _ = d["id"].(string)
+	}
 
 	// Extract user ID from different possible fields
-	if author, ok := payload["author"].(map[string]interface{}); ok {
-		if id, ok := author["id"].(string); ok {
-			userID = id
+	if author, ok := event["author"].(map[string]interface{}); ok {
+		for _, field := range []string{"id", "member_openid", "user_openid", "union_openid"} {
+			if id, ok := author[field].(string); ok && id != "" {
+				info.UserID = id
+				break
+			}
 		}
 	}
-	if userID == "unknown" {
-		if id, ok := payload["user_id"].(string); ok {
-			userID = id
+	if info.UserID == "unknown" {
+		if id, ok := event["user_id"].(string); ok {
+			info.UserID = id
 		}
 	}
 
+	// Extract where the message was sent
+	for _, field := range []string{"group_openid", "group_id"} {
+		if id, ok := event[field].(string); ok && id != "" {
+			info.GroupID = id
+			break
+		}
+	}
+	info.GuildID, _ = event["guild_id"].(string)
+	info.ChannelID, _ = event["channel_id"].(string)
+
 	// Extract message content
-	if content, ok := payload["content"].(string); ok {
-		message = content
-	} else if msg, ok := payload["message"].(string); ok {
-		message = msg
+	if content, ok := event["content"].(string); ok {
+		info.Message = content
+	} else if msg, ok := event["message"].(string); ok {
+		info.Message = msg
+	}
+
+	// Summarise attachments and rich content, then classify the message
+	info.Attachments = summarizeAttachments(event)
+	info.ContentType = DetectContentType(info.Message, info.Attachments)
+
+	// Extract event timestamp (RFC 3339 string or unix seconds)
+	switch ts := event["timestamp"].(type) {
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, ts); err == nil {
+			info.Timestamp = parsed
+		}
+	case float64:
+		info.Timestamp = time.Unix(int64(ts), 0)
+	}
+
+	return info
+}
+
+// summarizeAttachments inspects the attachments, media, markdown, ark and embed fields of an event
+func summarizeAttachments(event map[string]interface{}) AttachmentSummary {
+	var summary AttachmentSummary
+
+	if attachments, ok := event["attachments"].([]interface{}); ok {
+		for _, item := range attachments {
+			attachment, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			contentType, _ := attachment["content_type"].(string)
+			filename, _ := attachment["filename"].(string)
+			if size, ok := attachment["size"].(float64); ok {
+				summary.TotalSize += int64(size)
+			}
+			summary.addKind(classifyAttachment(contentType, filename), contentType)
+		}
+	}
+
+	// Rich media uploaded through the v2 API carries a numeric file_type
+	if media, ok := event["media"].(map[string]interface{}); ok {
+		fileType, _ := media["file_type"].(float64)
+		switch int(fileType) {
+		case 1:
+			summary.addKind(ContentTypeImage, "")
+		case 2:
+			summary.addKind(ContentTypeVideo, "")
+		case 3:
+			summary.addKind(ContentTypeAudio, "")
+		default:
+			summary.addKind(ContentTypeFile, "")
+		}
 	}
 
-	return MessageInfo{UserID: userID, Message: message}
+	summary.HasMarkdown = event["markdown"] != nil
+	summary.HasArk = event["ark"] != nil
+	summary.HasEmbed = event["embed"] != nil || event["embeds"] != nil
+	return summary
+}
+
+// addKind counts one attachment of the given kind
+func (a *AttachmentSummary) addKind(kind, contentType string) {
+	a.Count++
+	switch kind {
+	case ContentTypeImage:
+		a.Images++
+	case ContentTypeVideo:
+		a.Videos++
+	case ContentTypeAudio:
+		a.Audio++
+	default:
+		a.Files++
+	}
+	if contentType != "" {
+		a.ContentTypes = append(a.ContentTypes, contentType)
+	}
+}
+
+// classifyAttachment maps an attachment's MIME type (or file extension) to a content type
+func classifyAttachment(contentType, filename string) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.HasPrefix(contentType, "image"):
+		return ContentTypeImage
+	case strings.HasPrefix(contentType, "video"):
+		return ContentTypeVideo
+	case strings.HasPrefix(contentType, "audio"), contentType == "voice":
+		return ContentTypeAudio
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		return ContentTypeImage
+	case ".mp4", ".mov", ".avi", ".mkv", ".webm":
+		return ContentTypeVideo
+	case ".mp3", ".wav", ".amr", ".silk", ".ogg", ".m4a":
+		return ContentTypeAudio
+	}
+	return ContentTypeFile
+}
+
+// DetectContentType returns the dominant content type of a message. Heavier
+// attachments win over lighter ones, rich content over plain text.
+func DetectContentType(message string, attachments AttachmentSummary) string {
+	switch {
+	case attachments.Videos > 0:
+		return ContentTypeVideo
+	case attachments.Files > 0:
+		return ContentTypeFile
+	case attachments.Audio > 0:
+		return ContentTypeAudio
+	case attachments.Images > 0:
+		return ContentTypeImage
+	case attachments.HasArk:
+		return ContentTypeArk
+	case attachments.HasEmbed:
+		return ContentTypeEmbed
+	case attachments.HasMarkdown:
+		return ContentTypeMarkdown
+	}
+
+	if len(strings.TrimSpace(message)) == 0 {
+		return ContentTypeEmpty
+	}
+	if len(message) > longTextThreshold {
+		return ContentTypeLongText
+	}
+	if ContainsURL(message) {
+		return ContentTypeURL
+	}
+	return ContentTypeText
 }
 
 // IsSpamPattern detects potential spam messages using provided keywords
@@ -89,15 +281,6 @@ func IsHighPriorityMessage(message string, priorityKeywords []string) bool {
 	return false
 }
 
-// IsFastUser determines if a user is a fast/active user (simplified implementation)
-func IsFastUser(userID string) bool {
-	// This is a simplified implementation
-	// In a real system, this would check user behavior history
-	hash := md5.Sum([]byte(userID))
-	// Use hash to create consistent but pseudo-random classification
-	return hash[0]%4 == 0 // 25% of users are considered "fast"
-}
-
 // ContainsURL checks if the message contains any URLs
 func ContainsURL(message string) bool {
 	// Simple URL detection regex
@@ -105,29 +288,3 @@ func ContainsURL(message string) bool {
 	matched, _ := regexp.MatchString(urlPattern, message)
 	return matched
 }
-
-// CalculateMessagePriority calculates message priority based on content and user with provided keywords
-func CalculateMessagePriority(userID, message string, spamKeywords, priorityKeywords []string) int {
-	basePriority := 5 // Default priority (1-10 scale)
-
-	// Factor 1: Message pattern analysis
-	if IsSpamPattern(message, spamKeywords) {
-		basePriority = 1 // Lowest priority for spam
-	} else if IsHighPriorityMessage(message, priorityKeywords) {
-		basePriority = 10 // Highest priority for important messages
-	}
-
-	// Factor 2: User behavior analysis (simplified)
-	if IsFastUser(userID) {
-		basePriority += 2 // Higher priority for active users
-	}
-
-	// Ensure priority is within valid range
-	if basePriority < 1 {
-		basePriority = 1
-	} else if basePriority > 10 {
-		basePriority = 10
-	}
-
-	return basePriority
-}